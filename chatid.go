@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// crockfordAlphabet is the Crockford base32 alphabet used by ULIDs
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newChatID returns a new ULID to use as an immutable chat identifier
+func newChatID() string {
+	return newULID(time.Now())
+}
+
+// newULID encodes a 48-bit millisecond timestamp and 80 random bits as a ULID
+func newULID(t time.Time) string {
+	var b [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		// Fall back to the clock so IDs stay unique enough to be usable
+		ns := uint64(t.UnixNano())
+		for i := 15; i >= 6; i-- {
+			b[i] = byte(ns)
+			ns >>= 8
+		}
+	}
+
+	// 26 characters of 5 bits cover the 128-bit value with 2 leading zero bits
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		bit := (25 - i) * 5
+		var v byte
+		for j := 0; j < 5; j++ {
+			pos := bit + j
+			if pos >= 128 {
+				break
+			}
+			if b[15-pos/8]&(1<<(pos%8)) != 0 {
+				v |= 1 << j
+			}
+		}
+		out[i] = crockfordAlphabet[v]
+	}
+	return string(out)
+}
+
+// isChatID reports whether s is a well-formed ULID
+func isChatID(s string) bool {
+	if len(s) != 26 || s[0] > '7' {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune(crockfordAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// chatDisplayTitle returns the human title of a chat, falling back to its ID
+func chatDisplayTitle(chatFile *ChatFile, id string) string {
+	if chatFile != nil && chatFile.Metadata.Title != "" {
+		return chatFile.Metadata.Title
+	}
+	return id
+}
+
+// loadChatTitle returns the human title of the chat with the given ID
+func loadChatTitle(id string) string {
+	chatFile, err := loadChatWithMetadata(id)
+	if err != nil {
+		return id
+	}
+	return chatDisplayTitle(chatFile, id)
+}
+
+// defaultChatTitle returns the title given to chats created without one
+func defaultChatTitle() string {
+	return "Chat " + time.Now().Format("2006-01-02 15:04")
+}
+
+// cleanChatTitle normalizes a user- or model-supplied title
+func cleanChatTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	// Models like to wrap titles in quotes
+	for _, q := range []string{"\"", "'", "`"} {
+		if len(title) >= 2 && strings.HasPrefix(title, q) && strings.HasSuffix(title, q) {
+			title = strings.TrimSpace(title[1 : len(title)-1])
+		}
+	}
+	return title
+}
+
+// renameChat changes the title of a chat without touching its file name
+func renameChat(id, title string) error {
+	title = cleanChatTitle(title)
+	if title == "" {
+		return fmt.Errorf("chat title cannot be empty")
+	}
+	return updateChatMetadata(id, func(meta *ChatMetadata) {
+		meta.Title = title
+		meta.PlaceholderTitle = false
+	})
+}
+
+// migrateChatIDs moves chats stored under their human name to ULID file
+// names, keeping the old name as the chat title
+func migrateChatIDs() error {
+	for _, dir := range chatDirs() {
+		if err := migrateChatIDsIn(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateChatIDsIn migrates the chats of one chat directory, keeping them there
+func migrateChatIDsIn(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) && dir != chatsPath {
+			return nil
+		}
+		return fmt.Errorf("failed to read chat directory: %w", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".json")
+		if isChatID(name) {
+			continue
+		}
+
+		chatFile, _, err := readChat(name)
+		if err != nil {
+			return fmt.Errorf("failed to migrate chat '%s': %w", name, err)
+		}
+		if chatFile.Metadata.Title == "" {
+			chatFile.Metadata.Title = name
+			// Names like chat-1700000000 were never chosen by the user
+			chatFile.Metadata.PlaceholderTitle = strings.HasPrefix(name, "chat-")
+		}
+		modified := time.Now()
+		if info, err := f.Info(); err == nil {
+			modified = info.ModTime()
+		}
+		if chatFile.Metadata.CreatedAt.IsZero() {
+			chatFile.Metadata.CreatedAt = modified
+		}
+
+		id := newULID(chatFile.Metadata.CreatedAt)
+		if err := writeChatSnapshot(id, chatFile); err != nil {
+			return fmt.Errorf("failed to migrate chat '%s': %w", name, err)
+		}
+		// New chats are written to chatsPath; move it back beside the original
+		if written := chatSnapshotPath(id); filepath.Dir(written) != dir {
+			if err := os.Rename(written, filepath.Join(dir, id+".json")); err != nil {
+				return fmt.Errorf("failed to migrate chat '%s': %w", name, err)
+			}
+		}
+		// Keep the modification time so the recent-chats order is unchanged
+		os.Chtimes(chatSnapshotPath(id), modified, modified)
+		if err := os.Remove(chatSnapshotPath(name)); err != nil {
+			return fmt.Errorf("failed to remove migrated chat '%s': %w", name, err)
+		}
+		if err := os.Remove(chatJournalPath(name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove journal of migrated chat '%s': %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewULID(t *testing.T) {
+	tests := []struct {
+		name     string
+		time     time.Time
+		wantTime string // Encoded timestamp, the first 10 characters
+	}{
+		{"zero", time.UnixMilli(0), "0000000000"},
+		{"spec example", time.UnixMilli(1469918176385), "01ARYZ6S41"},
+		{"largest timestamp", time.UnixMilli(1<<48 - 1), "7ZZZZZZZZZ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := newULID(tt.time)
+			if !isChatID(id) {
+				t.Fatalf("newULID = %q, not a chat ID", id)
+			}
+			if got := id[:10]; got != tt.wantTime {
+				t.Errorf("timestamp %q, want %q", got, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestNewULIDSortsByTime(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	prev := newULID(start)
+	for i := 1; i < 100; i++ {
+		id := newULID(start.Add(time.Duration(i) * time.Millisecond))
+		if id <= prev {
+			t.Fatalf("%q sorts before the earlier %q", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestIsChatID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"01ARYZ6S41TSV4RRFFQ69G5FAV", true},
+		{"7ZZZZZZZZZZZZZZZZZZZZZZZZZ", true},
+		{"81ARYZ6S41TSV4RRFFQ69G5FAV", false}, // Overflows 128 bits
+		{"01arz3ndektsv4rrffq69g5fav", false}, // Lower case
+		{"01ARYZ6S41TSV4RRFFQ69G5FAI", false}, // I is not in the alphabet
+		{"01ARYZ6S41TSV4RRFFQ69G5FA", false},
+		{"chat-1700000000", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isChatID(tt.id); got != tt.want {
+			t.Errorf("isChatID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateChatIDs(t *testing.T) {
+	useTempDirs(t)
+	if err := saveChat("chat-1700000000", msgs("hi", "hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveChat("My notes", msgs("remember")); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateChatIDs(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(chatsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if !isChatID(id) {
+			t.Errorf("%s was not migrated", entry.Name())
+			continue
+		}
+		chatFile, err := loadChatWithMetadata(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		titles[chatFile.Metadata.Title] = chatFile.Metadata.PlaceholderTitle
+	}
+	want := map[string]bool{"chat-1700000000": true, "My notes": false}
+	if len(titles) != len(want) {
+		t.Fatalf("titles %v, want %v", titles, want)
+	}
+	for title, placeholder := range want {
+		if got, ok := titles[title]; !ok || got != placeholder {
+			t.Errorf("title %q placeholder = %v (found %v), want %v", title, got, ok, placeholder)
+		}
+	}
+}
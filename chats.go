@@ -2,10 +2,9 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,16 +20,41 @@ type Message struct {
 // ChatMetadata stores additional information about the chat
 // Add Model string to store the model used for the chat
 type ChatMetadata struct {
-	Summary   string    `json:"summary,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	Model     string    `json:"model,omitempty"`
-	Favorite  bool      `json:"favorite,omitempty"`
+	Title string `json:"title,omitempty"`
+	// PlaceholderTitle marks a generated default title that background
+	// jobs may replace with a better one
+	PlaceholderTitle bool      `json:"placeholder_title,omitempty"`
+	Summary          string    `json:"summary,omitempty"`
+	CreatedAt        time.Time `json:"created_at,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	Favorite         bool      `json:"favorite,omitempty"`
+	Tags             []string  `json:"tags,omitempty"`
+	Folder           string    `json:"folder,omitempty"` // Slash-separated, e.g. "work/project-x"
+	// ImportSource identifies the conversation a chat was imported from,
+	// e.g. "chatgpt:<conversation id>", so re-imports skip it
+	ImportSource string `json:"import_source,omitempty"`
+	// ContextStrategy overrides the configured context strategy for this chat
+	ContextStrategy string `json:"context_strategy,omitempty"`
+	// ContextSummary caches the summary of older messages, which covers the
+	// active path up to and including the node ContextSummaryUpTo
+	ContextSummary     string `json:"context_summary,omitempty"`
+	ContextSummaryUpTo string `json:"context_summary_up_to,omitempty"`
+	// Profile names the profile the chat was set up with; APIKey (the title
+	// of a stored key) and Params are the choices it made
+	Profile string            `json:"profile,omitempty"`
+	APIKey  string            `json:"api_key,omitempty"`
+	Params  *GenerationParams `json:"params,omitempty"`
 }
 
-// ChatFile represents the complete chat file structure
+// ChatFile represents the complete chat file structure.
+// Nodes holds every message as a tree; Messages mirrors the active path
+// from the root to ActiveLeaf so flat readers keep working.
 type ChatFile struct {
-	Metadata ChatMetadata `json:"metadata"`
-	Messages []Message    `json:"messages"`
+	SchemaVersion int           `json:"schema_version"`
+	Metadata      ChatMetadata  `json:"metadata"`
+	Messages      []Message     `json:"messages"`
+	Nodes         []MessageNode `json:"nodes,omitempty"`
+	ActiveLeaf    string        `json:"active_leaf,omitempty"`
 }
 
 // ChatCommand represents a chat command
@@ -40,19 +64,47 @@ type ChatCommand struct {
 	Handler     func(messages []Message, chatName string, model string) (bool, error)
 }
 
-// Default system prompt for chat initialization
-var systemPrompt Message
-
 var commands []ChatCommand
 
-// Global variable to track the currently active chat
+// Global variable to track the ID of the currently active chat
 var activeChatName string
 
-// listChats lists the 10 most recent saved chat filenames without extension, sorted by creation date (newest to oldest)
+// listChats lists the IDs of the 10 most recently modified chats (newest first)
 func listChats() ([]string, error) {
-	files, err := os.ReadDir(chatsPath)
+	chats, err := listAllChats()
+	if err != nil {
+		return nil, err
+	}
+
+	// Return only the 10 most recent chats
+	maxChats := 10
+	if len(chats) > maxChats {
+		chats = chats[:maxChats]
+	}
+	return chats, nil
+}
+
+// readChatDirs lists the files of every chat directory
+func readChatDirs() ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	for _, dir := range chatDirs() {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) && dir != chatsPath {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read chat directory: %w", err)
+		}
+		entries = append(entries, files...)
+	}
+	return entries, nil
+}
+
+// listAllChats lists the IDs of all chats, most recently modified first
+func listAllChats() ([]string, error) {
+	files, err := readChatDirs()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read chat directory: %w", err)
+		return nil, err
 	}
 	type chatInfo struct {
 		Name       string
@@ -89,12 +141,6 @@ func listChats() ([]string, error) {
 		return chatInfos[i].ModifiedAt.After(chatInfos[j].ModifiedAt)
 	})
 
-	// Return only the 10 most recent chats
-	maxChats := 10
-	if len(chatInfos) > maxChats {
-		chatInfos = chatInfos[:maxChats]
-	}
-
 	chats := make([]string, len(chatInfos))
 	for i, ci := range chatInfos {
 		chats[i] = ci.Name
@@ -102,11 +148,11 @@ func listChats() ([]string, error) {
 	return chats, nil
 }
 
-// listFavoriteChats lists all favorite chats
+// listFavoriteChats lists the IDs of all favorite chats
 func listFavoriteChats() ([]string, error) {
-	files, err := os.ReadDir(chatsPath)
+	files, err := readChatDirs()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read chat directory: %w", err)
+		return nil, err
 	}
 
 	var favoriteChats []string
@@ -135,61 +181,46 @@ func listFavoriteChats() ([]string, error) {
 
 // loadChat loads chat file with messages and metadata
 func loadChat(name string) ([]Message, error) {
-	data, err := os.ReadFile(filepath.Join(chatsPath, name+".json"))
+	chatFile, _, err := readChat(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read chat file '%s': %w", name, err)
-	}
-	var chatFile ChatFile
-	if err := json.Unmarshal(data, &chatFile); err != nil {
-		// Try loading legacy format (just messages array)
-		var messages []Message
-		if err2 := json.Unmarshal(data, &messages); err2 != nil {
-			return nil, fmt.Errorf("failed to unmarshal chat file '%s': %w", name, err)
-		}
-		return messages, nil
+		return nil, err
 	}
 	return chatFile.Messages, nil
 }
 
 // loadChatWithMetadata loads the complete chat file including metadata
 func loadChatWithMetadata(name string) (*ChatFile, error) {
-	data, err := os.ReadFile(filepath.Join(chatsPath, name+".json"))
+	chatFile, _, err := readChat(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read chat file '%s': %w", name, err)
-	}
-	var chatFile ChatFile
-	if err := json.Unmarshal(data, &chatFile); err != nil {
-		// Try loading legacy format (just messages array)
-		var messages []Message
-		if err2 := json.Unmarshal(data, &messages); err2 != nil {
-			return nil, fmt.Errorf("failed to unmarshal chat file '%s': %w", name, err)
-		}
-		chatFile.Messages = messages
+		return nil, err
 	}
-	return &chatFile, nil
+	return chatFile, nil
 }
 
-// saveChat saves chat messages and metadata to a file
+// saveChat saves chat messages, keeping the existing metadata
 func saveChat(name string, messages []Message) error {
-	// Try to load existing metadata
-	var chatFile ChatFile
-	if existingChat, err := loadChatWithMetadata(name); err == nil {
-		chatFile = *existingChat
+	// A chat may exist as a journal only, before its first snapshot
+	_, snapErr := os.Stat(chatSnapshotPath(name))
+	_, journalErr := os.Stat(chatJournalPath(name))
+	if os.IsNotExist(snapErr) && os.IsNotExist(journalErr) {
+		return saveChatFile(name, &ChatFile{Messages: messages})
 	}
-	chatFile.Messages = messages
+	return updateChat(name, func(chatFile *ChatFile) {
+		chatFile.Messages = messages
+	})
+}
+
+// saveChatFile saves a complete chat, recording the changes in its journal.
+// chatFile.Messages is treated as the new active path; edits to earlier
+// messages become new branches in the tree.
+func saveChatFile(name string, chatFile *ChatFile) error {
 	// Set CreatedAt if not already set
 	if chatFile.Metadata.CreatedAt.IsZero() {
 		chatFile.Metadata.CreatedAt = time.Now()
 	}
-	data, err := json.MarshalIndent(chatFile, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal chat: %w", err)
-	}
-	err = os.WriteFile(filepath.Join(chatsPath, name+".json"), data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write chat file '%s': %w", name, err)
-	}
-	return nil
+	ensureTree(chatFile)
+	applyMessages(chatFile, chatFile.Messages)
+	return storeChat(name, chatFile)
 }
 
 // listChatsAndSummarize lists chats and prints their stored summaries
@@ -214,7 +245,7 @@ func listChatsAndSummarize() error {
 		if chatFile.Metadata.Favorite {
 			favoriteMark = "★"
 		}
-		fmt.Printf("%d) %s %s\n", i+1, c, favoriteMark)
+		fmt.Printf("%d) %s %s\n", i+1, chatDisplayTitle(chatFile, c), favoriteMark)
 		summary := chatFile.Metadata.Summary
 		if summary == "" {
 			summary = "No summary available."
@@ -242,7 +273,7 @@ func loadAndContinueChat(reader *bufio.Reader) error {
 		if err == nil && chatFile.Metadata.Favorite {
 			favoriteMark = "★"
 		}
-		fmt.Printf("%d) %s %s\n", i+1, c, favoriteMark)
+		fmt.Printf("%d) %s %s\n", i+1, chatDisplayTitle(chatFile, c), favoriteMark)
 	}
 	fmt.Print("Enter chat number to load (or 'f' + number to toggle favorite): ")
 	input, _ := reader.ReadString('\n')
@@ -293,7 +324,11 @@ func generateTimestampChatName() string {
 
 // quickChatFlow creates a new chat using default model and prompt
 func quickChatFlow(reader *bufio.Reader) error {
-	chatName, err := setupNewChat(reader)
+	title, err := setupNewChat(reader)
+	if err != nil {
+		return err
+	}
+	chatName := newChatID()
 	err = os.Setenv("OPENAI_API_KEY", "sk-")
 	if err != nil {
 		return fmt.Errorf("failed to set API key: %w", err)
@@ -320,15 +355,11 @@ func quickChatFlow(reader *bufio.Reader) error {
 	// Save the new chat with model in metadata
 	var chatFile ChatFile
 	chatFile.Messages = messages
+	chatFile.Metadata.Title = title
 	chatFile.Metadata.Model = defaultModel
 	chatFile.Metadata.CreatedAt = time.Now()
-	data, err := json.MarshalIndent(chatFile, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal chat: %w", err)
-	}
-	err = os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write chat file '%s': %w", chatName, err)
+	if err := saveChatFile(chatName, &chatFile); err != nil {
+		return err
 	}
 
 	fmt.Printf("Starting quick chat with default model '%s' and prompt '%s'...\n\n",
@@ -340,10 +371,11 @@ func quickChatFlow(reader *bufio.Reader) error {
 
 // customChatFlow creates a new chat with user-selected model and prompt
 func customChatFlow(reader *bufio.Reader) error {
-	chatName, err := setupNewChat(reader)
+	title, err := setupNewChat(reader)
 	if err != nil {
 		return err
 	}
+	chatName := newChatID()
 
 	// Let user select model
 	model, err := promptModelAtChatStart(reader)
@@ -365,15 +397,11 @@ func customChatFlow(reader *bufio.Reader) error {
 	// Save the new chat with model in metadata
 	var chatFile ChatFile
 	chatFile.Messages = messages
+	chatFile.Metadata.Title = title
 	chatFile.Metadata.Model = model
 	chatFile.Metadata.CreatedAt = time.Now()
-	data, err := json.MarshalIndent(chatFile, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal chat: %w", err)
-	}
-	err = os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write chat file '%s': %w", chatName, err)
+	if err := saveChatFile(chatName, &chatFile); err != nil {
+		return err
 	}
 
 	fmt.Printf("Starting custom chat with model '%s' and prompt '%s'...\n\n",
@@ -429,36 +457,23 @@ func generateChatSummary(messages []Message, model string) string {
 	return summary
 }
 
-// setupNewChat handles common chat creation logic
+// setupNewChat asks for the title of a new chat. Chats are stored under a
+// generated ID, so titles do not need to be unique.
 func setupNewChat(reader *bufio.Reader) (string, error) {
 	fmt.Print("Enter chat name (press Enter for timestamp): ")
-	chatName, _ := reader.ReadString('\n')
-	chatName = strings.TrimSpace(chatName)
-	if chatName == "" {
-		chatName = generateTimestampChatName()
-		fmt.Printf("Using timestamp as chat name: %s\n", chatName)
+	title, err := reader.ReadString('\n')
+	if err != nil && title == "" {
+		return "", fmt.Errorf("failed to read chat name: %w", err)
 	}
-
-	// Check if chat already exists
-	chats, err := listChats()
-	if err != nil {
-		return "", fmt.Errorf("failed to check existing chats: %w", err)
-	}
-	for _, c := range chats {
-		if c == chatName {
-			return "", fmt.Errorf("chat '%s' already exists", chatName)
-		}
+	title = cleanChatTitle(title)
+	if title == "" {
+		title = generateTimestampChatName()
+		fmt.Printf("Using timestamp as chat name: %s\n", title)
 	}
-
-	return chatName, nil
+	return title, nil
 }
 
 func init() {
-	systemPrompt = Message{
-		Role:    "system",
-		Content: "You are a helpful AI assistant.",
-	}
-
 	commands = []ChatCommand{
 		{
 			Command:     "!q, !quit, !exit, !e",
@@ -478,17 +493,18 @@ func init() {
 					chatFile.Metadata.Summary = summary
 
 					// Save with summary
-					if err := saveChat(chatName, messages); err != nil {
+					if err := saveChatFile(chatName, &chatFile); err != nil {
 						return true, fmt.Errorf("saving chat on exit: %w", err)
 					}
-					fmt.Println("Chat saved as:", chatName)
+					currentTitle := chatDisplayTitle(&chatFile, chatName)
+					fmt.Println("Chat saved as:", currentTitle)
 
-					// Prompt for new file name
+					// Prompt for a new title
 					reader := bufio.NewReader(os.Stdin)
-					fmt.Print("Enter a new chat file name, !g to generate a title, or leave blank to use the timestamp: ")
+					fmt.Print("Enter a new chat title, !g to generate a title, or leave blank to keep the current one: ")
 					newName, _ := reader.ReadString('\n')
 					newName = strings.TrimSpace(newName)
-					finalName := chatName
+					finalName := currentTitle
 
 					if newName == "!g" {
 						// Use the generated summary to create a title
@@ -499,39 +515,20 @@ func init() {
 						titleMessages := append(messages, titlePrompt)
 						generatedTitle, err := streamChatResponse(titleMessages, model)
 						if err != nil {
-							fmt.Println("Failed to generate title, using timestamp.")
-							finalName = chatName
-						} else {
-							// Clean up the generated title for filename use
-							generatedTitle = strings.TrimSpace(generatedTitle)
-							generatedTitle = strings.ReplaceAll(generatedTitle, " ", "_")
-							generatedTitle = strings.ReplaceAll(generatedTitle, "/", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, "\\", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, ":", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, "*", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, "?", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, "\"", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, "<", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, ">", "-")
-							generatedTitle = strings.ReplaceAll(generatedTitle, "|", "-")
-							if generatedTitle == "" {
-								finalName = chatName
-							} else {
-								finalName = generatedTitle
-							}
+							fmt.Println("Failed to generate title, keeping the current one.")
+						} else if generatedTitle = cleanChatTitle(generatedTitle); generatedTitle != "" {
+							finalName = generatedTitle
 						}
 					} else if newName != "" {
 						finalName = newName
 					}
 
-					// If the name changed, rename the file
-					if finalName != chatName {
-						oldPath := filepath.Join(chatsPath, chatName+".json")
-						newPath := filepath.Join(chatsPath, finalName+".json")
-						if err := os.Rename(oldPath, newPath); err != nil {
-							fmt.Printf("Failed to rename chat file: %v\n", err)
+					// If the title changed, update the metadata; the file keeps its ID
+					if finalName != currentTitle {
+						if err := renameChat(chatName, finalName); err != nil {
+							fmt.Printf("Failed to rename chat: %v\n", err)
 						} else {
-							fmt.Printf("Chat file renamed to: %s\n", finalName)
+							fmt.Printf("Chat renamed to: %s\n", cleanChatTitle(finalName))
 						}
 					}
 				}
@@ -547,13 +544,28 @@ func init() {
 					if err := saveChat(chatName, messages); err != nil {
 						return false, fmt.Errorf("manual chat save: %w", err)
 					}
-					fmt.Println("Chat saved as:", chatName)
+					fmt.Println("Chat saved as:", loadChatTitle(chatName))
 				} else {
 					fmt.Println("No messages to save.")
 				}
 				return false, nil
 			},
 		},
+		{
+			Command:     "!delete",
+			Description: "Move the current chat to the trash and exit",
+			Handler: func(messages []Message, chatName string, _ string) (bool, error) {
+				if _, err := os.Stat(chatSnapshotPath(chatName)); os.IsNotExist(err) {
+					fmt.Println("Chat was never saved; nothing to delete.")
+					return true, nil
+				}
+				if err := trashChat(chatName); err != nil {
+					return false, fmt.Errorf("deleting chat: %w", err)
+				}
+				fmt.Println("Chat moved to trash.")
+				return true, nil
+			},
+		},
 		{
 			Command:     "!help",
 			Description: "Show available commands",
@@ -611,7 +623,7 @@ func runChat(chatName string, messages []Message, reader *bufio.Reader, model st
 		activeChatName = ""
 	}()
 
-	messages = prependSystemPrompt(messages, systemPrompt)
+	messages = prependSystemPrompt(messages, Message{Role: "system", Content: currentSettings().SystemPrompt})
 
 	// Load existing chat file to preserve metadata
 	var chatFile ChatFile
@@ -625,9 +637,6 @@ func runChat(chatName string, messages []Message, reader *bufio.Reader, model st
 		resp, err := streamChatResponse(messages, model)
 		if err != nil {
 			handleError(err, "getting initial AI response")
-			if strings.Contains(err.Error(), "API returned status 400") {
-				return
-			}
 		} else {
 			messages = append(messages, Message{Role: "assistant", Content: resp})
 			chatFile.Messages = messages
@@ -667,14 +676,16 @@ func runChat(chatName string, messages []Message, reader *bufio.Reader, model st
 		messages = append(messages, Message{Role: "user", Content: userInput})
 		chatFile.Messages = messages
 
-		reply, err := streamChatResponse(messages, model)
+		fitted, usage := prepareContext(chatName, messages, model)
+		if usage.Note != "" {
+			fmt.Printf("\033[33m(%s)\033[0m\n", usage.Note)
+		}
+		reply, err := streamChatResponse(fitted, model)
 		if err != nil {
+			// Stay in the chat so the user can retry or rephrase
 			handleError(err, "getting AI response")
 			messages = messages[:len(messages)-1]
 			chatFile.Messages = messages
-			if strings.Contains(err.Error(), "API returned status 400") {
-				return
-			}
 			continue
 		}
 
@@ -682,13 +693,8 @@ func runChat(chatName string, messages []Message, reader *bufio.Reader, model st
 		chatFile.Messages = messages
 
 		// Auto-save without regenerating summary
-		data, err := json.MarshalIndent(chatFile, "", "  ")
-		if err != nil {
+		if err := saveChatFile(chatName, &chatFile); err != nil {
 			handleError(err, "auto-saving chat")
-		} else {
-			if err := os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644); err != nil {
-				handleError(err, "auto-saving chat")
-			}
 		}
 	}
 }
@@ -716,11 +722,7 @@ func generateSummariesForActiveChats() error {
 		chatFile.Metadata.Summary = summary
 
 		// Save the updated chat file
-		data, err := json.MarshalIndent(chatFile, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal active chat '%s': %w", activeChatName, err)
-		}
-		if err := os.WriteFile(filepath.Join(chatsPath, activeChatName+".json"), data, 0644); err != nil {
+		if err := saveChatFile(activeChatName, chatFile); err != nil {
 			return fmt.Errorf("failed to save active chat '%s': %w", activeChatName, err)
 		}
 		fmt.Printf("Summary generated and saved for active chat '%s'\n", activeChatName)
@@ -737,12 +739,7 @@ func toggleChatFavorite(chatName string) error {
 
 	chatFile.Metadata.Favorite = !chatFile.Metadata.Favorite
 
-	data, err := json.MarshalIndent(chatFile, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal chat '%s': %w", chatName, err)
-	}
-
-	if err := os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644); err != nil {
+	if err := saveChatFile(chatName, chatFile); err != nil {
 		return fmt.Errorf("failed to save chat '%s': %w", chatName, err)
 	}
 
@@ -750,7 +747,7 @@ func toggleChatFavorite(chatName string) error {
 	if !chatFile.Metadata.Favorite {
 		status = "unfavorited"
 	}
-	fmt.Printf("Chat '%s' %s.\n", chatName, status)
+	fmt.Printf("Chat '%s' %s.\n", chatDisplayTitle(chatFile, chatName), status)
 	return nil
 }
 
@@ -767,7 +764,7 @@ func loadFavoriteChat(reader *bufio.Reader) error {
 
 	fmt.Println("Favorite chats:")
 	for i, c := range favoriteChats {
-		fmt.Printf("%d) %s\n", i+1, c)
+		fmt.Printf("%d) %s\n", i+1, loadChatTitle(c))
 	}
 	fmt.Print("Enter chat number to load: ")
 	input, _ := reader.ReadString('\n')
@@ -825,7 +822,7 @@ func favoritesMenu(reader *bufio.Reader) error {
 					if summary == "" {
 						summary = "No summary available."
 					}
-					fmt.Printf("%d) %s\n   Summary: %s\n\n", i+1, c, summary)
+					fmt.Printf("%d) %s\n   Summary: %s\n\n", i+1, chatDisplayTitle(chatFile, c), summary)
 				}
 				return nil
 			}},
@@ -842,7 +839,7 @@ func favoritesMenu(reader *bufio.Reader) error {
 
 				fmt.Println("Favorite chats:")
 				for i, c := range favoriteChats {
-					fmt.Printf("%d) %s\n", i+1, c)
+					fmt.Printf("%d) %s\n", i+1, loadChatTitle(c))
 				}
 				fmt.Print("Enter chat number to load in GUI: ")
 				input, _ := r.ReadString('\n')
@@ -862,7 +859,7 @@ func favoritesMenu(reader *bufio.Reader) error {
 				if model == "" {
 					model = DefaultModel()
 				}
-				fmt.Printf("Loading favorite chat '%s' with model '%s' in GUI...\n", chatName, model)
+				fmt.Printf("Loading favorite chat '%s' with model '%s' in GUI...\n", chatDisplayTitle(chatFile, chatName), model)
 
 				runChatGUI(chatName, chatFile.Messages, r, model)
 				return nil
@@ -885,7 +882,7 @@ func favoritesMenu(reader *bufio.Reader) error {
 				}
 				fmt.Println("Non-favorite chats:")
 				for i, c := range nonFavChats {
-					fmt.Printf("%d) %s\n", i+1, c)
+					fmt.Printf("%d) %s\n", i+1, loadChatTitle(c))
 				}
 				fmt.Print("Enter number to add to favorites, or 0 to return: ")
 				input, _ := r.ReadString('\n')
@@ -899,22 +896,14 @@ func favoritesMenu(reader *bufio.Reader) error {
 					return nil
 				}
 				chatName := nonFavChats[idx-1]
-				chatFile, err := loadChatWithMetadata(chatName)
-				if err != nil {
-					fmt.Printf("Failed to load chat '%s': %v\n", chatName, err)
-					return nil
-				}
-				chatFile.Metadata.Favorite = true
-				data, err := json.MarshalIndent(chatFile, "", "  ")
+				err = updateChatMetadata(chatName, func(meta *ChatMetadata) {
+					meta.Favorite = true
+				})
 				if err != nil {
-					fmt.Printf("Failed to marshal chat '%s': %v\n", chatName, err)
+					fmt.Printf("Failed to save chat '%s': %v\n", loadChatTitle(chatName), err)
 					return nil
 				}
-				if err := os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644); err != nil {
-					fmt.Printf("Failed to save chat '%s': %v\n", chatName, err)
-					return nil
-				}
-				fmt.Printf("Chat '%s' added to favorites.\n", chatName)
+				fmt.Printf("Chat '%s' added to favorites.\n", loadChatTitle(chatName))
 				return nil
 			}},
 			{Label: "Back to main menu", ExitItem: true},
@@ -985,7 +974,7 @@ func guiChatMenu(reader *bufio.Reader) error {
 					if err == nil && chatFile.Metadata.Favorite {
 						favoriteMark = "★"
 					}
-					fmt.Printf("%d) %s %s\n", i+1, c, favoriteMark)
+					fmt.Printf("%d) %s %s\n", i+1, chatDisplayTitle(chatFile, c), favoriteMark)
 				}
 				fmt.Print("Enter chat number to load in GUI: ")
 				input, _ := r.ReadString('\n')
@@ -1005,16 +994,17 @@ func guiChatMenu(reader *bufio.Reader) error {
 				if model == "" {
 					model = DefaultModel()
 				}
-				fmt.Printf("Loading chat '%s' with model '%s' in GUI...\n", chatName, model)
+				fmt.Printf("Loading chat '%s' with model '%s' in GUI...\n", chatDisplayTitle(chatFile, chatName), model)
 
 				runChatGUI(chatName, chatFile.Messages, r, model)
 				return nil
 			}},
 			{Label: "New GUI chat", Handler: func(r *bufio.Reader) error {
-				chatName, err := setupNewChat(r)
+				title, err := setupNewChat(r)
 				if err != nil {
 					return err
 				}
+				chatName := newChatID()
 
 				// Let user select model
 				model, err := promptModelAtChatStart(r)
@@ -1036,15 +1026,11 @@ func guiChatMenu(reader *bufio.Reader) error {
 				// Save the new chat with model in metadata
 				var chatFile ChatFile
 				chatFile.Messages = messages
+				chatFile.Metadata.Title = title
 				chatFile.Metadata.Model = model
 				chatFile.Metadata.CreatedAt = time.Now()
-				data, err := json.MarshalIndent(chatFile, "", "  ")
-				if err != nil {
-					return fmt.Errorf("failed to marshal chat: %w", err)
-				}
-				err = os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644)
-				if err != nil {
-					return fmt.Errorf("failed to write chat file '%s': %w", chatName, err)
+				if err := saveChatFile(chatName, &chatFile); err != nil {
+					return err
 				}
 
 				fmt.Printf("Starting new GUI chat with model '%s' and prompt '%s'...\n",
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// MessageNode is a message stored in the chat tree
+type MessageNode struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parent_id,omitempty"`
+	Message
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"` // Always kept in the model context
+	Chosen    bool      `json:"chosen,omitempty"` // Picked among alternative replies
+}
+
+// branchPos describes where a message sits among its siblings
+type branchPos struct {
+	Index  int  // 1-based position among siblings
+	Count  int  // number of siblings including the message itself
+	Chosen bool // whether the message was picked among its siblings
+}
+
+// newNodeID returns a random identifier for a message node
+func newNodeID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// findNode returns the index of the node with the given ID, or -1
+func findNode(chatFile *ChatFile, id string) int {
+	for i := range chatFile.Nodes {
+		if chatFile.Nodes[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// childNodes returns the children of parentID in creation order
+func childNodes(chatFile *ChatFile, parentID string) []MessageNode {
+	var children []MessageNode
+	for _, node := range chatFile.Nodes {
+		if node.ParentID == parentID {
+			children = append(children, node)
+		}
+	}
+	return children
+}
+
+// legacyNodeID returns the stable ID given to the i-th node of a chat that
+// was stored before the tree existed, so repeated loads agree on IDs
+func legacyNodeID(i int) string {
+	return fmt.Sprintf("m%d", i)
+}
+
+// ensureTree builds a linear tree from the flat message list of legacy files
+func ensureTree(chatFile *ChatFile) {
+	if len(chatFile.Nodes) > 0 || len(chatFile.Messages) == 0 {
+		return
+	}
+	parentID := ""
+	for i, msg := range chatFile.Messages {
+		node := MessageNode{ID: legacyNodeID(i), ParentID: parentID, Message: msg, CreatedAt: chatFile.Metadata.CreatedAt}
+		chatFile.Nodes = append(chatFile.Nodes, node)
+		parentID = node.ID
+	}
+	chatFile.ActiveLeaf = parentID
+}
+
+// activePath returns the nodes from the root to the active leaf
+func activePath(chatFile *ChatFile) []MessageNode {
+	var path []MessageNode
+	id := chatFile.ActiveLeaf
+	for id != "" {
+		idx := findNode(chatFile, id)
+		if idx < 0 {
+			break
+		}
+		path = append([]MessageNode{chatFile.Nodes[idx]}, path...)
+		id = chatFile.Nodes[idx].ParentID
+	}
+	return path
+}
+
+// syncActivePath refreshes the flat message list from the active path
+func syncActivePath(chatFile *ChatFile) {
+	path := activePath(chatFile)
+	messages := make([]Message, len(path))
+	for i, node := range path {
+		messages[i] = node.Message
+	}
+	chatFile.Messages = messages
+}
+
+// applyMessages makes messages the active path of the tree. Messages that
+// match an existing child are reused; anything that diverges starts a new
+// branch, so earlier paths are never lost.
+func applyMessages(chatFile *ChatFile, messages []Message) {
+	onPath := make(map[string]bool)
+	for _, node := range activePath(chatFile) {
+		onPath[node.ID] = true
+	}
+
+	parentID := ""
+	for _, msg := range messages {
+		matchID := ""
+		for _, child := range childNodes(chatFile, parentID) {
+			if child.Message == msg {
+				matchID = child.ID
+				if onPath[child.ID] {
+					break
+				}
+			}
+		}
+		if matchID == "" {
+			node := MessageNode{ID: newNodeID(), ParentID: parentID, Message: msg, CreatedAt: time.Now()}
+			chatFile.Nodes = append(chatFile.Nodes, node)
+			matchID = node.ID
+		}
+		parentID = matchID
+	}
+	chatFile.ActiveLeaf = parentID
+	syncActivePath(chatFile)
+}
+
+// deepestLeaf follows the newest child from id down to a leaf
+func deepestLeaf(chatFile *ChatFile, id string) string {
+	for {
+		children := childNodes(chatFile, id)
+		if len(children) == 0 {
+			return id
+		}
+		id = children[len(children)-1].ID
+	}
+}
+
+// siblingPos returns the position of a node among its siblings
+func siblingPos(chatFile *ChatFile, id string) branchPos {
+	idx := findNode(chatFile, id)
+	if idx < 0 {
+		return branchPos{Index: 1, Count: 1}
+	}
+	siblings := childNodes(chatFile, chatFile.Nodes[idx].ParentID)
+	for i, sibling := range siblings {
+		if sibling.ID == id {
+			return branchPos{Index: i + 1, Count: len(siblings), Chosen: sibling.Chosen}
+		}
+	}
+	return branchPos{Index: 1, Count: 1}
+}
+
+// branchPositions returns the sibling position of every message on the active path
+func branchPositions(chatFile *ChatFile) []branchPos {
+	path := activePath(chatFile)
+	positions := make([]branchPos, len(path))
+	for i, node := range path {
+		positions[i] = siblingPos(chatFile, node.ID)
+	}
+	return positions
+}
+
+// switchBranch moves the active path at pathIndex to a neighbouring sibling
+// and follows that branch down to its newest leaf
+func switchBranch(chatFile *ChatFile, pathIndex, delta int) bool {
+	path := activePath(chatFile)
+	if pathIndex < 0 || pathIndex >= len(path) {
+		return false
+	}
+	siblings := childNodes(chatFile, path[pathIndex].ParentID)
+	if len(siblings) < 2 {
+		return false
+	}
+	current := 0
+	for i, sibling := range siblings {
+		if sibling.ID == path[pathIndex].ID {
+			current = i
+		}
+	}
+	target := (current + delta + len(siblings)) % len(siblings)
+	chatFile.ActiveLeaf = deepestLeaf(chatFile, siblings[target].ID)
+	syncActivePath(chatFile)
+	return true
+}
+
+// setPinned pins or unpins the message at pathIndex on the active path
+func setPinned(chatFile *ChatFile, pathIndex int, pinned bool) bool {
+	path := activePath(chatFile)
+	if pathIndex < 0 || pathIndex >= len(path) {
+		return false
+	}
+	chatFile.Nodes[findNode(chatFile, path[pathIndex].ID)].Pinned = pinned
+	return true
+}
+
+// setChosen marks the message at pathIndex on the active path as the one
+// picked among its siblings, so preferences between alternative replies
+// can be exported later
+func setChosen(chatFile *ChatFile, pathIndex int) bool {
+	path := activePath(chatFile)
+	if pathIndex < 0 || pathIndex >= len(path) {
+		return false
+	}
+	for i := range chatFile.Nodes {
+		if chatFile.Nodes[i].ParentID == path[pathIndex].ParentID {
+			chatFile.Nodes[i].Chosen = chatFile.Nodes[i].ID == path[pathIndex].ID
+		}
+	}
+	return true
+}
+
+// pinnedPositions reports which messages on the active path are pinned
+func pinnedPositions(chatFile *ChatFile) []bool {
+	path := activePath(chatFile)
+	pinned := make([]bool, len(path))
+	for i, node := range path {
+		pinned[i] = node.Pinned
+	}
+	return pinned
+}
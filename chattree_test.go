@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// msgs builds alternating user and assistant messages from their contents
+func msgs(contents ...string) []Message {
+	messages := make([]Message, len(contents))
+	for i, content := range contents {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = Message{Role: role, Content: content}
+	}
+	return messages
+}
+
+func TestApplyMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		saves     [][]Message // Active paths saved in order
+		wantNodes int
+		wantPos   []branchPos // Sibling positions along the final path
+	}{
+		{
+			name:      "linear",
+			saves:     [][]Message{msgs("a"), msgs("a", "b"), msgs("a", "b", "c")},
+			wantNodes: 3,
+			wantPos:   []branchPos{{1, 1, false}, {1, 1, false}, {1, 1, false}},
+		},
+		{
+			name:      "edit forks a branch",
+			saves:     [][]Message{msgs("a", "b", "c", "d"), msgs("a", "b", "x")},
+			wantNodes: 5,
+			wantPos:   []branchPos{{1, 1, false}, {1, 1, false}, {2, 2, false}},
+		},
+		{
+			name:      "regenerated reply",
+			saves:     [][]Message{msgs("a", "b"), msgs("a", "b2")},
+			wantNodes: 3,
+			wantPos:   []branchPos{{1, 1, false}, {2, 2, false}},
+		},
+		{
+			name:      "going back to an old branch reuses it",
+			saves:     [][]Message{msgs("a", "b"), msgs("a", "b2"), msgs("a", "b")},
+			wantNodes: 3,
+			wantPos:   []branchPos{{1, 1, false}, {1, 2, false}},
+		},
+		{
+			name:      "truncated",
+			saves:     [][]Message{msgs("a", "b", "c"), msgs("a")},
+			wantNodes: 3,
+			wantPos:   []branchPos{{1, 1, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chatFile := &ChatFile{}
+			for _, messages := range tt.saves {
+				applyMessages(chatFile, messages)
+			}
+			last := tt.saves[len(tt.saves)-1]
+			if !slices.Equal(chatFile.Messages, last) {
+				t.Errorf("active path %v, want %v", chatFile.Messages, last)
+			}
+			if len(chatFile.Nodes) != tt.wantNodes {
+				t.Errorf("%d nodes, want %d", len(chatFile.Nodes), tt.wantNodes)
+			}
+			if got := branchPositions(chatFile); !slices.Equal(got, tt.wantPos) {
+				t.Errorf("positions %v, want %v", got, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestSwitchBranch(t *testing.T) {
+	chatFile := &ChatFile{}
+	applyMessages(chatFile, msgs("a", "b", "c", "d"))
+	applyMessages(chatFile, msgs("a", "b", "x", "y"))
+	applyMessages(chatFile, msgs("a", "b", "z"))
+
+	tests := []struct {
+		name      string
+		pathIndex int
+		delta     int
+		wantOK    bool
+		want      []Message
+	}{
+		{"previous sibling follows it to its leaf", 2, -1, true, msgs("a", "b", "x", "y")},
+		{"again", 2, -1, true, msgs("a", "b", "c", "d")},
+		{"wraps around", 2, -1, true, msgs("a", "b", "z")},
+		{"next wraps around", 2, 1, true, msgs("a", "b", "c", "d")},
+		{"message without siblings", 1, 1, false, msgs("a", "b", "c", "d")},
+		{"out of range", 9, 1, false, msgs("a", "b", "c", "d")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := switchBranch(chatFile, tt.pathIndex, tt.delta); ok != tt.wantOK {
+				t.Errorf("switchBranch = %v, want %v", ok, tt.wantOK)
+			}
+			if !slices.Equal(chatFile.Messages, tt.want) {
+				t.Errorf("active path %v, want %v", chatFile.Messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureTreeLegacyIDs(t *testing.T) {
+	chatFile := &ChatFile{Messages: msgs("a", "b")}
+	ensureTree(chatFile)
+	if len(chatFile.Nodes) != 2 || chatFile.Nodes[1].ID != legacyNodeID(1) || chatFile.Nodes[1].ParentID != legacyNodeID(0) {
+		t.Fatalf("nodes %+v, want a linear tree with legacy IDs", chatFile.Nodes)
+	}
+	if chatFile.ActiveLeaf != legacyNodeID(1) {
+		t.Errorf("active leaf %q, want %q", chatFile.ActiveLeaf, legacyNodeID(1))
+	}
+}
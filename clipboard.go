@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// errNoClipboard is returned when no clipboard tool can be used
+var errNoClipboard = errors.New("no clipboard tool found; install wl-clipboard, xclip or xsel")
+
+// clipboardTool is a pair of commands that write and read the clipboard
+type clipboardTool struct {
+	Name  string
+	Copy  []string
+	Paste []string
+}
+
+// clipboardTools lists the tools to try on this platform, best first
+func clipboardTools() []clipboardTool {
+	switch runtime.GOOS {
+	case "windows":
+		return []clipboardTool{{
+			Name:  "PowerShell",
+			Copy:  []string{"powershell", "-NoProfile", "-Command", "$input | Set-Clipboard"},
+			Paste: []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard"},
+		}}
+	case "darwin":
+		return []clipboardTool{{Name: "pbcopy", Copy: []string{"pbcopy"}, Paste: []string{"pbpaste"}}}
+	}
+	var tools []clipboardTool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		tools = append(tools, clipboardTool{Name: "wl-clipboard", Copy: []string{"wl-copy"}, Paste: []string{"wl-paste", "--no-newline"}})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		tools = append(tools,
+			clipboardTool{Name: "xclip", Copy: []string{"xclip", "-selection", "clipboard", "-in"}, Paste: []string{"xclip", "-selection", "clipboard", "-out"}},
+			clipboardTool{Name: "xsel", Copy: []string{"xsel", "--clipboard", "--input"}, Paste: []string{"xsel", "--clipboard", "--output"}},
+		)
+	}
+	return tools
+}
+
+// availableClipboardTool returns the first tool that is installed
+func availableClipboardTool() (clipboardTool, bool) {
+	for _, tool := range clipboardTools() {
+		if _, err := exec.LookPath(tool.Copy[0]); err != nil {
+			continue
+		}
+		if _, err := exec.LookPath(tool.Paste[0]); err != nil {
+			continue
+		}
+		return tool, true
+	}
+	return clipboardTool{}, false
+}
+
+// readClipboard returns the text on the system clipboard
+func readClipboard() (string, error) {
+	tool, ok := availableClipboardTool()
+	if !ok {
+		return "", errNoClipboard
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(tool.Paste[0], tool.Paste[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w %s", tool.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// clipboardWaitDelay bounds how long a copy waits for the tool's pipes.
+// xclip, xsel and wl-copy fork a child that keeps serving the selection.
+const clipboardWaitDelay = 2 * time.Second
+
+// clipboardMsg reports a copy made by copyCmd
+type clipboardMsg struct {
+	what   string // What was copied, e.g. "message"
+	method string // The tool used, or "OSC 52"
+	seq    string // OSC 52 sequence still to be sent to the terminal
+}
+
+// copyCmd copies text to the clipboard in the background. Over SSH, or when
+// no tool works, the text is sent to the terminal as an OSC 52 sequence,
+// which most terminals put on the local clipboard.
+func copyCmd(text, what string) tea.Cmd {
+	return func() tea.Msg {
+		if !remoteSession() {
+			if name, ok := copyWithTool(text); ok {
+				return clipboardMsg{what: what, method: name}
+			}
+		}
+		return clipboardMsg{what: what, method: "OSC 52", seq: osc52Sequence(text)}
+	}
+}
+
+// copyWithTool copies text with the platform's clipboard tool and returns
+// its name, or false when no tool worked
+func copyWithTool(text string) (string, bool) {
+	tool, ok := availableClipboardTool()
+	if !ok {
+		return "", false
+	}
+	cmd := exec.Command(tool.Copy[0], tool.Copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.WaitDelay = clipboardWaitDelay
+	if err := cmd.Run(); err != nil {
+		logger.Warn("clipboard tool failed", "tool", tool.Name, "err", err)
+		return "", false
+	}
+	return tool.Name, true
+}
+
+// remoteSession reports whether aichat runs over SSH, where clipboard tools
+// would reach the remote machine's clipboard rather than the user's
+func remoteSession() bool {
+	return os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != ""
+}
+
+// osc52Sequence returns the escape sequence that asks the terminal to set
+// its clipboard, wrapped so that tmux and screen pass it on
+func osc52Sequence(text string) string {
+	seq := osc52.New(text)
+	if os.Getenv("TMUX") != "" {
+		seq = seq.Tmux()
+	} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		seq = seq.Screen()
+	}
+	return seq.String()
+}
+
+// codeBlocks returns the contents of the fenced code blocks in text
+func codeBlocks(text string) []string {
+	var blocks []string
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+			continue
+		}
+		var code []string
+		for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+			code = append(code, lines[i])
+		}
+		blocks = append(blocks, strings.Join(code, "\n"))
+	}
+	return blocks
+}
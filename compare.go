@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Number of models a prompt can be compared across
+const (
+	minCompareModels = 2
+	maxCompareModels = 4
+)
+
+// compareSeq numbers compare screens, so a late reply from one that was
+// closed is never shown in the next
+var compareSeq atomic.Int64
+
+// compareDeltaMsg carries a piece of a reply being streamed
+type compareDeltaMsg struct {
+	id   int64
+	pane int
+	text string
+}
+
+// compareDoneMsg reports that one model finished
+type compareDoneMsg struct {
+	id        int64
+	pane      int
+	reply     string
+	usage     TokenUsage
+	estimated bool // The usage was estimated because the API reported none
+	err       error
+}
+
+// compareResult is returned by the compare screen
+type compareResult struct {
+	Prompt    string
+	Models    []string
+	Replies   []string // Reply of each model; empty when it failed
+	Winner    int      // Pane whose reply continues the chat
+	SaveAll   bool     // Keep the other replies as alternatives
+	Cancelled bool
+}
+
+// comparePane is one model's reply and how it went
+type comparePane struct {
+	model      string
+	content    string
+	done       bool
+	err        error
+	first      time.Duration // Time to the first token
+	elapsed    time.Duration
+	usage      TokenUsage
+	estimated  bool
+	cost       float64
+	priced     bool     // Whether the cost is known
+	offset     int      // First line shown
+	follow     bool     // Keep the end of the reply in view
+	lines      []string // Finished reply rendered for linesWidth
+	linesWidth int
+}
+
+// CompareModel sends one prompt to several models at once and shows the
+// replies side by side as they stream in
+type CompareModel struct {
+	id       int64
+	chatName string
+	prompt   string
+	messages []Message // History ending with the prompt
+	opts     requestOptions
+	panes    []comparePane
+	selected int
+	start    time.Time
+	events   chan tea.Msg // Streamed pieces
+	results  chan tea.Msg // One compareDoneMsg per pane
+	stop     chan bool
+	stopped  bool
+	spinner  int
+	markdown *MarkdownRenderer
+	width    int
+	height   int
+}
+
+// newCompareModel prepares a comparison of models on prompt, sent after
+// the chat's messages
+func newCompareModel(chatName string, messages []Message, prompt string, models []string) CompareModel {
+	history := append(append([]Message{}, messages...), Message{Role: "user", Content: prompt})
+	m := CompareModel{
+		id:       compareSeq.Add(1),
+		chatName: chatName,
+		prompt:   prompt,
+		messages: history,
+		opts:     chatRequestOptions(chatName),
+		start:    time.Now(),
+		events:   make(chan tea.Msg, 64),
+		results:  make(chan tea.Msg, len(models)),
+		stop:     make(chan bool),
+		markdown: NewMarkdownRenderer(),
+		width:    80,
+		height:   24,
+	}
+	for _, model := range models {
+		m.panes = append(m.panes, comparePane{model: model, follow: true})
+	}
+	return m
+}
+
+func (m CompareModel) Init() tea.Cmd {
+	start := func() tea.Msg {
+		// Fitting may summarize, so models with the same context window
+		// share one fitted history and it is made before any pane starts
+		fitted := make(map[int][]Message)
+		for _, pane := range m.panes {
+			limit := modelContextLength(pane.model)
+			if _, ok := fitted[limit]; !ok {
+				fitted[limit], _ = prepareContext(m.chatName, m.messages, pane.model)
+			}
+		}
+		for i, pane := range m.panes {
+			go m.run(i, fitted[modelContextLength(pane.model)])
+		}
+		return m.next()
+	}
+	return tea.Batch(start, spinnerTick())
+}
+
+// run streams the reply of pane i to the fitted history
+func (m CompareModel) run(i int, fitted []Message) {
+	model := m.panes[i].model
+	reply, usage, err := streamChatGUI(fitted, model, m.opts, m.stop, func(text string) {
+		select {
+		case m.events <- compareDeltaMsg{id: m.id, pane: i, text: text}:
+		case <-m.stop:
+		}
+	})
+	done := compareDoneMsg{id: m.id, pane: i, reply: reply, err: err}
+	if usage != nil {
+		done.usage = *usage
+	} else {
+		done.estimated = true
+		done.usage.PromptTokens = estimateTokens(fitted)
+		// Four characters per token, as estimateTokens assumes
+		done.usage.CompletionTokens = (utf8.RuneCountInString(reply) + 3) / 4
+		done.usage.TotalTokens = done.usage.PromptTokens + done.usage.CompletionTokens
+	}
+	m.results <- done
+}
+
+// next waits for the next piece or finished reply
+func (m CompareModel) next() tea.Msg {
+	select {
+	case msg := <-m.events:
+		return msg
+	case msg := <-m.results:
+		return msg
+	}
+}
+
+// running reports whether any model is still replying
+func (m CompareModel) running() bool {
+	for _, pane := range m.panes {
+		if !pane.done {
+			return true
+		}
+	}
+	return false
+}
+
+func (m CompareModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case compareDeltaMsg:
+		if msg.id != m.id {
+			return m, nil
+		}
+		pane := &m.panes[msg.pane]
+		if !pane.done {
+			if pane.content == "" {
+				pane.first = time.Since(m.start)
+			}
+			pane.content += msg.text
+		}
+		return m, m.next
+	case compareDoneMsg:
+		if msg.id != m.id {
+			return m, nil
+		}
+		pane := &m.panes[msg.pane]
+		pane.done = true
+		pane.content, pane.err = msg.reply, msg.err
+		pane.usage, pane.estimated = msg.usage, msg.estimated
+		pane.cost, pane.priced = replyCost(pane.model, pane.usage)
+		pane.elapsed = time.Since(m.start)
+		m.renderPane(msg.pane)
+		if m.running() {
+			return m, m.next
+		}
+		return m, nil
+	case spinnerTickMsg:
+		if m.running() {
+			m.spinner++
+			return m, spinnerTick()
+		}
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		for i := range m.panes {
+			m.renderPane(i)
+		}
+	case tea.MouseMsg:
+		if msg.Action == tea.MouseActionPress {
+			switch msg.Button {
+			case tea.MouseButtonWheelUp:
+				m.scroll(-wheelLines)
+			case tea.MouseButtonWheelDown:
+				m.scroll(wheelLines)
+			}
+		}
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "ctrl+c":
+			m.halt()
+			return m, screenDone(m.result(compareResult{Cancelled: true}))
+		case "ctrl+s":
+			m.halt()
+		case "left", "h", "shift+tab":
+			m.selected = (m.selected + len(m.panes) - 1) % len(m.panes)
+		case "right", "l", "tab":
+			m.selected = (m.selected + 1) % len(m.panes)
+		case "up", "k":
+			m.scroll(-1)
+		case "down", "j":
+			m.scroll(1)
+		case "pgup":
+			m.scroll(-m.contentHeight())
+		case "pgdown":
+			m.scroll(m.contentHeight())
+		case "home", "g":
+			m.scroll(-1 << 30)
+		case "end", "G":
+			m.panes[m.selected].follow = true
+		case "enter", "s":
+			pane := m.panes[m.selected]
+			if !pane.done || pane.err != nil || pane.content == "" {
+				return m, nil
+			}
+			if msg.String() == "s" && m.running() {
+				return m, nil
+			}
+			m.halt()
+			return m, screenDone(m.result(compareResult{Winner: m.selected, SaveAll: msg.String() == "s"}))
+		}
+	}
+	return m, nil
+}
+
+// halt stops the models that are still replying
+func (m *CompareModel) halt() {
+	if !m.stopped {
+		m.stopped = true
+		close(m.stop)
+	}
+}
+
+// result fills in the prompt, models and replies
+func (m CompareModel) result(r compareResult) compareResult {
+	r.Prompt = m.prompt
+	for _, pane := range m.panes {
+		r.Models = append(r.Models, pane.model)
+		reply := ""
+		if pane.done && pane.err == nil {
+			reply = pane.content
+		}
+		r.Replies = append(r.Replies, reply)
+	}
+	return r
+}
+
+// wantsMouse turns on mouse reporting for scrolling
+func (m CompareModel) wantsMouse() bool {
+	return true
+}
+
+// paneWidth returns the columns inside each pane
+func (m CompareModel) paneWidth() int {
+	return max(10, m.width/len(m.panes)-4)
+}
+
+// contentHeight returns the rows of reply each pane shows
+func (m CompareModel) contentHeight() int {
+	// Header, status, blank line, pane borders, model name and two lines of statistics
+	return max(1, m.height-8)
+}
+
+// paneLines returns a pane's reply wrapped to the pane. Replies are shown
+// as plain text while they stream and as markdown once complete.
+func (m CompareModel) paneLines(pane comparePane) []string {
+	width := m.paneWidth()
+	if pane.done && pane.linesWidth == width {
+		return pane.lines
+	}
+	text := pane.content
+	if pane.done && pane.err == nil {
+		text = m.markdown.Render(text, width)
+	}
+	return strings.Split(ansi.Wrap(strings.ReplaceAll(text, "\t", "    "), width, ""), "\n")
+}
+
+// renderPane caches the lines of pane i once its reply is complete, so
+// frames and scrolling don't render the markdown again
+func (m *CompareModel) renderPane(i int) {
+	pane := &m.panes[i]
+	if !pane.done || pane.linesWidth == m.paneWidth() {
+		return
+	}
+	pane.lines = m.paneLines(*pane)
+	pane.linesWidth = m.paneWidth()
+}
+
+// scroll moves the selected pane delta lines
+func (m *CompareModel) scroll(delta int) {
+	pane := &m.panes[m.selected]
+	lines := len(m.paneLines(*pane))
+	last := max(0, lines-m.contentHeight())
+	if pane.follow {
+		pane.offset = last
+	}
+	pane.offset = max(0, min(last, pane.offset+delta))
+	pane.follow = pane.offset == last
+}
+
+// paneStats describes a pane's timing on one line and its tokens and cost
+// on the next; a "~" marks estimates
+func (m CompareModel) paneStats(pane comparePane) (string, string) {
+	if pane.err != nil {
+		return "Error:", pane.err.Error()
+	}
+	first := ""
+	if pane.content != "" {
+		first = fmt.Sprintf("first token %.1fs", pane.first.Seconds())
+	}
+	if !pane.done {
+		return getSpinnerChar(m.spinner) + " streaming", first
+	}
+	approx := ""
+	if pane.estimated {
+		approx = "~"
+	}
+	usage := fmt.Sprintf("%s%d tokens", approx, pane.usage.CompletionTokens)
+	if pane.priced {
+		usage += fmt.Sprintf(" · %s$%.4f", approx, pane.cost)
+	}
+	return fmt.Sprintf("%.1fs, %s", pane.elapsed.Seconds(), first), usage
+}
+
+func (m CompareModel) View() string {
+	theme := currentSettings().UI.Colors
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Title))
+	statusStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Muted))
+	modelStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Assistant))
+	errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Error))
+
+	prompt := strings.Join(strings.Fields(m.prompt), " ")
+	header := titleStyle.Render(ansi.Truncate("Compare: "+prompt, m.width, "…"))
+	help := "←/→ pane, ↑↓ scroll, Enter continue with this reply, Esc cancel"
+	if m.running() {
+		help += ", Ctrl+S stop"
+	} else {
+		help += ", s save all as alternatives"
+	}
+	status := statusStyle.Render(ansi.Truncate(help, m.width, "…"))
+
+	height := m.contentHeight()
+	var panes []string
+	for i, pane := range m.panes {
+		lines := m.paneLines(pane)
+		last := max(0, len(lines)-height)
+		offset := min(pane.offset, last)
+		if pane.follow {
+			offset = last
+		}
+		shown := lines[offset:min(offset+height, len(lines))]
+		for len(shown) < height {
+			shown = append(shown, "")
+		}
+
+		name := modelStyle.Render(ansi.Truncate(pane.model, m.paneWidth(), "…"))
+		timing, usage := m.paneStats(pane)
+		statsStyle := statusStyle
+		if pane.err != nil {
+			statsStyle = errorStyle
+		}
+		stats := statsStyle.Render(ansi.Truncate(timing, m.paneWidth(), "…")) + "\n" +
+			statsStyle.Render(ansi.Truncate(usage, m.paneWidth(), "…"))
+		border := lipgloss.Color(theme.Border)
+		if i == m.selected {
+			border = lipgloss.Color(theme.Accent)
+		}
+		box := lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(border).
+			Padding(0, 1).
+			Width(m.paneWidth() + 2)
+		panes = append(panes, box.Render(name+"\n"+strings.Join(shown, "\n")+"\n"+stats))
+	}
+
+	layout := header + "\n" + status + "\n\n" + lipgloss.JoinHorizontal(lipgloss.Top, panes...)
+	return lipgloss.NewStyle().Width(m.width).Height(m.height).Render(layout)
+}
+
+// replyCost returns what a reply cost, as reported by the API or worked
+// out from the prices configured for the model
+func replyCost(model string, usage TokenUsage) (float64, bool) {
+	if usage.Cost > 0 {
+		return usage.Cost, true
+	}
+	config, err := loadModelsConfig()
+	if err != nil {
+		return 0, false
+	}
+	for _, m := range config.Models {
+		if m.Name == model && (m.PromptPrice > 0 || m.CompletionPrice > 0) {
+			cost := float64(usage.PromptTokens)*m.PromptPrice + float64(usage.CompletionTokens)*m.CompletionPrice
+			return cost / 1e6, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Context strategies applied when a chat outgrows the model's context window
+const (
+	contextSliding   = "sliding"   // Drop the oldest messages
+	contextPinned    = "pinned"    // Drop the oldest messages except pinned ones
+	contextSummarize = "summarize" // Replace older turns with an LLM summary
+)
+
+// defaultContextLength is assumed for models without a configured window
+const defaultContextLength = 8192
+
+// ContextSettings configures automatic context window management
+type ContextSettings struct {
+	Strategy      string `json:"strategy"`
+	ReserveTokens int    `json:"reserve_tokens"` // Room left for the reply
+	KeepRecent    int    `json:"keep_recent"`    // Messages summarize never folds away
+}
+
+// contextUsage describes how much of the context window a request uses
+type contextUsage struct {
+	Tokens  int // Estimated prompt tokens for the full history
+	Limit   int // Context window of the model
+	Dropped int // Messages left out of the request
+	Note    string
+}
+
+// defaultContextSettings returns the settings used when none are configured
+func defaultContextSettings() ContextSettings {
+	return ContextSettings{
+		Strategy:      contextSliding,
+		ReserveTokens: 2048,
+		KeepRecent:    6,
+	}
+}
+
+// loadContextSettings returns the context settings from the settings file
+func loadContextSettings() ContextSettings {
+	return currentSettings().Context
+}
+
+// isContextStrategy reports whether s names a known strategy
+func isContextStrategy(s string) bool {
+	return s == contextSliding || s == contextPinned || s == contextSummarize
+}
+
+// modelContextLength returns the context window configured for a model
+func modelContextLength(model string) int {
+	config, err := loadModelsConfig()
+	if err == nil {
+		for _, m := range config.Models {
+			if m.Name == model && m.ContextLength > 0 {
+				return m.ContextLength
+			}
+		}
+	}
+	return defaultContextLength
+}
+
+// estimateTokens roughly estimates the prompt tokens of messages using
+// four characters per token plus a small per-message overhead
+func estimateTokens(messages []Message) int {
+	tokens := 3
+	for _, msg := range messages {
+		tokens += 4 + (utf8.RuneCountInString(msg.Content)+3)/4
+	}
+	return tokens
+}
+
+// contextGauge renders a small usage bar such as "[████░░░░] 48%"
+func contextGauge(tokens, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	const width = 10
+	percent := tokens * 100 / limit
+	filled := min(width, tokens*width/limit)
+	return fmt.Sprintf("[%s%s] %d%%", strings.Repeat("█", filled), strings.Repeat("░", width-filled), percent)
+}
+
+// prepareContext trims messages so the request fits the model's context
+// window. chatID is used to look up pinned messages and to cache summaries.
+func prepareContext(chatID string, messages []Message, model string) ([]Message, contextUsage) {
+	settings := loadContextSettings()
+	var pinned []bool
+	var path []MessageNode
+	var meta ChatMetadata
+	if chatFile, err := loadChatWithMetadata(chatID); err == nil {
+		meta = chatFile.Metadata
+		path = activePath(chatFile)
+		if isContextStrategy(meta.ContextStrategy) {
+			settings.Strategy = meta.ContextStrategy
+		}
+	}
+	pinned = make([]bool, len(messages))
+	for i := range messages {
+		if i < len(path) && path[i].Message == messages[i] {
+			pinned[i] = path[i].Pinned
+		}
+	}
+
+	usage := contextUsage{Tokens: estimateTokens(messages), Limit: modelContextLength(model)}
+	budget := usage.Limit - settings.ReserveTokens
+	if budget <= 0 {
+		budget = usage.Limit / 2
+	}
+	if usage.Tokens <= budget {
+		return messages, usage
+	}
+
+	if settings.Strategy == contextSummarize {
+		fitted, note, err := summarizeContext(chatID, messages, pinned, path, meta, model, settings, budget)
+		if err == nil {
+			fitted = slideContext(fitted, make([]bool, len(fitted)), budget)
+			usage.Dropped = len(messages) - len(fitted)
+			usage.Note = note
+			return fitted, usage
+		}
+		logger.Warn("summarizing older messages failed", "chat", chatID, "err", err)
+	}
+
+	keepPinned := settings.Strategy != contextSliding
+	if !keepPinned {
+		pinned = make([]bool, len(messages))
+	}
+	fitted := slideContext(messages, pinned, budget)
+	usage.Dropped = len(messages) - len(fitted)
+	usage.Note = fmt.Sprintf("%d older messages left out of context", usage.Dropped)
+	return fitted, usage
+}
+
+// slideContext keeps leading system messages, pinned messages and as many
+// of the most recent messages as fit within budget
+func slideContext(messages []Message, pinned []bool, budget int) []Message {
+	if estimateTokens(messages) <= budget {
+		return messages
+	}
+	keep := make([]bool, len(messages))
+	used := 3
+	head := 0
+	for head < len(messages) && messages[head].Role == "system" {
+		keep[head] = true
+		used += estimateTokens(messages[head:head+1]) - 3
+		head++
+	}
+	for i := head; i < len(messages); i++ {
+		if pinned[i] {
+			keep[i] = true
+			used += estimateTokens(messages[i:i+1]) - 3
+		}
+	}
+	// Always send the newest message, then fill backwards
+	for i := len(messages) - 1; i >= head; i-- {
+		if keep[i] {
+			continue
+		}
+		cost := estimateTokens(messages[i:i+1]) - 3
+		if used+cost > budget && i != len(messages)-1 {
+			break
+		}
+		keep[i] = true
+		used += cost
+	}
+
+	var fitted []Message
+	for i, msg := range messages {
+		if keep[i] {
+			fitted = append(fitted, msg)
+		}
+	}
+	return fitted
+}
+
+// summarizeContext folds the older middle of a conversation into a
+// synthetic system note, reusing the cached summary when it still applies
+func summarizeContext(chatID string, messages []Message, pinned []bool, path []MessageNode, meta ChatMetadata, model string, settings ContextSettings, budget int) ([]Message, string, error) {
+	head := 0
+	for head < len(messages) && messages[head].Role == "system" {
+		head++
+	}
+	tailStart := max(head, len(messages)-settings.KeepRecent)
+	if tailStart <= head {
+		return nil, "", fmt.Errorf("nothing old enough to summarize")
+	}
+
+	build := func(summary string, upTo int) []Message {
+		fitted := append([]Message{}, messages[:head]...)
+		fitted = append(fitted, Message{Role: "system", Content: "Summary of the earlier conversation:\n" + summary})
+		for i := head; i <= upTo; i++ {
+			if pinned[i] {
+				fitted = append(fitted, messages[i])
+			}
+		}
+		return append(fitted, messages[upTo+1:]...)
+	}
+
+	// Reuse the cached summary if it covers a prefix of this path and is enough
+	if meta.ContextSummary != "" {
+		for i := head; i < tailStart && i < len(path); i++ {
+			if path[i].Message != messages[i] {
+				break
+			}
+			if path[i].ID == meta.ContextSummaryUpTo {
+				if fitted := build(meta.ContextSummary, i); estimateTokens(fitted) <= budget {
+					return fitted, "older messages replaced by a cached summary", nil
+				}
+				break
+			}
+		}
+	}
+
+	upTo := tailStart - 1
+	var b strings.Builder
+	if meta.ContextSummary != "" {
+		b.WriteString("Earlier summary: " + meta.ContextSummary + "\n\n")
+	}
+	for i := head; i <= upTo; i++ {
+		fmt.Fprintf(&b, "%s: %s\n", roleHeading(messages[i].Role), messages[i].Content)
+	}
+	// Keep the summary request itself within the window
+	transcript := b.String()
+	if maxChars := budget * 3; len(transcript) > maxChars {
+		// Start on a rune boundary so the request stays valid UTF-8
+		start := len(transcript) - maxChars
+		for start < len(transcript) && !utf8.RuneStart(transcript[start]) {
+			start++
+		}
+		transcript = transcript[start:]
+	}
+
+	summary, err := completeChat([]Message{
+		{Role: "system", Content: "You condense conversations so they can be continued later."},
+		{Role: "user", Content: "Summarize the following conversation, keeping facts, decisions, code identifiers and open questions that later messages may depend on:\n\n" + transcript},
+	}, model, meta.APIKey)
+	if err != nil {
+		return nil, "", err
+	}
+	summary = strings.TrimSpace(summary)
+
+	if upTo < len(path) && path[upTo].Message == messages[upTo] {
+		upToID := path[upTo].ID
+		if err := updateChatMetadata(chatID, func(m *ChatMetadata) {
+			m.ContextSummary = summary
+			m.ContextSummaryUpTo = upToID
+		}); err != nil {
+			logger.Warn("saving the context summary failed", "chat", chatID, "err", err)
+		}
+	}
+	return build(summary, upTo), fmt.Sprintf("%d older messages summarized", upTo-head+1), nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables and flags that supply an API key without storing it
+const (
+	apiKeyEnv         = "AICHAT_API_KEY"
+	openRouterKeyEnv  = "OPENROUTER_API_KEY" // Read by OpenRouter's own tools
+	apiKeyFileFlag    = "--api-key-file"
+	keyCommandTimeout = 30 * time.Second
+)
+
+// apiKeyFile is the file given with --api-key-file; "-" reads standard input
+var apiKeyFile string
+
+// keySourceCache remembers keys from sources that are slow or can only be
+// read once, such as standard input or a password manager
+var keySourceCache struct {
+	mu  sync.Mutex
+	key string
+	id  string
+}
+
+// keyEnvVars lists the variables checked for a key, most specific first
+func keyEnvVars() []string {
+	return []string{apiKeyEnv, openRouterKeyEnv}
+}
+
+// resolveAPIKey returns the key for the next request and where it came from.
+// Sources are tried in order: --api-key-file, the stored key titled
+// chatKey (chosen by the chat's profile), AICHAT_API_KEY, the provider's own
+// variable (OPENROUTER_API_KEY), the api_key_command setting, and
+// finally the stored active key.
+func resolveAPIKey(chatKey string) (string, string, error) {
+	if apiKeyFile != "" {
+		return cachedKey(apiKeyFileFlag+" "+apiKeyFile, apiKeyFile, readKeyFile)
+	}
+	if chatKey != "" {
+		key, err := storedAPIKey(chatKey)
+		if err != nil {
+			return "", "", &AppError{
+				Op:      "get API key",
+				Err:     err,
+				Message: "The API key chosen for this chat no longer exists; switch it with :profile",
+			}
+		}
+		return key.Key, "stored key " + chatKey, nil
+	}
+	for _, env := range keyEnvVars() {
+		if key := strings.TrimSpace(os.Getenv(env)); key != "" {
+			return key, env, nil
+		}
+	}
+	if command := currentSettings().APIKeyCommand; command != "" {
+		return cachedKey("api_key_command", command, func() (string, error) {
+			return runKeyCommand(command)
+		})
+	}
+	key, err := readAPIKey()
+	if err != nil {
+		return "", "", &AppError{
+			Op:      "get API key",
+			Err:     err,
+			Message: fmt.Sprintf("No API key found. Add one in the API Key menu, set %s, pass %s, or set api_key_command in settings.json", strings.Join(keyEnvVars(), " or "), apiKeyFileFlag),
+		}
+	}
+	return key, "stored key", nil
+}
+
+// requestAPIKey returns the key to authorize a request with; chatKey is the
+// title of the stored key the chat uses, or "" for none
+func requestAPIKey(chatKey string) (string, error) {
+	key, _, err := resolveAPIKey(chatKey)
+	return key, err
+}
+
+// storedAPIKey returns the stored key with the given title
+func storedAPIKey(title string) (APIKey, error) {
+	keys, _, err := listAPIKeys()
+	if err != nil {
+		return APIKey{}, err
+	}
+	for _, key := range keys {
+		if key.Title == title {
+			return key, nil
+		}
+	}
+	return APIKey{}, fmt.Errorf("no stored API key titled '%s'", title)
+}
+
+// cachedKey reads a key once per source and keeps it for the session. id
+// identifies the file or command so that changing it reads the key again.
+func cachedKey(source, id string, read func() (string, error)) (string, string, error) {
+	keySourceCache.mu.Lock()
+	defer keySourceCache.mu.Unlock()
+	if keySourceCache.id == source+"\x00"+id && keySourceCache.key != "" {
+		return keySourceCache.key, source, nil
+	}
+	key, err := read()
+	if err != nil {
+		return "", "", &AppError{Op: "read API key", Err: err, Message: "failed to read API key from " + source}
+	}
+	if key == "" {
+		return "", "", &AppError{Op: "read API key", Err: fmt.Errorf("empty key"), Message: source + " did not provide an API key"}
+	}
+	keySourceCache.key = key
+	keySourceCache.id = source + "\x00" + id
+	return key, source, nil
+}
+
+// readKeyFile reads the key from --api-key-file
+func readKeyFile() (string, error) {
+	if apiKeyFile == "-" {
+		// readStdinKey caches it at startup; standard input cannot be read twice
+		return "", fmt.Errorf("standard input was already read")
+	}
+	data, err := os.ReadFile(apiKeyFile)
+	if err != nil {
+		return "", err
+	}
+	return firstLine(string(data)), nil
+}
+
+// readStdinKey reads the key for "--api-key-file -" and caches it. It runs
+// at startup, before any prompt reads standard input, so a piped key is never
+// taken as an answer.
+func readStdinKey() error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read API key from standard input: %w", err)
+	}
+	key := firstLine(string(data))
+	if key == "" {
+		return fmt.Errorf("no API key on standard input")
+	}
+	keySourceCache.mu.Lock()
+	defer keySourceCache.mu.Unlock()
+	keySourceCache.key = key
+	keySourceCache.id = apiKeyFileFlag + " " + apiKeyFile + "\x00" + apiKeyFile
+	return nil
+}
+
+// runKeyCommand runs a command such as "pass show openrouter" and returns
+// the first line it prints
+func runKeyCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyCommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return firstLine(string(out)), nil
+}
+
+// firstLine returns the first line of s without surrounding space, the way
+// password managers print the secret first
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimLeft(s, "\r\n"), "\n")
+	return strings.TrimSpace(line)
+}
+
+// apiKeyConfigured reports whether any key source is set up, without
+// running commands or reading standard input
+func apiKeyConfigured() bool {
+	if apiKeyFile != "" || currentSettings().APIKeyCommand != "" {
+		return true
+	}
+	for _, env := range keyEnvVars() {
+		if strings.TrimSpace(os.Getenv(env)) != "" {
+			return true
+		}
+	}
+	if keys, _, err := listAPIKeys(); err == nil && len(keys) > 0 {
+		return true
+	}
+	for _, path := range []string{getAPIKeyPath(), ".api_key"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyOverride describes a source that takes precedence over the stored
+// keys, or "" when the stored active key is used
+func apiKeyOverride() string {
+	if apiKeyFile != "" {
+		return apiKeyFileFlag + " " + apiKeyFile
+	}
+	for _, env := range keyEnvVars() {
+		if strings.TrimSpace(os.Getenv(env)) != "" {
+			return env
+		}
+	}
+	if currentSettings().APIKeyCommand != "" {
+		return "api_key_command"
+	}
+	return ""
+}
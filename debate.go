@@ -0,0 +1,477 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Debate modes
+const (
+	debateConverse = "converse" // The speakers discuss the topic in turns
+	debateCritique = "critique" // One drafts, the other critiques, the first revises
+)
+
+// maxDebateRounds limits how long a debate can run
+const maxDebateRounds = 10
+
+// debateSeq numbers debate screens, so replies from one that was closed
+// are never shown in the next
+var debateSeq atomic.Int64
+
+// debateSpeaker is a model and the prompt it speaks with
+type debateSpeaker struct {
+	Model  string
+	Prompt Prompt
+}
+
+// DebateConfig describes a debate between two models
+type DebateConfig struct {
+	Mode     string
+	Topic    string
+	Rounds   int
+	Speakers [2]debateSpeaker
+}
+
+// turnCount returns how many turns the speakers take. A critique starts
+// with the draft; every round is a critique and a revision.
+func (c DebateConfig) turnCount() int {
+	if c.Mode == debateCritique {
+		return 1 + 2*c.Rounds
+	}
+	return 2 * c.Rounds
+}
+
+// speakerLabel names the speaker of turn i, e.g. "A · openai/gpt-4o (Critic)"
+func (c DebateConfig) speakerLabel(i int) string {
+	s := c.Speakers[i%2]
+	return fmt.Sprintf("%c · %s (%s)", 'A'+rune(i%2), s.Model, s.Prompt.Name)
+}
+
+// turnMessages builds the request for turn i, given the earlier turns. The
+// speaker sees its own turns as its replies and the other's as messages to it.
+func (c DebateConfig) turnMessages(turns []string, i int) []Message {
+	speaker := i % 2
+	other := c.Speakers[1-speaker].Model
+	var role, opening string
+	switch {
+	case c.Mode == debateCritique && speaker == 0:
+		role = fmt.Sprintf("You write on the task below, and revise your text when a reviewer (%s) critiques it. Always reply with the complete text only.", other)
+		opening = "Write the first draft."
+	case c.Mode == debateCritique:
+		role = fmt.Sprintf("You review drafts that another AI (%s) writes on the task below. Point out errors, gaps and concrete improvements concisely; do not rewrite the draft yourself.", other)
+	default:
+		role = fmt.Sprintf("You are discussing the topic below with another AI (%s). Answer its latest points in a few paragraphs and argue for your own view rather than simply agreeing.", other)
+		opening = "Open the discussion with your position."
+	}
+	system := strings.TrimSpace(c.Speakers[speaker].Prompt.Content+"\n\n"+role) + "\n\nTopic: " + c.Topic
+	messages := []Message{{Role: "system", Content: system}}
+	if speaker == 0 {
+		messages = append(messages, Message{Role: "user", Content: opening})
+	}
+	for j := 0; j < i; j++ {
+		role := "user"
+		if j%2 == speaker {
+			role = "assistant"
+		}
+		messages = append(messages, Message{Role: role, Content: turns[j]})
+	}
+	return messages
+}
+
+// synthesisMessages asks for the final synthesis of the turns so far
+func (c DebateConfig) synthesisMessages(turns []string) []Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Topic: %s\n\n", c.Topic)
+	for i, turn := range turns {
+		fmt.Fprintf(&b, "%s:\n%s\n\n", c.speakerLabel(i), turn)
+	}
+	task := "Write a balanced synthesis of this discussion: where the speakers agree, where they disagree, and the conclusion the strongest arguments support."
+	if c.Mode == debateCritique {
+		task = "Write the final version of the text, keeping the criticism that holds up, followed by a short note on what changed and why."
+	}
+	return []Message{
+		{Role: "system", Content: "You conclude discussions between two AI models."},
+		{Role: "user", Content: b.String() + task},
+	}
+}
+
+// debateMessages turns a debate into the messages of a chat, labeling
+// every turn with its speaker
+func (c DebateConfig) debateMessages(turns []string, synthesis string) []Message {
+	modeName := "Discussion"
+	if c.Mode == debateCritique {
+		modeName = "Draft and critique"
+	}
+	setup := fmt.Sprintf("%s between A: %s with prompt %s, and B: %s with prompt %s.",
+		modeName, c.Speakers[0].Model, c.Speakers[0].Prompt.Name, c.Speakers[1].Model, c.Speakers[1].Prompt.Name)
+	messages := []Message{{Role: "system", Content: setup}, {Role: "user", Content: c.Topic}}
+	for i, turn := range turns {
+		messages = append(messages, Message{Role: "assistant", Content: "**" + c.speakerLabel(i) + "**\n\n" + turn})
+	}
+	if synthesis != "" {
+		messages = append(messages, Message{Role: "assistant", Content: "**Synthesis · " + c.Speakers[0].Model + "**\n\n" + synthesis})
+	}
+	return messages
+}
+
+// saveDebate stores a debate as a chat tagged "debate" and returns its ID
+func saveDebate(c DebateConfig, turns []string, synthesis string) (string, error) {
+	title := ansi.Truncate("Debate: "+strings.Join(strings.Fields(c.Topic), " "), 60, "…")
+	chatFile := ChatFile{Messages: c.debateMessages(turns, synthesis)}
+	chatFile.Metadata.Title = title
+	chatFile.Metadata.Model = c.Speakers[0].Model
+	chatFile.Metadata.Tags = normalizeTags([]string{"debate"})
+	chatFile.Metadata.CreatedAt = time.Now()
+	chatName := newChatID()
+	if err := saveChatFile(chatName, &chatFile); err != nil {
+		return "", err
+	}
+	return chatName, nil
+}
+
+// debateDeltaMsg carries a piece of the turn being streamed
+type debateDeltaMsg struct {
+	id   int64
+	step int
+	text string
+}
+
+// debateReplyMsg reports that a turn or the synthesis is complete
+type debateReplyMsg struct {
+	id    int64
+	step  int
+	reply string
+	err   error
+}
+
+// debateResult is returned by the debate screen
+type debateResult struct {
+	ChatName string // Chat the debate was saved as; empty if nothing was said
+	Open     bool   // Open the chat next
+}
+
+// DebateModel runs a debate and shows its transcript as it is written
+type DebateModel struct {
+	id            int64
+	cfg           DebateConfig
+	turns         []string
+	current       string // Turn or synthesis being streamed
+	synthesis     string
+	synthesizing  bool
+	finished      bool
+	chatName      string
+	step          int // Numbers requests, so pieces of a stopped one are dropped
+	events        chan tea.Msg
+	results       chan tea.Msg
+	stop          chan bool
+	stopped       bool
+	status        string
+	spinner       int
+	scrollLine    int
+	autoScroll    bool
+	markdown      *MarkdownRenderer
+	rendered      []string // Finished turns and synthesis rendered for renderedWidth
+	renderedWidth int
+	width         int
+	height        int
+}
+
+// newDebateModel prepares a debate
+func newDebateModel(cfg DebateConfig) DebateModel {
+	return DebateModel{
+		id:         debateSeq.Add(1),
+		cfg:        cfg,
+		events:     make(chan tea.Msg, 64),
+		results:    make(chan tea.Msg, 2),
+		stop:       make(chan bool),
+		status:     "Debating...",
+		autoScroll: true,
+		markdown:   NewMarkdownRenderer(),
+		width:      80,
+		height:     24,
+	}
+}
+
+func (m DebateModel) Init() tea.Cmd {
+	return tea.Batch(m.request(m.cfg.turnMessages(nil, 0), m.cfg.Speakers[0].Model), spinnerTick())
+}
+
+// request streams a reply from model in the background
+func (m DebateModel) request(messages []Message, model string) tea.Cmd {
+	id, step, stop := m.id, m.step, m.stop
+	return func() tea.Msg {
+		go func() {
+			fitted, _ := prepareContext("", messages, model)
+			reply, _, err := streamChatGUI(fitted, model, requestOptions{}, stop, func(text string) {
+				select {
+				case m.events <- debateDeltaMsg{id: id, step: step, text: text}:
+				case <-stop:
+				}
+			})
+			m.results <- debateReplyMsg{id: id, step: step, reply: reply, err: err}
+		}()
+		return m.next()
+	}
+}
+
+// next waits for the next piece or finished reply
+func (m DebateModel) next() tea.Msg {
+	select {
+	case msg := <-m.events:
+		return msg
+	case msg := <-m.results:
+		return msg
+	}
+}
+
+func (m DebateModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case debateDeltaMsg:
+		if msg.id != m.id || m.finished {
+			return m, nil
+		}
+		if msg.step == m.step {
+			m.current += msg.text
+		}
+		return m, m.next
+	case debateReplyMsg:
+		if msg.id != m.id || m.finished {
+			return m, nil
+		}
+		if msg.step != m.step {
+			return m, m.next
+		}
+		return m.replied(msg)
+	case spinnerTickMsg:
+		if !m.finished {
+			m.spinner++
+			return m, spinnerTick()
+		}
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.renderFinished()
+	case tea.MouseMsg:
+		if msg.Action == tea.MouseActionPress {
+			switch msg.Button {
+			case tea.MouseButtonWheelUp:
+				m.scrollBy(-wheelLines)
+			case tea.MouseButtonWheelDown:
+				m.scrollBy(wheelLines)
+			}
+		}
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+s":
+			if !m.finished && !m.stopped {
+				m.stopped = true
+				close(m.stop)
+				m.status = "Stopping..."
+			}
+		case "esc", "ctrl+c":
+			if !m.finished {
+				if !m.stopped {
+					close(m.stop)
+				}
+				m.finish()
+			}
+			return m, screenDone(debateResult{ChatName: m.chatName})
+		case "enter":
+			if m.finished {
+				return m, screenDone(debateResult{ChatName: m.chatName, Open: m.chatName != ""})
+			}
+		case "up", "k":
+			m.scrollBy(-1)
+		case "down", "j":
+			m.scrollBy(1)
+		case "pgup":
+			m.scrollBy(-m.boxHeight())
+		case "pgdown":
+			m.scrollBy(m.boxHeight())
+		case "home", "g":
+			m.scrollBy(math.MinInt / 2)
+		case "end", "G":
+			m.autoScroll = true
+		}
+	}
+	return m, nil
+}
+
+// replied records a finished turn or synthesis and starts what comes next
+func (m DebateModel) replied(msg debateReplyMsg) (tea.Model, tea.Cmd) {
+	m.current = ""
+	if m.synthesizing {
+		if msg.err == nil {
+			m.synthesis = msg.reply
+			m.renderFinished()
+		} else if !m.stopped {
+			m.status = fmt.Sprintf("Synthesis failed: %v", msg.err)
+		}
+		m.finish()
+		return m, nil
+	}
+	if msg.err != nil && !m.stopped {
+		m.status = fmt.Sprintf("Error: %v", msg.err)
+		m.finish()
+		return m, nil
+	}
+	if msg.err == nil {
+		m.turns = append(m.turns, msg.reply)
+		m.renderFinished()
+	}
+	m.step++
+	if len(m.turns) < m.cfg.turnCount() && !m.stopped {
+		i := len(m.turns)
+		return m, m.request(m.cfg.turnMessages(m.turns, i), m.cfg.Speakers[i%2].Model)
+	}
+	if len(m.turns) == 0 {
+		m.finish()
+		return m, nil
+	}
+	// The synthesis runs even after a stop, on what was said
+	m.synthesizing = true
+	m.stopped = false
+	m.stop = make(chan bool)
+	m.status = "Writing the synthesis..."
+	return m, m.request(m.cfg.synthesisMessages(m.turns), m.cfg.Speakers[0].Model)
+}
+
+// finish saves the debate as a chat
+func (m *DebateModel) finish() {
+	m.finished = true
+	if len(m.turns) == 0 {
+		if !strings.HasPrefix(m.status, "Error") {
+			m.status = "Nothing was said"
+		}
+		return
+	}
+	chatName, err := saveDebate(m.cfg, m.turns, m.synthesis)
+	if err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	m.chatName = chatName
+	note := ""
+	if strings.HasPrefix(m.status, "Error") || strings.HasPrefix(m.status, "Synthesis failed") {
+		note = m.status + ". "
+	}
+	m.status = note + "Saved as a chat; Enter opens it, Esc goes back"
+}
+
+// boxHeight returns the rows of transcript shown
+func (m DebateModel) boxHeight() int {
+	// Header, status, blank line and the box borders
+	return max(1, m.height-5)
+}
+
+// transcriptWidth returns the columns inside the transcript box
+func (m DebateModel) transcriptWidth() int {
+	return max(1, m.width-4)
+}
+
+// debateLabelStyles returns the styles of the two speakers' labels and of
+// the synthesis title
+func debateLabelStyles() ([2]lipgloss.Style, lipgloss.Style) {
+	theme := currentSettings().UI.Colors
+	speakerStyles := [2]lipgloss.Style{
+		lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Accent)).Bold(true),
+		lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Assistant)).Bold(true),
+	}
+	titleStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Title)).Bold(true)
+	return speakerStyles, titleStyle
+}
+
+// renderFinished renders the finished turns and the synthesis that are not
+// in rendered yet, so frames don't render their markdown again
+func (m *DebateModel) renderFinished() {
+	width := m.transcriptWidth()
+	if m.renderedWidth != width {
+		m.rendered, m.renderedWidth = nil, width
+	}
+	speakerStyles, titleStyle := debateLabelStyles()
+	for i := len(m.rendered); i < len(m.turns); i++ {
+		m.rendered = append(m.rendered, speakerStyles[i%2].Render(m.cfg.speakerLabel(i))+"\n"+m.markdown.Render(m.turns[i], width))
+	}
+	if m.synthesis != "" && len(m.rendered) == len(m.turns) {
+		m.rendered = append(m.rendered, titleStyle.Render("Synthesis · "+m.cfg.Speakers[0].Model)+"\n"+m.markdown.Render(m.synthesis, width))
+	}
+}
+
+// transcript renders the turns, the one being written and the synthesis
+func (m DebateModel) transcript() []string {
+	m.renderFinished() // A no-op once Update has rendered the finished blocks
+	speakerStyles, titleStyle := debateLabelStyles()
+	blocks := slices.Clone(m.rendered[:len(m.turns)])
+	if !m.finished {
+		label := titleStyle.Render("Synthesis · " + m.cfg.Speakers[0].Model)
+		if !m.synthesizing {
+			i := len(m.turns)
+			label = speakerStyles[i%2].Render(m.cfg.speakerLabel(i))
+		}
+		blocks = append(blocks, label+"\n"+m.current+getSpinnerChar(m.spinner))
+	}
+	blocks = append(blocks, m.rendered[len(m.turns):]...)
+	return strings.Split(ansi.Wrap(strings.Join(blocks, "\n\n"), m.transcriptWidth(), ""), "\n")
+}
+
+// scrollBy moves the transcript delta lines; reaching the end follows it again
+func (m *DebateModel) scrollBy(delta int) {
+	lines := len(m.transcript())
+	last := max(0, lines-m.boxHeight())
+	if m.autoScroll {
+		m.scrollLine = last
+	}
+	m.scrollLine = max(0, min(last, m.scrollLine+delta))
+	m.autoScroll = m.scrollLine == last
+}
+
+func (m DebateModel) View() string {
+	theme := currentSettings().UI.Colors
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Title))
+	statusStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Muted))
+	boxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(theme.Border)).
+		Padding(0, 1)
+
+	rounds := fmt.Sprintf("turn %d/%d", min(len(m.turns)+1, m.cfg.turnCount()), m.cfg.turnCount())
+	if m.synthesizing || m.finished {
+		rounds = fmt.Sprintf("%d turns", len(m.turns))
+		if len(m.turns) == 1 {
+			rounds = "1 turn"
+		}
+	}
+	topic := strings.Join(strings.Fields(m.cfg.Topic), " ")
+	header := titleStyle.Render(ansi.Truncate(fmt.Sprintf("Debate (%s): %s", rounds, topic), m.width, "…"))
+
+	statusText := m.status
+	if !m.finished {
+		statusText += " | Ctrl+S stop and synthesize, Esc stop and leave, ↑↓ scroll"
+	}
+	status := statusStyle.Render(ansi.Truncate(statusText, m.width, "…"))
+
+	lines := m.transcript()
+	height := m.boxHeight()
+	last := max(0, len(lines)-height)
+	offset := min(m.scrollLine, last)
+	if m.autoScroll {
+		offset = last
+	}
+	shown := lines[offset:min(offset+height, len(lines))]
+	box := boxStyle.Width(m.width - 2).Height(height).Render(strings.Join(shown, "\n"))
+
+	layout := header + "\n" + status + "\n\n" + box
+	return lipgloss.NewStyle().Width(m.width).Height(m.height).Render(layout)
+}
+
+// wantsMouse turns on mouse reporting for scrolling
+func (m DebateModel) wantsMouse() bool {
+	return true
+}
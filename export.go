@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Export formats
+const (
+	exportMarkdown = "md"
+	exportHTML     = "html"
+	exportJSONL    = "jsonl"
+)
+
+// reasoningPattern matches the reasoning blocks emitted by thinking models
+var reasoningPattern = regexp.MustCompile(`(?s)<think(?:ing)?>(.*?)</think(?:ing)?>`)
+
+// ExportOptions selects the format and content of a chat export
+type ExportOptions struct {
+	Format           string
+	IncludeSystem    bool // System prompts
+	IncludeReasoning bool // <think> blocks of reasoning models
+	IncludeMetadata  bool // Title, model, dates, tags and summary
+}
+
+// defaultExportOptions returns the options used when none are given
+func defaultExportOptions(format string) ExportOptions {
+	return ExportOptions{
+		Format: format,
+		// Fine-tuning style JSONL is usually consumed by tools, not people
+		IncludeMetadata: format != exportJSONL,
+	}
+}
+
+// isExportFormat reports whether format names a known export format
+func isExportFormat(format string) bool {
+	return format == exportMarkdown || format == exportHTML || format == exportJSONL
+}
+
+// splitReasoning separates reasoning blocks from the rest of a message
+func splitReasoning(content string) (reasoning, answer string) {
+	var parts []string
+	for _, match := range reasoningPattern.FindAllStringSubmatch(content, -1) {
+		parts = append(parts, strings.TrimSpace(match[1]))
+	}
+	answer = strings.TrimSpace(reasoningPattern.ReplaceAllString(content, ""))
+	return strings.Join(parts, "\n\n"), answer
+}
+
+// exportMessages returns the active-path messages selected by opts, with
+// reasoning either split out or dropped
+func exportMessages(chatFile *ChatFile, opts ExportOptions) []exportedMessage {
+	var messages []exportedMessage
+	for _, msg := range chatFile.Messages {
+		if msg.Role == "system" && !opts.IncludeSystem {
+			continue
+		}
+		reasoning, answer := splitReasoning(msg.Content)
+		if !opts.IncludeReasoning {
+			reasoning = ""
+		}
+		messages = append(messages, exportedMessage{Role: msg.Role, Content: answer, Reasoning: reasoning})
+	}
+	return messages
+}
+
+// exportedMessage is a message prepared for export
+type exportedMessage struct {
+	Role      string
+	Content   string
+	Reasoning string
+}
+
+// roleHeading returns the heading used for a role in documents
+func roleHeading(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	default:
+		// Capitalise the first rune of roles from imported chats
+		if role == "" {
+			return ""
+		}
+		r, size := utf8.DecodeRuneInString(role)
+		return string(unicode.ToUpper(r)) + role[size:]
+	}
+}
+
+// exportChat renders a chat in the format selected by opts
+func exportChat(id string, chatFile *ChatFile, opts ExportOptions) ([]byte, error) {
+	switch opts.Format {
+	case exportMarkdown:
+		return []byte(exportChatMarkdown(id, chatFile, opts)), nil
+	case exportHTML:
+		return []byte(exportChatHTML(id, chatFile, opts)), nil
+	case exportJSONL:
+		return exportChatJSONL(id, chatFile, opts)
+	default:
+		return nil, fmt.Errorf("unknown export format '%s'", opts.Format)
+	}
+}
+
+// metadataLines describes the chat metadata as label/value pairs
+func metadataLines(id string, meta ChatMetadata) [][2]string {
+	lines := [][2]string{{"Chat", id}}
+	if meta.Model != "" {
+		lines = append(lines, [2]string{"Model", meta.Model})
+	}
+	if !meta.CreatedAt.IsZero() {
+		lines = append(lines, [2]string{"Created", meta.CreatedAt.Format("2006-01-02 15:04")})
+	}
+	if meta.Folder != "" {
+		lines = append(lines, [2]string{"Folder", meta.Folder})
+	}
+	if len(meta.Tags) > 0 {
+		lines = append(lines, [2]string{"Tags", "#" + strings.Join(meta.Tags, " #")})
+	}
+	if meta.Summary != "" {
+		lines = append(lines, [2]string{"Summary", meta.Summary})
+	}
+	return lines
+}
+
+// exportChatMarkdown renders a chat as Markdown, keeping message content
+// (and so its code fences) verbatim under a heading per message
+func exportChatMarkdown(id string, chatFile *ChatFile, opts ExportOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", chatDisplayTitle(chatFile, id))
+	if opts.IncludeMetadata {
+		for _, line := range metadataLines(id, chatFile.Metadata) {
+			fmt.Fprintf(&b, "- **%s:** %s\n", line[0], line[1])
+		}
+		b.WriteString("\n")
+	}
+	for _, msg := range exportMessages(chatFile, opts) {
+		fmt.Fprintf(&b, "## %s\n\n", roleHeading(msg.Role))
+		if msg.Reasoning != "" {
+			fmt.Fprintf(&b, "<details>\n<summary>Reasoning</summary>\n\n%s\n\n</details>\n\n", msg.Reasoning)
+		}
+		b.WriteString(msg.Content + "\n\n")
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// exportChatJSONL renders a chat as one OpenAI chat-format JSON line
+func exportChatJSONL(id string, chatFile *ChatFile, opts ExportOptions) ([]byte, error) {
+	type jsonlMessage struct {
+		Role      string `json:"role"`
+		Content   string `json:"content"`
+		Reasoning string `json:"reasoning,omitempty"`
+	}
+	type jsonlMetadata struct {
+		ID string `json:"id"`
+		ChatMetadata
+	}
+	record := struct {
+		Messages []jsonlMessage `json:"messages"`
+		Metadata *jsonlMetadata `json:"metadata,omitempty"`
+	}{Messages: []jsonlMessage{}}
+	for _, msg := range exportMessages(chatFile, opts) {
+		record.Messages = append(record.Messages, jsonlMessage(msg))
+	}
+	if opts.IncludeMetadata {
+		meta := chatFile.Metadata
+		// Context bookkeeping is internal to this tool
+		meta.ContextSummary, meta.ContextSummaryUpTo, meta.ContextStrategy = "", "", ""
+		record.Metadata = &jsonlMetadata{ID: id, ChatMetadata: meta}
+	}
+	// Keep <, > and & readable in code snippets
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(record); err != nil {
+		return nil, fmt.Errorf("failed to marshal chat export: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// exportHTMLStyle is embedded in HTML exports so they need no other files
+const exportHTMLStyle = `body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif;max-width:860px;margin:2rem auto;padding:0 1rem;color:#1f2328;background:#fff;line-height:1.55}
+h1{font-size:1.6rem;border-bottom:1px solid #d0d7de;padding-bottom:.4rem}
+.meta{color:#59636e;font-size:.9rem;margin-bottom:1.5rem}.meta dt{font-weight:600;float:left;clear:left;width:6rem}.meta dd{margin:0 0 .2rem 6rem}
+.msg{border:1px solid #d0d7de;border-radius:8px;margin:1rem 0;padding:.6rem 1rem}
+.msg h2{font-size:.85rem;text-transform:uppercase;letter-spacing:.05em;margin:.2rem 0 .6rem}
+.user{background:#f6f8fa}.user h2{color:#cf222e}.assistant h2{color:#0969da}.system{background:#fff8c5}.system h2{color:#9a6700}
+pre{background:#f6f8fa;border:1px solid #d0d7de;border-radius:6px;padding:.7rem;overflow-x:auto}.user pre{background:#fff}
+code{font-family:ui-monospace,SFMono-Regular,Menlo,Consolas,monospace;font-size:.88em}
+details{color:#59636e;margin-bottom:.6rem}summary{cursor:pointer}
+@media (prefers-color-scheme:dark){body{background:#0d1117;color:#e6edf3}.msg,pre,h1{border-color:#30363d}.user,pre{background:#161b22}.user pre{background:#0d1117}.system{background:#272115}.meta,details{color:#9198a1}}`
+
+// exportChatHTML renders a chat as a self-contained styled HTML page
+func exportChatHTML(id string, chatFile *ChatFile, opts ExportOptions) string {
+	title := html.EscapeString(chatDisplayTitle(chatFile, id))
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<h1>%s</h1>\n", title, exportHTMLStyle, title)
+	if opts.IncludeMetadata {
+		b.WriteString("<dl class=\"meta\">\n")
+		for _, line := range metadataLines(id, chatFile.Metadata) {
+			fmt.Fprintf(&b, "<dt>%s</dt><dd>%s</dd>\n", html.EscapeString(line[0]), html.EscapeString(line[1]))
+		}
+		b.WriteString("</dl>\n")
+	}
+	for _, msg := range exportMessages(chatFile, opts) {
+		fmt.Fprintf(&b, "<section class=\"msg %s\">\n<h2>%s</h2>\n", html.EscapeString(msg.Role), roleHeading(msg.Role))
+		if msg.Reasoning != "" {
+			fmt.Fprintf(&b, "<details><summary>Reasoning</summary>\n%s</details>\n", markdownToHTML(msg.Reasoning))
+		}
+		b.WriteString(markdownToHTML(msg.Content))
+		b.WriteString("</section>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// inlineCodePattern matches `inline code` spans
+var inlineCodePattern = regexp.MustCompile("`([^`\n]+)`")
+
+// markdownToHTML converts the parts of Markdown that matter most in chats:
+// fenced code blocks, paragraphs and inline code. Everything else is kept
+// as escaped text.
+func markdownToHTML(text string) string {
+	var b strings.Builder
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		escaped := html.EscapeString(strings.Join(paragraph, "\n"))
+		escaped = inlineCodePattern.ReplaceAllString(escaped, "<code>$1</code>")
+		b.WriteString("<p>" + strings.ReplaceAll(escaped, "\n", "<br>\n") + "</p>\n")
+		paragraph = nil
+	}
+
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			flush()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(lang))
+			}
+			fmt.Fprintf(&b, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(code, "\n")))
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	return b.String()
+}
+
+// exportFileName returns a file name for an export derived from the chat title
+func exportFileName(id string, chatFile *ChatFile, format string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(chatDisplayTitle(chatFile, id)) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			slug.WriteRune(r)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteRune('-')
+			dash = true
+		}
+	}
+	name := strings.Trim(slug.String(), "-")
+	if name == "" {
+		name = id
+	}
+	return name + "." + format
+}
+
+// exportChatToFile exports a stored chat and writes it to path, or to a
+// file named after the chat in the working directory when path is empty
+func exportChatToFile(id string, opts ExportOptions, path string) (string, error) {
+	chatFile, err := loadChatWithMetadata(id)
+	if err != nil {
+		return "", err
+	}
+	data, err := exportChat(id, chatFile, opts)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return writeNewExportFile(exportFileName(id, chatFile, opts.Format), data)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write export '%s': %w", path, err)
+	}
+	return path, nil
+}
+
+// writeNewExportFile writes data to name without replacing an existing file.
+// Titles are not unique, so a taken name gets a numeric suffix, e.g.
+// "new-chat-2.md".
+func writeNewExportFile(name string, data []byte) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		path := name
+		if n > 1 {
+			path = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to write export '%s': %w", path, err)
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", fmt.Errorf("failed to write export '%s': %w", path, err)
+		}
+		return path, nil
+	}
+}
+
+// parseExportArgs reads "[format] [+system] [+reasoning] [-metadata]" style
+// arguments used by the :export command
+func parseExportArgs(args []string) (ExportOptions, error) {
+	opts := defaultExportOptions(exportMarkdown)
+	for _, arg := range args {
+		switch {
+		case isExportFormat(arg):
+			opts.Format = arg
+			opts.IncludeMetadata = defaultExportOptions(arg).IncludeMetadata
+		case arg == "+system" || arg == "-system":
+			opts.IncludeSystem = arg[0] == '+'
+		case arg == "+reasoning" || arg == "-reasoning":
+			opts.IncludeReasoning = arg[0] == '+'
+		case arg == "+metadata" || arg == "-metadata":
+			opts.IncludeMetadata = arg[0] == '+'
+		default:
+			return opts, fmt.Errorf("unknown export option '%s'", arg)
+		}
+	}
+	return opts, nil
+}
+
+// resolveChat finds a chat by ID or, failing that, by its exact title
+func resolveChat(ref string) (string, error) {
+	if _, err := os.Stat(chatSnapshotPath(ref)); err == nil && isChatID(ref) {
+		return ref, nil
+	}
+	chats, err := listAllChats()
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	for _, entry := range loadChatEntries(chats) {
+		if strings.EqualFold(entry.Title(), ref) {
+			matches = append(matches, entry.ID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no chat with ID or title '%s'", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%d chats are titled '%s'; use the chat ID", len(matches), ref)
+	}
+}
+
+// runExportCommand implements "aichat export", returning the exit code
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", exportMarkdown, "export format: md, html or jsonl")
+	output := fs.String("o", "", "output file, or - for stdout (default: named after the chat)")
+	all := fs.Bool("all", false, "export every chat (jsonl writes one line per chat)")
+	system := fs.Bool("system", false, "include system prompts")
+	reasoning := fs.Bool("reasoning", false, "include reasoning blocks")
+	metadata := fs.Bool("metadata", true, "include chat metadata (default false for jsonl)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: aichat export [flags] <chat ID or title>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !isExportFormat(*format) {
+		fmt.Fprintf(os.Stderr, "unknown export format '%s'\n", *format)
+		return 2
+	}
+
+	opts := defaultExportOptions(*format)
+	opts.IncludeSystem = *system
+	opts.IncludeReasoning = *reasoning
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "metadata" {
+			opts.IncludeMetadata = *metadata
+		}
+	})
+
+	var ids []string
+	if *all {
+		chats, err := listAllChats()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		ids = chats
+	}
+	for _, ref := range fs.Args() {
+		id, err := resolveChat(ref)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	// Several chats go to one stream only for stdout or JSONL
+	if len(ids) > 1 && *output != "-" && *format != exportJSONL {
+		if *output != "" {
+			fmt.Fprintln(os.Stderr, "-o can only name one file for several md or html exports; omit it to write one file per chat")
+			return 2
+		}
+		for _, id := range ids {
+			path, err := exportChatToFile(id, opts, "")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Println(path)
+		}
+		return 0
+	}
+
+	var out strings.Builder
+	for _, id := range ids {
+		chatFile, err := loadChatWithMetadata(id)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		data, err := exportChat(id, chatFile, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out.Write(data)
+	}
+	path := *output
+	if path == "-" {
+		fmt.Print(out.String())
+		return 0
+	}
+	if path == "" {
+		name := "chats-" + time.Now().Format("20060102-150405") + "." + *format
+		if len(ids) == 1 {
+			chatFile, _ := loadChatWithMetadata(ids[0])
+			name = exportFileName(ids[0], chatFile, *format)
+		}
+		written, err := writeNewExportFile(name, []byte(out.String()))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(written)
+		return 0
+	}
+	if err := os.WriteFile(path, []byte(out.String()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write export '%s': %v\n", path, err)
+		return 1
+	}
+	fmt.Println(path)
+	return 0
+}
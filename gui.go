@@ -6,16 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
 // ChatGUI represents the GUI interface for the chat application
@@ -51,65 +57,12 @@ func (g *ChatGUI) UpdateChatHistory() {
 	// This will be handled by the Bubble Tea model
 }
 
-// generateTitleWithAPI generates a title using the AI API
+// generateTitleWithAPI queues an LLM-generated title for the chat
 func (g *ChatGUI) generateTitleWithAPI() {
 	if len(g.messages) == 0 {
 		return
 	}
-
-	// Create a summary of the conversation for title generation
-	var conversationSummary strings.Builder
-	conversationSummary.WriteString("Conversation summary:\n")
-
-	// Include last few messages for context
-	startIdx := len(g.messages) - 3
-	if startIdx < 0 {
-		startIdx = 0
-	}
-
-	for i := startIdx; i < len(g.messages); i++ {
-		msg := g.messages[i]
-		if msg.Role != "system" {
-			conversationSummary.WriteString(fmt.Sprintf("%s: %s\n", strings.Title(msg.Role), msg.Content))
-		}
-	}
-
-	// Create title generation prompt
-	titlePrompt := fmt.Sprintf("%s\n\nDevise a short title for this chat, no longer than 5 words so that it can be easily picked and recognized from a list of chats. Return only the title, nothing else.", conversationSummary.String())
-
-	// Create messages for title generation
-	titleMessages := []Message{
-		{Role: "system", Content: "You are a helpful assistant that generates concise, descriptive titles for chat conversations."},
-		{Role: "user", Content: titlePrompt},
-	}
-
-	// Generate title in background
-	go func() {
-		title, err := streamChatResponse(titleMessages, g.model)
-		if err != nil {
-			return
-		}
-
-		// Clean up the title
-		title = strings.TrimSpace(title)
-		title = strings.ReplaceAll(title, "\"", "")
-		title = strings.ReplaceAll(title, "'", "")
-
-		// Limit to 5 words
-		words := strings.Fields(title)
-		if len(words) > 5 {
-			words = words[:5]
-		}
-		cleanTitle := strings.Join(words, "-")
-
-		// Rename the chat file
-		oldPath := filepath.Join(chatsPath, g.chatName+".json")
-		newPath := filepath.Join(chatsPath, cleanTitle+".json")
-
-		if err := os.Rename(oldPath, newPath); err == nil {
-			g.chatName = cleanTitle
-		}
-	}()
+	jobRunner.Enqueue(backgroundJob{Kind: jobTitle, ChatID: g.chatName, Model: g.model, Force: true})
 }
 
 // handleVimCommand processes vim-like commands
@@ -121,14 +74,9 @@ func (g *ChatGUI) handleVimCommand(cmd string) bool {
 		return true
 	case ":f":
 		// Toggle favorite status
-		chatFile, err := loadChatWithMetadata(g.chatName)
-		if err == nil {
-			chatFile.Metadata.Favorite = !chatFile.Metadata.Favorite
-			// Save the updated metadata by saving the entire chat
-			if err := saveChat(g.chatName, chatFile.Messages); err == nil {
-				// Success - status will be shown in the UI
-			}
-		}
+		updateChatMetadata(g.chatName, func(meta *ChatMetadata) {
+			meta.Favorite = !meta.Favorite
+		})
 		return true
 	case ":q":
 		// Save and quit
@@ -144,59 +92,103 @@ func (g *ChatGUI) handleVimCommand(cmd string) bool {
 // --- ChatModel and async AI response refactor ---
 
 type aiResponseMsg struct {
-	response string
-	err      error
+	id           int64 // Request the reply belongs to
+	response     string
+	alternatives []string // Further replies when several were requested
+	err          error
+	usage        contextUsage
 }
 
 type spinnerTickMsg struct{}
 
 type stopRequestMsg struct{}
 
-func getAIResponseCmd(messages []Message, model string, stopChan chan bool) tea.Cmd {
+// requestSeq numbers chat requests, so a reply to a cancelled one is ignored
+var requestSeq atomic.Int64
+
+// maxAlternatives limits how many replies one request asks for at once
+const maxAlternatives = 5
+
+// getAIResponseCmd asks model for n replies to messages, running the
+// requests concurrently. The reply is missing only if every request fails.
+func getAIResponseCmd(id int64, chatName string, messages []Message, model string, n int, stopChan chan bool) tea.Cmd {
 	return func() tea.Msg {
-		reply, err := streamChatResponseGUI(messages, model, stopChan)
-		return aiResponseMsg{reply, err}
+		// Fitting may call the model to summarize, so it runs off the UI loop
+		fitted, usage := prepareContext(chatName, messages, model)
+		opts := chatRequestOptions(chatName)
+		replies := make([]string, max(1, n))
+		errs := make([]error, len(replies))
+		var wg sync.WaitGroup
+		for i := range replies {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				replies[i], errs[i] = streamChatResponseGUI(fitted, model, opts, stopChan)
+			}()
+		}
+		wg.Wait()
+
+		msg := aiResponseMsg{id: id, usage: usage}
+		for i, reply := range replies {
+			switch {
+			case errs[i] != nil:
+				if msg.err == nil {
+					msg.err = errs[i]
+				}
+			case msg.response == "":
+				msg.response = reply
+			case reply != "":
+				msg.alternatives = append(msg.alternatives, reply)
+			}
+		}
+		if msg.response != "" {
+			msg.err = nil
+		}
+		return msg
 	}
 }
 
 func spinnerTick() tea.Cmd {
-	return tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+	interval := time.Duration(currentSettings().UI.SpinnerMS) * time.Millisecond
+	return tea.Tick(interval, func(t time.Time) tea.Msg {
 		return spinnerTickMsg{}
 	})
 }
 
-// streamChatResponseGUI is a version of streamChatResponse that doesn't print to stdout
-func streamChatResponseGUI(messages []Message, model string, stopChan chan bool) (string, error) {
-	reqBody := StreamRequestBody{
-		Model:       model,
-		Messages:    messages,
-		Stream:      true,
-		MaxTokens:   2048,
-		Temperature: 0.7,
-	}
+// streamChatResponseGUI is a version of streamChatResponse that doesn't print
+// to stdout. opts carries the chat's key and generation parameters.
+func streamChatResponseGUI(messages []Message, model string, opts requestOptions, stopChan chan bool) (string, error) {
+	reply, _, err := streamChatGUI(messages, model, opts, stopChan, nil)
+	return reply, err
+}
+
+// streamChatGUI streams a reply, passing each piece to onDelta when it is
+// set, and returns the reply with the usage the API reported, if any
+func streamChatGUI(messages []Message, model string, opts requestOptions, stopChan chan bool, onDelta func(string)) (string, *TokenUsage, error) {
+	reqBody := newStreamRequestBody(messages, model, opts.Params)
+	reqBody.Usage = &UsageRequest{Include: true}
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	apiKey, err := getActiveAPIKey()
+	apiKey, err := requestAPIKey(opts.APIKey)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("HTTP-Referer", "https://github.com/go-ai-cli")
 	req.Header.Set("X-Title", "Go AI CLI")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer resp.Body.Close()
 
@@ -206,20 +198,21 @@ func streamChatResponseGUI(messages []Message, model string, stopChan chan bool)
 			Error ErrorResponse `json:"error"`
 		}
 		if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Error.Message != "" {
-			return "", fmt.Errorf("API error %d: %s", errorResp.Error.Code, errorResp.Error.Message)
+			return "", nil, fmt.Errorf("API error %d: %s", errorResp.Error.Code, errorResp.Error.Message)
 		}
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
 	}
 
 	reader := bufio.NewReader(resp.Body)
 	var fullReply strings.Builder
+	var usage *TokenUsage
 	var buffer string
 
 	for {
 		// Check for stop request
 		select {
 		case <-stopChan:
-			return "", fmt.Errorf("request cancelled by user")
+			return "", nil, fmt.Errorf("request cancelled by user")
 		default:
 			// Continue with normal processing
 		}
@@ -229,7 +222,7 @@ func streamChatResponseGUI(messages []Message, model string, stopChan chan bool)
 			if err == io.EOF {
 				break
 			}
-			return fullReply.String(), err
+			return fullReply.String(), usage, err
 		}
 
 		line = strings.TrimSpace(line)
@@ -285,17 +278,23 @@ func streamChatResponseGUI(messages []Message, model string, stopChan chan bool)
 				continue
 			}
 
+			if streamResp.Usage != nil {
+				usage = streamResp.Usage
+			}
 			if len(streamResp.Choices) > 0 {
 				content := streamResp.Choices[0].Delta.Content
 				if content != "" {
 					fullReply.WriteString(content)
+					if onDelta != nil {
+						onDelta(content)
+					}
 				}
 			}
 		}
 	}
 
 	result := fullReply.String()
-	return result, nil
+	return result, usage, nil
 }
 
 // min returns the minimum of two integers
@@ -314,19 +313,56 @@ func getSpinnerChar(index int) string {
 
 // ChatModel represents the Bubble Tea model for the chat interface
 type ChatModel struct {
-	chatName    string
-	messages    []Message
-	model       string
-	inputBuffer string
-	width       int
-	height      int
-	status      string
-	quitting    bool
-	loading     bool
-	spinner     int
-	scrollPos   int       // Current scroll position (index of first visible message)
-	autoScroll  bool      // Whether to auto-scroll to bottom
-	stopChan    chan bool // Channel to signal stop request
+	chatName   string // Chat ID, used as the file name
+	title      string // Human-readable chat title
+	messages   []Message
+	model      string
+	input      TextArea // Message being typed
+	width      int
+	height     int
+	status     string
+	quitting   bool
+	loading    bool
+	spinner    int
+	scrollLine int         // First transcript line shown
+	autoScroll bool        // Whether to keep the newest line in view
+	stopChan   chan bool   // Channel to signal stop request
+	request    int64       // Id of the pending request, 0 when none
+	branches   []branchPos // Sibling position of each message on the active path
+	pinned     []bool      // Whether each message on the active path is pinned
+	contextLen int         // Context window of the model in tokens
+	jobStatus  string      // Progress of background title/summary jobs
+	editing    bool        // Whether the input is replacing an earlier message
+	editIndex  int         // Index in messages of the message being edited
+	deleted    bool        // Whether the chat was moved to the trash
+	unlocking  bool        // Whether the input is asking for the vault passphrase
+	passphrase string      // Vault passphrase being typed
+	markdown   *MarkdownRenderer
+	raw        bool      // Show assistant messages as plain text instead of rendered markdown
+	selecting  bool      // Whether keys act on the selected message
+	selected   int       // Index in messages of the selected message
+	restore    []Message // Messages shown again if a regeneration fails or is cancelled
+	compare    []string  // Models the next message is compared across
+}
+
+// compareModelsMsg sets the models a chat's next message is compared across
+type compareModelsMsg struct {
+	chatName string
+	models   []string
+}
+
+// compareFinishedMsg hands a chat the outcome of a comparison
+type compareFinishedMsg struct {
+	chatName string
+	result   compareResult
+}
+
+// regenerateMsg asks a chat for a new reply at index in its messages
+type regenerateMsg struct {
+	chatName string
+	index    int
+	model    string
+	count    int // Number of alternatives to generate
 }
 
 func (m ChatModel) Init() tea.Cmd {
@@ -336,127 +372,164 @@ func (m ChatModel) Init() tea.Cmd {
 func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.unlocking && msg.String() != "ctrl+c" {
+			return m.updateUnlock(msg), nil
+		}
+		if m.selecting && msg.String() != "ctrl+c" && msg.String() != "ctrl+s" {
+			return m.updateSelect(msg)
+		}
 		switch msg.String() {
 		case "ctrl+c":
 			m.quitting = true
-			return m, tea.Quit
+			return m, m.done()
 		case "ctrl+s":
 			if m.loading {
 				// Stop the current request
 				if m.stopChan != nil {
 					close(m.stopChan)
+					m.stopChan = nil
 				}
-				// Remove the last user message
-				if len(m.messages) > 0 && m.messages[len(m.messages)-1].Role == "user" {
+				// The reply may still arrive; it is dropped
+				m.request = 0
+				if m.restore != nil {
+					// Show the reply that was being regenerated again
+					m.messages, m.restore = m.restore, nil
+				} else if len(m.messages) > 0 && m.messages[len(m.messages)-1].Role == "user" {
+					// Remove the last user message
 					m.messages = m.messages[:len(m.messages)-1]
 				}
 				m.loading = false
 				m.status = "Request cancelled"
 				return m, nil
 			}
-		case "q":
-			m.quitting = true
-			return m, tea.Quit
 		case "enter":
-			if m.inputBuffer != "" && !m.loading {
-				if strings.HasPrefix(m.inputBuffer, ":") {
-					if m.handleVimCommand(m.inputBuffer) {
-						m.inputBuffer = ""
-						return m, nil
+			value := m.input.Value()
+			if strings.TrimSpace(value) != "" && !m.loading && vaultLocked() {
+				// The chat cannot be saved until the vault is unlocked again
+				m.unlocking = true
+				m.status = "Vault locked: enter the passphrase to continue"
+				return m, nil
+			}
+			if strings.TrimSpace(value) != "" && !m.loading {
+				if strings.HasPrefix(value, ":") {
+					m.input.Reset()
+					if handled, cmd := m.handleVimCommand(value); handled {
+						if m.quitting {
+							return m, m.done()
+						}
+						return m, cmd
 					}
+					m.input.SetValue(value)
 				}
-				m.messages = append(m.messages, Message{Role: "user", Content: m.inputBuffer})
-				m.inputBuffer = ""
-				m.loading = true
-				m.status = "Waiting for AI response..."
-				m.autoScroll = true          // Auto-scroll when sending message
-				m.stopChan = make(chan bool) // Create stop channel
-				// Pass a copy of messages to the command
-				messagesCopy := make([]Message, len(m.messages))
-				copy(messagesCopy, m.messages)
-				return m, tea.Batch(getAIResponseCmd(messagesCopy, m.model, m.stopChan), spinnerTick())
-			}
-		case "backspace":
-			if !m.loading && len(m.inputBuffer) > 0 {
-				m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
-			}
-		case "pageup":
-			if !m.loading {
-				// Scroll up by half the chat box height
-				chatBoxHeight := m.height - 6 // Approximate chat box height
-				m.scrollPos = max(0, m.scrollPos-chatBoxHeight/2)
-				m.autoScroll = false
-			}
-		case "pagedown":
-			if !m.loading {
-				// Scroll down by half the chat box height
-				chatBoxHeight := m.height - 6
-				maxScroll := max(0, len(m.getVisibleMessages())-chatBoxHeight)
-				m.scrollPos = min(maxScroll, m.scrollPos+chatBoxHeight/2)
-				m.autoScroll = false
+				if m.editing {
+					// Drop everything from the edited message on; saving forks a new branch
+					m.messages = m.messages[:m.editIndex]
+					m.editing = false
+				}
+				// Continuing from a reply picks it among its alternatives
+				m.chooseReply(len(m.messages)-1, false)
+				if len(m.compare) > 0 {
+					return m, m.startCompare(value)
+				}
+				m.messages = append(m.messages, Message{Role: "user", Content: value})
+				m.input.Reset()
+				return m, m.send(m.model, 1)
 			}
-		case "home":
-			if !m.loading {
-				// Scroll to top
-				m.scrollPos = 0
-				m.autoScroll = false
+		case "esc":
+			if m.editing {
+				m.editing = false
+				m.input.Reset()
+				m.status = "Edit cancelled"
+			} else {
+				m.startSelecting()
 			}
-		case "end":
+		case "ctrl+y":
 			if !m.loading {
-				// Scroll to bottom
-				m.scrollPos = max(0, len(m.getVisibleMessages())-(m.height-6))
-				m.autoScroll = true
+				return m, m.copyToClipboard(nil)
 			}
-		case "up":
+		case "ctrl+r":
+			m.toggleRaw()
+		case "ctrl+left", "ctrl+right":
 			if !m.loading {
-				if m.inputBuffer == "" {
-					// Scroll up one message when not typing
-					m.scrollPos = max(0, m.scrollPos-1)
-					m.autoScroll = false
-				} else {
-					// Normal character input
-					if len(msg.String()) == 1 {
-						char := msg.String()[0]
-						if char >= 32 && char <= 126 {
-							m.inputBuffer += msg.String()
-						}
-					}
+				delta := 1
+				if msg.String() == "ctrl+left" {
+					delta = -1
 				}
+				m.switchLatestBranch(delta)
 			}
-		case "down":
-			if !m.loading {
-				if m.inputBuffer == "" {
-					// Scroll down one message when not typing
-					maxScroll := max(0, len(m.getVisibleMessages())-(m.height-6))
-					m.scrollPos = min(maxScroll, m.scrollPos+1)
-					m.autoScroll = false
-				} else {
-					// Normal character input
-					if len(msg.String()) == 1 {
-						char := msg.String()[0]
-						if char >= 32 && char <= 126 {
-							m.inputBuffer += msg.String()
-						}
-					}
-				}
+		case "pgup":
+			m.scrollBy(-m.chatBoxHeight())
+		case "pgdown":
+			m.scrollBy(m.chatBoxHeight())
+		case "ctrl+up", "alt+up":
+			m.jumpMessage(-1)
+		case "ctrl+down", "alt+down":
+			m.jumpMessage(1)
+		case "home", "end", "up", "down", "ctrl+u", "ctrl+d":
+			if !m.loading && !m.input.Empty() {
+				// Move the cursor or edit while typing
+				m.input.Update(msg)
+				break
+			}
+			switch msg.String() {
+			case "home":
+				m.scrollTo(0)
+			case "end":
+				m.scrollTo(math.MaxInt)
+			case "up":
+				m.scrollBy(-1)
+			case "down":
+				m.scrollBy(1)
+			case "ctrl+u":
+				m.scrollBy(-m.chatBoxHeight() / 2)
+			case "ctrl+d":
+				m.scrollBy(m.chatBoxHeight() / 2)
 			}
 		default:
-			if !m.loading && len(msg.String()) == 1 {
-				char := msg.String()[0]
-				if char >= 32 && char <= 126 {
-					m.inputBuffer += msg.String()
-				}
+			if !m.loading {
+				m.input.Update(msg)
+			}
+		}
+	case clipboardMsg:
+		m.status = fmt.Sprintf("Copied %s to the clipboard (%s)", msg.what, msg.method)
+		if msg.seq != "" {
+			return m, sendTerminalSeq(msg.seq)
+		}
+	case compareModelsMsg:
+		if msg.chatName == m.chatName {
+			m.setCompareModels(msg.models)
+		}
+	case compareFinishedMsg:
+		if msg.chatName == m.chatName {
+			m.finishCompare(msg.result)
+		}
+	case regenerateMsg:
+		if msg.chatName == m.chatName && msg.index < len(m.messages) {
+			return m, m.regenerate(msg.index, msg.model, msg.count)
+		}
+	case tea.MouseMsg:
+		if msg.Action == tea.MouseActionPress {
+			switch msg.Button {
+			case tea.MouseButtonWheelUp:
+				m.scrollBy(-wheelLines)
+			case tea.MouseButtonWheelDown:
+				m.scrollBy(wheelLines)
 			}
 		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.input.SetWidth(m.width - 4 - inputLabelWidth)
 	case spinnerTickMsg:
 		if m.loading {
 			m.spinner = (m.spinner + 1) % 4
 			return m, spinnerTick()
 		}
 	case aiResponseMsg:
+		if msg.id != m.request {
+			return m, nil
+		}
+		m.request = 0
 		m.loading = false
 		if m.stopChan != nil {
 			close(m.stopChan)
@@ -464,6 +537,9 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		if msg.err != nil {
 			m.status = fmt.Sprintf("Error: %v", msg.err)
+			if m.restore != nil {
+				m.messages = m.restore
+			}
 		} else {
 			if msg.response == "" {
 				m.status = "Warning: Empty response received"
@@ -478,260 +554,1000 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 
 				if shouldAppend {
+					// Alternatives are saved as siblings before the reply that is shown
+					for _, alt := range msg.alternatives {
+						if err := saveChat(m.chatName, append(slices.Clone(m.messages), Message{Role: "assistant", Content: alt})); err != nil {
+							m.status = fmt.Sprintf("Save error: %v", err)
+						}
+					}
 					m.messages = append(m.messages, Message{Role: "assistant", Content: msg.response})
 					m.status = "Ready"
-					// Auto-scroll to bottom when new message arrives
-					if m.autoScroll {
-						m.scrollPos = max(0, len(m.getVisibleMessages())-(m.height-6))
+					if len(msg.alternatives) > 0 {
+						m.status = fmt.Sprintf("Ready (%d alternatives; Esc, then ←/→ to compare and c to choose)", len(msg.alternatives)+1)
+					}
+					if msg.usage.Note != "" {
+						m.status += " (" + msg.usage.Note + ")"
 					}
 				}
 			}
 		}
+		m.restore = nil
 		if err := saveChat(m.chatName, m.messages); err != nil {
 			m.status = fmt.Sprintf("Save error: %v", err)
+		} else if msg.err == nil {
+			m.firstExchangeJobs()
+		}
+		m.refreshBranches()
+	case jobStatusMsg:
+		if msg.Job.ChatID != m.chatName {
+			return m, nil
+		}
+		m.jobStatus = jobStatusText(msg)
+		if msg.State == jobDone && msg.Job.Kind == jobTitle {
+			m.title = loadChatTitle(m.chatName)
 		}
 	}
 	return m, nil
 }
 
-func (m ChatModel) View() string {
-	if m.quitting {
-		return "Chat saved. Goodbye!\n"
+// firstExchangeJobs titles, summarizes and tags the chat in the
+// background once it has its first question and answer
+func (m ChatModel) firstExchangeJobs() {
+	if m.countRole("user") != 1 || m.countRole("assistant") != 1 {
+		return
 	}
+	jobRunner.Enqueue(backgroundJob{Kind: jobTitle, ChatID: m.chatName, Model: m.model})
+	jobRunner.Enqueue(backgroundJob{Kind: jobSummary, ChatID: m.chatName, Model: m.model})
+	if autoTagEnabled() {
+		jobRunner.Enqueue(backgroundJob{Kind: jobTags, ChatID: m.chatName, Model: m.model})
+	}
+}
 
-	// Styles
-	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("63"))
-	statusStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
-	userStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("203")).Bold(true)
-	assistantStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("39")).Bold(true)
-	loadingStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
-
-	// Box styles with borders
-	chatBoxStyle := lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("62")).
-		Padding(0, 1)
-
-	inputBoxStyle := lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("62")).
-		Padding(0, 1)
-
-	// Calculate layout dimensions
-	headerHeight := 1                                                         // Title line
-	statusHeight := 1                                                         // Status line
-	inputHeight := 3                                                          // Fixed 3-line input box
-	chatBoxHeight := m.height - headerHeight - statusHeight - inputHeight - 2 // -2 for spacing
+// Chat input layout
+const (
+	maxInputLines   = 8 // Rows the input grows to before it scrolls
+	inputLabelWidth = 7 // Columns taken by the "Input:" label
+)
 
-	if chatBoxHeight < 1 {
-		chatBoxHeight = 1
-	}
+// newChatInput creates the chat's message input
+func newChatInput() TextArea {
+	input := NewTextArea(maxInputLines)
+	input.SetWidth(80 - 4 - inputLabelWidth)
+	return input
+}
 
-	// Header
-	scrollIndicator := ""
-	if len(m.getVisibleMessages()) > chatBoxHeight {
-		scrollIndicator = fmt.Sprintf(" [Scroll: %d/%d]", m.scrollPos+1, len(m.getVisibleMessages()))
+// inputHeight returns the rows inside the input box
+func (m ChatModel) inputHeight() int {
+	if m.unlocking {
+		return 1
 	}
-	header := titleStyle.Render(fmt.Sprintf("Chat: %s | Model: %s | Messages: %d%s", m.chatName, m.model, len(m.messages), scrollIndicator))
-
-	// Status
-	statusText := m.status
 	if m.loading {
-		statusText = loadingStyle.Render(getSpinnerChar(m.spinner) + " " + m.status)
+		return m.input.Height() + 1
 	}
+	return m.input.Height()
+}
 
-	// Add scroll help if there are many messages
-	if len(m.getVisibleMessages()) > chatBoxHeight {
-		statusText += " | PageUp/Down, Home/End, ↑↓ to scroll"
-	}
-	status := statusStyle.Render(statusText)
+// send asks model for n alternative replies to the messages
+func (m *ChatModel) send(model string, n int) tea.Cmd {
+	m.loading = true
+	m.status = "Waiting for AI response..."
+	m.autoScroll = true          // Auto-scroll when sending message
+	m.stopChan = make(chan bool) // Create stop channel
+	m.request = requestSeq.Add(1)
+	// Pass a copy of messages to the command
+	messagesCopy := make([]Message, len(m.messages))
+	copy(messagesCopy, m.messages)
+	return tea.Batch(getAIResponseCmd(m.request, m.chatName, messagesCopy, model, n, m.stopChan), spinnerTick())
+}
 
-	// Prepare chat history content
-	var visible []string
-	visibleMessages := m.getVisibleMessages()
+// wheelLines is how far one step of the mouse wheel scrolls the transcript
+const wheelLines = 3
 
-	// Apply scroll position
-	startIdx := m.scrollPos
-	endIdx := min(startIdx+(m.height-6), len(visibleMessages))
+// chatBoxHeight returns the rows of transcript the chat box shows
+func (m ChatModel) chatBoxHeight() int {
+	// Header, status, two blank lines and the borders of both boxes
+	return max(1, m.height-m.inputHeight()-8)
+}
 
-	if startIdx < len(visibleMessages) {
-		for i := startIdx; i < endIdx; i++ {
-			msg := visibleMessages[i]
-			if msg.Role == "user" {
-				visible = append(visible, userStyle.Render("You:")+msg.Content)
-			} else if msg.Role == "assistant" {
-				visible = append(visible, assistantStyle.Render("Assistant:")+msg.Content)
-			}
+// transcript renders the visible messages wrapped to the chat box. It
+// returns the lines and the line each message starts on.
+func (m ChatModel) transcript() ([]string, []int) {
+	theme := currentSettings().UI.Colors
+	userStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Accent)).Bold(true)
+	assistantStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Assistant)).Bold(true)
+	width := max(1, m.width-4)
+
+	var lines []string
+	var starts []int
+	for i, idx := range m.visibleIndices() {
+		msg := m.messages[idx]
+		userStyle, assistantStyle := userStyle, assistantStyle
+		if m.selecting && idx == m.selected {
+			userStyle, assistantStyle = userStyle.Reverse(true), assistantStyle.Reverse(true)
 		}
-	}
-
-	// Pad the top with empty lines if not enough messages to fill the chatbox
-	if len(visible) < chatBoxHeight {
-		padLines := make([]string, chatBoxHeight-len(visible))
-		for i := range padLines {
-			padLines[i] = ""
+		var text string
+		switch msg.Role {
+		case "user":
+			text = userStyle.Render(m.messageLabel("You", idx, i+1)) + strings.ReplaceAll(msg.Content, "\t", "    ")
+		case "assistant":
+			text = assistantStyle.Render(m.messageLabel("Assistant", idx, i+1)) + m.renderReply(msg.Content)
+		default:
+			continue
 		}
-		visible = append(padLines, visible...)
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		starts = append(starts, len(lines))
+		lines = append(lines, strings.Split(ansi.Wrap(text, width, ""), "\n")...)
 	}
+	return lines, starts
+}
 
-	chatContent := strings.Join(visible, "\n\n")
-	if strings.TrimSpace(chatContent) == "" {
-		chatContent = "No messages yet..."
+// maxScroll returns the first line shown when the transcript is scrolled to the end
+func (m ChatModel) maxScroll(lines int) int {
+	return max(0, lines-m.chatBoxHeight())
+}
+
+// scrollOffset returns the first line shown of a transcript of the given length
+func (m ChatModel) scrollOffset(lines int) int {
+	if m.autoScroll {
+		return m.maxScroll(lines)
 	}
+	return max(0, min(m.scrollLine, m.maxScroll(lines)))
+}
 
-	// Create chat box with border
-	chatBox := chatBoxStyle.Width(m.width - 2).Height(chatBoxHeight).Render(chatContent)
+// scrollTo shows the transcript from line on. Reaching the end keeps new
+// lines in view until the transcript is scrolled up again.
+func (m *ChatModel) scrollTo(line int) {
+	lines, _ := m.transcript()
+	m.setScroll(line, len(lines))
+}
 
-	// Input area - always 3 lines tall at bottom
-	inputText := "Input: " + m.inputBuffer
-	if m.loading {
-		inputText += " " + getSpinnerChar(m.spinner) + " waiting for response..."
-	}
+// setScroll moves the viewport of a transcript with the given number of lines
+func (m *ChatModel) setScroll(line, lines int) {
+	m.scrollLine = max(0, min(line, m.maxScroll(lines)))
+	m.autoScroll = m.scrollLine == m.maxScroll(lines)
+}
+
+// scrollBy moves the viewport delta lines
+func (m *ChatModel) scrollBy(delta int) {
+	lines, _ := m.transcript()
+	m.setScroll(m.scrollOffset(len(lines))+delta, len(lines))
+}
 
-	// Pad input text to fill 3 lines
-	lines := strings.Split(inputText, "\n")
-	for len(lines) < 3 {
-		lines = append(lines, "")
+// jumpMessage scrolls to the start of the previous or next message
+func (m *ChatModel) jumpMessage(delta int) {
+	lines, starts := m.transcript()
+	offset := m.scrollOffset(len(lines))
+	target := offset
+	for _, start := range starts {
+		if delta < 0 && start < offset {
+			target = start
+		}
+		if delta > 0 && start > offset {
+			target = start
+			break
+		}
 	}
-	inputText = strings.Join(lines[:3], "\n")
+	m.setScroll(target, len(lines))
+}
 
-	// Create input box with border
-	inputBox := inputBoxStyle.Width(m.width - 2).Height(3).Render(inputText)
+// renderReply renders an assistant message as markdown below its label,
+// or returns it unchanged in raw mode
+func (m ChatModel) renderReply(content string) string {
+	if m.raw || m.markdown == nil {
+		return content
+	}
+	return "\n" + m.markdown.Render(content, m.width-4)
+}
 
-	// Compose final layout
-	layout := fmt.Sprintf("%s\n%s\n\n%s\n\n%s", header, status, chatBox, inputBox)
+// toggleRaw switches between rendered markdown and the exact source
+func (m *ChatModel) toggleRaw() {
+	m.raw = !m.raw
+	if m.raw {
+		m.status = "Showing raw text (:raw or Ctrl+R to render markdown)"
+	} else {
+		m.status = "Rendering markdown"
+	}
+}
 
-	return lipgloss.NewStyle().Width(m.width).Height(m.height).Render(layout)
+// chatResult is returned by the chat screen when it closes
+type chatResult struct {
+	Deleted bool // The chat was moved to the trash
 }
 
-// Run starts the GUI interface using Bubble Tea
-func (g *ChatGUI) Run() error {
-	// Set up interrupt handling
-	signal.Notify(g.interruptChan, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(g.interruptChan)
+// done closes the chat screen
+func (m ChatModel) done() tea.Cmd {
+	return screenDone(chatResult{Deleted: m.deleted})
+}
 
-	// Set active chat for interrupt handling
-	activeChatName = g.chatName
-	defer func() {
-		activeChatName = ""
-	}()
+// wantsMouse turns on mouse reporting for scrolling
+func (m ChatModel) wantsMouse() bool {
+	return true
+}
 
-	// Create the model
-	model := ChatModel{
-		chatName:    g.chatName,
-		messages:    g.messages,
-		model:       g.model,
-		inputBuffer: "",
-		width:       80,
-		height:      24,
-		status:      "Ready",
-		quitting:    false,
+// countRole returns the number of messages with the given role
+func (m ChatModel) countRole(role string) int {
+	count := 0
+	for _, msg := range m.messages {
+		if msg.Role == role {
+			count++
+		}
 	}
+	return count
+}
 
-	// Run the program
-	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
-	if _, err := p.Run(); err != nil {
-		return fmt.Errorf("failed to run program: %w", err)
+// updateUnlock handles keys while the chat asks for the vault passphrase
+func (m ChatModel) updateUnlock(msg tea.KeyMsg) ChatModel {
+	switch msg.String() {
+	case "enter":
+		if err := unlockVault(m.passphrase); err != nil {
+			m.status = "Error: " + err.Error()
+		} else {
+			m.unlocking = false
+			m.status = "Vault unlocked"
+		}
+		m.passphrase = ""
+	case "esc":
+		m.unlocking = false
+		m.passphrase = ""
+		m.status = "Vault is still locked"
+	default:
+		m.passphrase, _ = editLine(m.passphrase, msg, false)
 	}
+	return m
+}
 
-	return nil
+// Keys in selection mode
+const selectHelp = "j/k select, ←/→ alternatives, c choose, y copy, 1-9 copy code block, r regenerate, m regenerate with model, e edit, d delete pair, > quote, Esc back"
+
+// startSelecting enters selection mode on the newest message
+func (m *ChatModel) startSelecting() {
+	indices := m.visibleIndices()
+	if len(indices) == 0 {
+		m.status = "No messages to select"
+		return
+	}
+	m.selecting = true
+	m.selected = indices[len(indices)-1]
+	m.status = selectHelp
+	m.showSelected()
 }
 
-// runChatGUI is a wrapper function to start the GUI chat
-func runChatGUI(chatName string, messages []Message, reader *bufio.Reader, model string) {
-	gui := NewChatGUI(chatName, messages, model, reader)
-	if err := gui.Run(); err != nil {
-		fmt.Printf("GUI error: %v\n", err)
+// updateSelect handles keys while a message is selected
+func (m ChatModel) updateSelect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	idx := m.selected
+	switch key := msg.String(); key {
+	case "esc", "i":
+		m.selecting = false
+		m.status = "Ready"
+	case "j", "down":
+		m.moveSelection(1)
+	case "k", "up":
+		m.moveSelection(-1)
+	case "g", "home":
+		m.moveSelection(-len(m.messages))
+	case "G", "end":
+		m.moveSelection(len(m.messages))
+	case "pgup", "pgdown", "ctrl+u", "ctrl+d":
+		delta := map[string]int{"pgup": -2, "pgdown": 2, "ctrl+u": -1, "ctrl+d": 1}[key]
+		m.scrollBy(delta * m.chatBoxHeight() / 2)
+	case "y":
+		return m, m.copyToClipboard([]string{strconv.Itoa(m.messageNumber(idx))})
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		return m, m.copyToClipboard([]string{strconv.Itoa(m.messageNumber(idx)), "code", key})
+	case ">":
+		m.quoteMessage(idx)
+	case "e":
+		if m.loading {
+			m.status = "Wait for the response before editing"
+		} else if m.messages[idx].Role != "user" {
+			m.status = "Only your own messages can be edited; r regenerates a reply"
+		} else {
+			m.startEdit(idx)
+		}
+	case "d":
+		m.deletePair(idx)
+	case "h", "left", "l", "right":
+		m.swipe(idx, key)
+	case "c":
+		m.chooseReply(idx, true)
+	case "r":
+		return m, m.regenerate(idx, m.model, 1)
+	case "m":
+		return m, m.pickRegenerateModel(idx)
 	}
+	return m, nil
 }
 
-// Refactored MenuModel without callback
-// All menu functions now use the returned model from tea.NewProgram for selection
-// ESC/back returns to the previous menu instead of quitting the app
-// All menu navigation is robust and functional
+// regenerateLast handles ":regen [N]", which replaces the last reply with
+// N alternatives generated at once
+func (m *ChatModel) regenerateLast(args []string) tea.Cmd {
+	const usage = "Usage: :regen [N] (1 to 5 alternatives of the last reply)"
+	n := 1
+	if len(args) > 1 {
+		m.status = usage
+		return nil
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 || n > maxAlternatives {
+			m.status = usage
+			return nil
+		}
+	}
+	indices := m.visibleIndices()
+	if len(indices) == 0 {
+		m.status = "Nothing to regenerate yet"
+		return nil
+	}
+	return m.regenerate(indices[len(indices)-1], m.model, n)
+}
 
-type MenuModel struct {
-	title    string
-	options  []string
-	selected int
-	quitting bool
+// pickCompareModels handles ":compare", which asks which models the next
+// message goes to, and ":compare off", which cancels that
+func (m *ChatModel) pickCompareModels(args []string) tea.Cmd {
+	if len(args) == 1 && args[0] == "off" {
+		m.compare = nil
+		m.status = "Comparison cancelled"
+		return nil
+	}
+	if len(args) > 0 {
+		m.setCompareModels(args)
+		return nil
+	}
+	config, err := loadModelsConfig()
+	if err != nil {
+		m.status = fmt.Sprintf("Error: %v", err)
+		return nil
+	}
+	var names []string
+	for _, model := range config.Models {
+		names = append(names, model.Name)
+	}
+	if len(names) < minCompareModels {
+		m.status = fmt.Sprintf("Comparing needs at least %d models in models.json", minCompareModels)
+		return nil
+	}
+	menu := MenuModel{
+		title:   fmt.Sprintf("Compare %d to %d models (space marks, Enter confirms)", minCompareModels, maxCompareModels),
+		options: names,
+		multi:   true,
+	}
+	chatName := m.chatName
+	return openDialog(menu, func(result any) tea.Msg {
+		choice, ok := result.(MenuResult)
+		if !ok || choice.Cancelled {
+			return nil
+		}
+		var models []string
+		for _, i := range choice.Chosen {
+			models = append(models, names[i])
+		}
+		return compareModelsMsg{chatName: chatName, models: models}
+	})
 }
 
-type apiKeyMenuModel struct {
-	MenuModel
-	keys      []APIKey
-	activeKey string
+// setCompareModels arms a comparison of the next message across models
+func (m *ChatModel) setCompareModels(models []string) {
+	if len(models) < minCompareModels || len(models) > maxCompareModels {
+		m.status = fmt.Sprintf("Pick %d to %d models to compare", minCompareModels, maxCompareModels)
+		return
+	}
+	m.compare = models
+	m.status = "Your next message goes to " + strings.Join(models, ", ") + " (:compare off cancels)"
 }
 
-func (m MenuModel) Init() tea.Cmd {
-	return nil
+// startCompare sends prompt to the models being compared on a screen of its own
+func (m *ChatModel) startCompare(prompt string) tea.Cmd {
+	screen := newCompareModel(m.chatName, m.messages, prompt, m.compare)
+	m.compare = nil
+	m.input.Reset()
+	m.status = "Comparing models..."
+	chatName := m.chatName
+	return openScreen(screen, func(result any) tea.Msg {
+		r, _ := result.(compareResult)
+		return compareFinishedMsg{chatName: chatName, result: r}
+	})
 }
 
-func (m MenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
-			m.quitting = true
-			return m, tea.Quit
-		case "esc":
-			m.quitting = true
-			return m, tea.Quit
-		case "up", "k":
-			if m.selected > 0 {
-				m.selected--
+// finishCompare adds the winning reply of a comparison to the chat, keeps
+// the others as alternatives when asked to, and continues with the
+// winner's model
+func (m *ChatModel) finishCompare(r compareResult) {
+	if r.Cancelled {
+		m.input.SetValue(r.Prompt)
+		m.status = "Comparison cancelled"
+		return
+	}
+	base := append(slices.Clone(m.messages), Message{Role: "user", Content: r.Prompt})
+	saved := 0
+	if r.SaveAll {
+		for i, reply := range r.Replies {
+			if i == r.Winner || reply == "" {
+				continue
 			}
-		case "down", "j":
-			if m.selected < len(m.options)-1 {
-				m.selected++
+			if err := saveChat(m.chatName, append(slices.Clone(base), Message{Role: "assistant", Content: reply})); err != nil {
+				m.status = fmt.Sprintf("Save error: %v", err)
+				return
 			}
-		case "enter":
-			return m, tea.Quit
+			saved++
 		}
 	}
-	return m, nil
+	m.messages = append(base, Message{Role: "assistant", Content: r.Replies[r.Winner]})
+	if err := saveChat(m.chatName, m.messages); err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	model := r.Models[r.Winner]
+	if err := updateChatMetadata(m.chatName, func(meta *ChatMetadata) {
+		meta.Model = model
+	}); err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	m.model = model
+	m.contextLen = modelContextLength(model)
+	m.autoScroll = true
+	m.refreshBranches()
+	m.chooseReply(len(m.messages)-1, false)
+	m.firstExchangeJobs()
+	m.status = "Continuing with " + model
+	if saved > 0 {
+		m.status += fmt.Sprintf(" (%d other replies kept as alternatives)", saved)
+	}
 }
 
-func (m MenuModel) View() string {
-	if m.quitting {
-		return ""
+// swipe shows the previous or next alternative of message idx
+func (m *ChatModel) swipe(idx int, key string) {
+	if m.loading {
+		m.status = "Wait for the response before switching alternatives"
+		return
 	}
-	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("63"))
-	selectedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("203")).Bold(true)
-	normalStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
-	var options strings.Builder
-	options.WriteString(titleStyle.Render(m.title) + "\n\n")
-	for i, option := range m.options {
-		if i == m.selected {
-			options.WriteString(selectedStyle.Render("> "+option) + "\n")
-		} else {
-			options.WriteString(normalStyle.Render("  "+option) + "\n")
-		}
+	delta := 1
+	if key == "h" || key == "left" {
+		delta = -1
 	}
-	help := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("\nUse ↑↓ to navigate, Enter to select, Esc to go back")
-	return options.String() + help
+	m.switchBranchAt(idx, delta)
+	m.showSelected()
 }
 
-// Main menu
-func RunGUIMainMenu() error {
-	for {
-		mainMenuOptions := []string{"Chats", "Favorites", "Prompts", "Models", "API Key", "Exit"}
-		model := MenuModel{
-			title:    "Main Menu",
-			options:  mainMenuOptions,
-			selected: 0,
-			quitting: false,
+// chooseReply records message idx as the pick among its alternatives.
+// Explicit picks report it; implicit ones, made by continuing the chat,
+// are silent and skip messages without alternatives.
+func (m *ChatModel) chooseReply(idx int, explicit bool) {
+	if idx < 0 || idx >= len(m.messages) || m.messages[idx].Role != "assistant" {
+		if explicit {
+			m.status = "Only replies can be chosen"
 		}
-		p := tea.NewProgram(model, tea.WithAltScreen())
-		finalModel, err := p.Run()
-		if err != nil {
-			return fmt.Errorf("failed to run main menu: %w", err)
+		return
+	}
+	if idx >= len(m.branches) || m.branches[idx].Count < 2 {
+		if explicit {
+			m.status = "This reply has no alternatives"
+		}
+		return
+	}
+	if m.branches[idx].Chosen && !explicit {
+		return
+	}
+	err := updateChat(m.chatName, func(chatFile *ChatFile) {
+		setChosen(chatFile, idx)
+	})
+	if err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	m.refreshBranches()
+	if explicit {
+		pos := m.branches[idx]
+		m.status = fmt.Sprintf("Chose alternative %d/%d to continue the chat", pos.Index, pos.Count)
+	}
+}
+
+// moveSelection selects the message delta visible messages away
+func (m *ChatModel) moveSelection(delta int) {
+	indices := m.visibleIndices()
+	pos := slices.Index(indices, m.selected)
+	if pos < 0 || len(indices) == 0 {
+		m.selecting = false
+		return
+	}
+	m.selected = indices[max(0, min(len(indices)-1, pos+delta))]
+	m.showSelected()
+}
+
+// showSelected scrolls the selected message into view, showing its start
+// when it does not fit
+func (m *ChatModel) showSelected() {
+	lines, starts := m.transcript()
+	pos := slices.Index(m.visibleIndices(), m.selected)
+	if pos < 0 || pos >= len(starts) {
+		return
+	}
+	start, end := starts[pos], len(lines)
+	if pos+1 < len(starts) {
+		end = starts[pos+1] - 1
+	}
+	offset, height := m.scrollOffset(len(lines)), m.chatBoxHeight()
+	if start < offset {
+		m.setScroll(start, len(lines))
+	} else if end > offset+height {
+		m.setScroll(min(start, end-height), len(lines))
+	}
+}
+
+// messageNumber returns the number shown for message idx
+func (m ChatModel) messageNumber(idx int) int {
+	return slices.Index(m.visibleIndices(), idx) + 1
+}
+
+// startEdit puts user message idx into the input to be changed and resent
+func (m *ChatModel) startEdit(idx int) {
+	m.selecting = false
+	m.editing = true
+	m.editIndex = idx
+	m.input.SetValue(m.messages[idx].Content)
+	m.status = "Editing message; Enter resends on a new branch, Esc cancels"
+}
+
+// quoteMessage adds message idx to the input as a markdown quote
+func (m *ChatModel) quoteMessage(idx int) {
+	lines := strings.Split(strings.TrimSpace(m.messages[idx].Content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	value := m.input.Value()
+	if value != "" && !strings.HasSuffix(value, "\n") {
+		value += "\n\n"
+	}
+	m.input.SetValue(value + strings.Join(lines, "\n") + "\n\n")
+	m.selecting = false
+	m.status = fmt.Sprintf("Quoted message %d", m.messageNumber(idx))
+}
+
+// deletePair removes message idx together with the other half of its
+// exchange. The removed messages stay in the tree on the previous branch.
+func (m *ChatModel) deletePair(idx int) {
+	if m.loading {
+		m.status = "Wait for the response before deleting messages"
+		return
+	}
+	start, end := idx, idx+1
+	if m.messages[idx].Role == "user" && end < len(m.messages) && m.messages[end].Role == "assistant" {
+		end++
+	}
+	if m.messages[idx].Role == "assistant" && start > 0 && m.messages[start-1].Role == "user" {
+		start--
+	}
+	number := m.messageNumber(start)
+	m.messages = append(slices.Clone(m.messages[:start]), m.messages[end:]...)
+	if err := saveChat(m.chatName, m.messages); err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	m.refreshBranches()
+	m.status = fmt.Sprintf("Deleted %d message(s) from #%d; the previous branch keeps them", end-start, number)
+	indices := m.visibleIndices()
+	if len(indices) == 0 {
+		m.selecting = false
+		return
+	}
+	// Select the message that took the deleted pair's place
+	m.selected = indices[len(indices)-1]
+	for _, i := range indices {
+		if i >= start {
+			m.selected = i
+			break
+		}
+	}
+	m.showSelected()
+}
+
+// regenerate asks model for n new versions of reply idx, or of the reply
+// to user message idx. New replies start branches, so the old one and
+// anything after it are kept.
+func (m *ChatModel) regenerate(idx int, model string, n int) tea.Cmd {
+	if m.loading {
+		m.status = "Wait for the response before regenerating"
+		return nil
+	}
+	keep := idx
+	if m.messages[idx].Role == "user" {
+		keep = idx + 1
+	}
+	m.selecting = false
+	m.editing = false
+	m.restore = m.messages
+	m.messages = slices.Clone(m.messages[:keep])
+	cmd := m.send(model, n)
+	if model != m.model {
+		m.status = "Regenerating with " + model + "..."
+	}
+	if n > 1 {
+		m.status = fmt.Sprintf("Generating %d alternatives...", n)
+	}
+	return cmd
+}
+
+// pickRegenerateModel asks which model should regenerate reply idx
+func (m *ChatModel) pickRegenerateModel(idx int) tea.Cmd {
+	if m.loading {
+		return m.regenerate(idx, m.model, 1)
+	}
+	config, err := loadModelsConfig()
+	if err != nil {
+		m.status = fmt.Sprintf("Error: %v", err)
+		return nil
+	}
+	var names []string
+	selected := 0
+	for _, model := range config.Models {
+		if model.Name == m.model {
+			selected = len(names)
+		}
+		names = append(names, model.Name)
+	}
+	if len(names) == 0 {
+		m.status = "No models configured"
+		return nil
+	}
+	menu := MenuModel{title: "Regenerate with", options: names, selected: selected}
+	chatName := m.chatName
+	return openDialog(menu, func(result any) tea.Msg {
+		choice, ok := result.(MenuResult)
+		if !ok || choice.Cancelled {
+			return nil
+		}
+		return regenerateMsg{chatName: chatName, index: idx, model: names[choice.Selected], count: 1}
+	})
+}
+
+func (m ChatModel) View() string {
+	// Styles
+	theme := currentSettings().UI.Colors
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Title))
+	statusStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Muted))
+	loadingStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Loading)).Bold(true)
+
+	// Box styles with borders
+	chatBoxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(theme.Border)).
+		Padding(0, 1)
+
+	inputBoxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(theme.Border)).
+		Padding(0, 1)
+
+	// Calculate layout dimensions
+	inputHeight := m.inputHeight() // Grows with the input
+	chatBoxHeight := m.chatBoxHeight()
+	lines, _ := m.transcript()
+	offset := m.scrollOffset(len(lines))
+
+	// Header
+	scrollIndicator := ""
+	if len(lines) > chatBoxHeight {
+		scrollIndicator = fmt.Sprintf(" [Lines %d-%d/%d]", offset+1, offset+chatBoxHeight, len(lines))
+	}
+	header := titleStyle.Render(fmt.Sprintf("Chat: %s | Model: %s | Messages: %d%s", m.title, m.model, len(m.messages), scrollIndicator))
+	if m.contextLen > 0 {
+		tokens := estimateTokens(m.messages)
+		gaugeStyle := statusStyle
+		if tokens > m.contextLen {
+			gaugeStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Error)).Bold(true)
+		}
+		header += " " + gaugeStyle.Render("Context: "+contextGauge(tokens, m.contextLen))
+	}
+
+	// Status
+	statusText := m.status
+	if m.loading {
+		statusText = loadingStyle.Render(getSpinnerChar(m.spinner) + " " + m.status)
+	}
+
+	if m.jobStatus != "" {
+		statusText += " | " + m.jobStatus
+	}
+
+	// Add scroll help if the transcript does not fit
+	if len(lines) > chatBoxHeight {
+		statusText += " | PgUp/PgDn, Ctrl+U/D, Ctrl+↑↓ or the wheel to scroll"
+	}
+	status := statusStyle.Render(statusText)
+
+	// Show the lines in the viewport, padded at the top so that a short
+	// chat sits above the input
+	visible := lines[offset:min(offset+chatBoxHeight, len(lines))]
+	if len(visible) < chatBoxHeight {
+		visible = append(make([]string, chatBoxHeight-len(visible)), visible...)
+	}
+
+	chatContent := strings.Join(visible, "\n")
+	if len(lines) == 0 {
+		chatContent = "No messages yet..."
+	}
+
+	// Create chat box with border
+	chatBox := chatBoxStyle.Width(m.width - 2).Height(chatBoxHeight).Render(chatContent)
+
+	// Input area at the bottom, growing with the text
+	label := "Input:"
+	if m.editing {
+		label = "Edit:"
+	}
+	inputText := m.input.View(!m.loading && !m.selecting)
+	if m.unlocking {
+		label = "Key:"
+		inputText = "Passphrase: " + maskText(m.passphrase)
+	}
+	if m.loading {
+		inputText += "\n" + loadingStyle.Render(getSpinnerChar(m.spinner)+" waiting for response...")
+	}
+	inputText = lipgloss.JoinHorizontal(lipgloss.Top, lipgloss.NewStyle().Width(inputLabelWidth).Render(label), inputText)
+
+	// Create input box with border
+	inputBox := inputBoxStyle.Width(m.width - 2).Height(inputHeight).Render(inputText)
+
+	// Compose final layout
+	layout := fmt.Sprintf("%s\n%s\n\n%s\n\n%s", header, status, chatBox, inputBox)
+
+	return lipgloss.NewStyle().Width(m.width).Height(m.height).Render(layout)
+}
+
+// Run starts the GUI interface using Bubble Tea
+func (g *ChatGUI) Run() error {
+	// Set up interrupt handling
+	signal.Notify(g.interruptChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(g.interruptChan)
+
+	// Set active chat for interrupt handling
+	activeChatName = g.chatName
+	defer func() {
+		activeChatName = ""
+	}()
+
+	// Create the model
+	model := ChatModel{
+		chatName:   g.chatName,
+		title:      loadChatTitle(g.chatName),
+		messages:   g.messages,
+		model:      g.model,
+		input:      newChatInput(),
+		markdown:   NewMarkdownRenderer(),
+		autoScroll: true,
+		width:      80,
+		height:     24,
+		status:     "Ready",
+		quitting:   false,
+		contextLen: modelContextLength(g.model),
+	}
+	model.refreshBranches()
+
+	result, err := runScreen[chatResult](model, false)
+	if err != nil {
+		return fmt.Errorf("failed to run chat: %w", err)
+	}
+	if result.Deleted {
+		return nil
+	}
+
+	// Refresh the summary, and a placeholder title, now that the chat is closed
+	if chatFile, err := loadChatWithMetadata(g.chatName); err == nil && len(chatFile.Messages) > 1 {
+		jobRunner.Enqueue(backgroundJob{Kind: jobSummary, ChatID: g.chatName, Model: g.model})
+		if chatFile.Metadata.PlaceholderTitle {
+			jobRunner.Enqueue(backgroundJob{Kind: jobTitle, ChatID: g.chatName, Model: g.model})
+		}
+	}
+
+	// Fold this session's journal into the snapshot
+	return compactChat(g.chatName)
+}
+
+// runChatGUI is a wrapper function to start the GUI chat
+func runChatGUI(chatName string, messages []Message, reader *bufio.Reader, model string) {
+	gui := NewChatGUI(chatName, messages, model, reader)
+	if err := gui.Run(); err != nil {
+		handleError(err, "chat")
+	}
+}
+
+// MenuModel lets the user pick one option, or several in multi-select mode.
+// Esc goes back to the previous menu; the choice is reported as a MenuResult.
+type MenuModel struct {
+	title     string
+	options   []string
+	selected  int
+	quitting  bool
+	tags      [][]string   // Tags of each option; enables filtering with 't'
+	tagFilter string       // Only options carrying this tag are shown
+	multi     bool         // Allow choosing several options with space
+	chosen    map[int]bool // Options chosen in multi-select mode
+	allowNone bool         // Enter may confirm an empty multi-selection
+}
+
+type apiKeyMenuModel struct {
+	MenuModel
+	keys      []APIKey
+	activeKey string
+}
+
+func (m MenuModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m MenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.quitting = true
+			return m, m.done()
+		case "up", "k":
+			m.step(-1)
+		case "down", "j":
+			m.step(1)
+		case "t":
+			m.cycleTagFilter()
+		case " ":
+			if m.multi && m.visible(m.selected) {
+				if m.chosen == nil {
+					m.chosen = make(map[int]bool)
+				}
+				m.chosen[m.selected] = !m.chosen[m.selected]
+			}
+		case "enter":
+			if !m.visible(m.selected) {
+				return m, nil
+			}
+			if m.multi && !m.allowNone && len(m.chosenIndices()) == 0 {
+				m.chosen = map[int]bool{m.selected: true}
+			}
+			return m, m.done()
+		}
+	}
+	return m, nil
+}
+
+// done closes the menu, reporting the selection or that it was cancelled
+func (m MenuModel) done() tea.Cmd {
+	return screenDone(MenuResult{Selected: m.selected, Chosen: m.chosenIndices(), Cancelled: m.quitting})
+}
+
+// visible reports whether option i passes the tag filter
+func (m MenuModel) visible(i int) bool {
+	if i < 0 || i >= len(m.options) {
+		return false
+	}
+	return m.tagFilter == "" || (i < len(m.tags) && hasTag(m.tags[i], m.tagFilter))
+}
+
+// step moves the selection to the next visible option in direction delta
+func (m *MenuModel) step(delta int) {
+	for i := m.selected + delta; i >= 0 && i < len(m.options); i += delta {
+		if m.visible(i) {
+			m.selected = i
+			return
 		}
-		menuModel := finalModel.(MenuModel)
-		if menuModel.quitting || menuModel.selected == len(mainMenuOptions)-1 {
+	}
+}
+
+// cycleTagFilter switches the filter to the next tag used by the options
+func (m *MenuModel) cycleTagFilter() {
+	var tags []string
+	for _, optionTags := range m.tags {
+		tags = append(tags, optionTags...)
+	}
+	tags = normalizeTags(tags)
+	if len(tags) == 0 {
+		return
+	}
+	// Cycle through every tag, then back to showing everything
+	next := tags[0]
+	if m.tagFilter != "" {
+		next = ""
+		for i, tag := range tags {
+			if tag == m.tagFilter && i+1 < len(tags) {
+				next = tags[i+1]
+			}
+		}
+	}
+	m.tagFilter = next
+	if !m.visible(m.selected) {
+		m.selected = -1
+		m.step(1)
+		if m.selected < 0 {
+			m.selected = 0
+		}
+	}
+}
+
+// chosenIndices returns the options chosen in multi-select mode, in order
+func (m MenuModel) chosenIndices() []int {
+	var indices []int
+	for i := range m.options {
+		if m.chosen[i] && m.visible(i) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+func (m MenuModel) View() string {
+	theme := currentSettings().UI.Colors
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Title))
+	selectedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Accent)).Bold(true)
+	normalStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Text))
+	var options strings.Builder
+	options.WriteString(titleStyle.Render(m.title) + "\n\n")
+	if m.tagFilter != "" {
+		options.WriteString(normalStyle.Render("Tag: #"+m.tagFilter) + "\n\n")
+	}
+	shown := 0
+	for i, option := range m.options {
+		if !m.visible(i) {
+			continue
+		}
+		shown++
+		if m.multi {
+			mark := "[ ] "
+			if m.chosen[i] {
+				mark = "[x] "
+			}
+			option = mark + option
+		}
+		if i == m.selected {
+			options.WriteString(selectedStyle.Render("> "+option) + "\n")
+		} else {
+			options.WriteString(normalStyle.Render("  "+option) + "\n")
+		}
+	}
+	if shown == 0 {
+		options.WriteString(normalStyle.Render("  (nothing tagged #"+m.tagFilter+")") + "\n")
+	}
+	helpText := "\nUse ↑↓ to navigate, Enter to select, Esc to go back"
+	if m.multi {
+		helpText += ", Space to mark"
+	}
+	if len(m.tags) > 0 {
+		helpText += ", t to filter by tag"
+	}
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Muted)).Render(helpText)
+	return options.String() + help
+}
+
+// RunGUIMainMenu takes over the terminal and shows the main menu until
+// the user exits
+func RunGUIMainMenu() error {
+	return runTUI(mainMenu)
+}
+
+// mainMenu runs the main menu flow
+func mainMenu() error {
+	for {
+		// The vault locks itself after a while without use
+		if vaultLocked() {
+			if err := unlockVaultInteractive(); err != nil {
+				return err
+			}
+		}
+		mainMenuOptions := []string{"Chats", "Favorites", "Prompts", "Models", "API Key", "Profiles", "Settings", "Logs", "Exit"}
+		model := MenuModel{
+			title:    "Main Menu",
+			options:  mainMenuOptions,
+			selected: 0,
+			quitting: false,
+		}
+		choice, err := runMenu(model)
+		if err != nil {
+			return fmt.Errorf("failed to run main menu: %w", err)
+		}
+		if choice.Cancelled || choice.Selected == len(mainMenuOptions)-1 {
 			return nil
 		}
-		switch mainMenuOptions[menuModel.selected] {
+		switch mainMenuOptions[choice.Selected] {
 		case "Chats":
 			if err := GUIMenuChats(); err != nil {
 				return err
@@ -752,6 +1568,18 @@ func RunGUIMainMenu() error {
 			if err := GUIMenuAPIKey(); err != nil {
 				return err
 			}
+		case "Profiles":
+			if err := GUIMenuProfiles(); err != nil {
+				return err
+			}
+		case "Settings":
+			if err := GUIMenuSettings(); err != nil {
+				return err
+			}
+		case "Logs":
+			if err := GUILogViewer(); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -759,23 +1587,21 @@ func RunGUIMainMenu() error {
 // Example for GUIMenuChats (apply this pattern to all menus)
 func GUIMenuChats() error {
 	for {
-		options := []string{"List chats", "Load chat", "New chat", "Custom chat", "Back"}
+		options := []string{"List chats", "Load chat", "New chat", "Custom chat", "New debate", "Browse by tag", "Browse by folder", "Organize chats", "Export chat", "Import chats", "Delete chat", "Trash", "Back"}
 		model := MenuModel{
 			title:    "Chats Menu",
 			options:  options,
 			selected: 0,
 			quitting: false,
 		}
-		p := tea.NewProgram(model, tea.WithAltScreen())
-		finalModel, err := p.Run()
+		choice, err := runMenu(model)
 		if err != nil {
 			return fmt.Errorf("failed to run chats menu: %w", err)
 		}
-		menuModel := finalModel.(MenuModel)
-		if menuModel.quitting || menuModel.selected == len(options)-1 {
+		if choice.Cancelled || choice.Selected == len(options)-1 {
 			return nil
 		}
-		switch options[menuModel.selected] {
+		switch options[choice.Selected] {
 		case "List chats":
 			if err := GUIListChats(); err != nil {
 				return err
@@ -792,991 +1618,1927 @@ func GUIMenuChats() error {
 			if err := GUICustomChat(); err != nil {
 				return err
 			}
-		}
-	}
-}
-
+		case "New debate":
+			if err := GUINewDebate(); err != nil {
+				return err
+			}
+		case "Browse by tag":
+			if err := GUIBrowseTags(); err != nil {
+				return err
+			}
+		case "Browse by folder":
+			if err := GUIBrowseFolders(); err != nil {
+				return err
+			}
+		case "Organize chats":
+			if err := GUIOrganizeChats(); err != nil {
+				return err
+			}
+		case "Export chat":
+			if err := GUIExportChat(); err != nil {
+				return err
+			}
+		case "Import chats":
+			if err := GUIImportChats(); err != nil {
+				return err
+			}
+		case "Delete chat":
+			if err := GUIDeleteChat(); err != nil {
+				return err
+			}
+		case "Trash":
+			if err := GUIMenuTrash(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 // Example for GUILoadChat (apply this pattern to all list/select menus)
 func GUILoadChat() error {
 	chats, err := listChats()
 	if err != nil {
 		return err
 	}
-	if len(chats) == 0 {
-		showMessage("No saved chats.", "Load Chat")
+	if len(chats) == 0 {
+		showMessage("No saved chats.", "Load Chat")
+		return nil
+	}
+	entries := loadChatEntries(chats)
+	choice, err := runMenu(newChatMenu("Select Chat to Load", entries))
+	if err != nil {
+		return fmt.Errorf("failed to run load chat: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(entries) {
+		openChat(entries[choice.Selected].ID)
+	}
+	return nil
+}
+
+// newChatMenu builds a menu of chats showing favorites and tags, filterable by tag
+func newChatMenu(title string, entries []chatEntry) MenuModel {
+	model := MenuModel{
+		title:    title,
+		selected: 0,
+		quitting: false,
+	}
+	for _, entry := range entries {
+		model.options = append(model.options, chatOption(entry))
+		model.tags = append(model.tags, entry.Meta.Tags)
+	}
+	return model
+}
+
+// chatOption formats a chat for a menu as its title, favorite mark and tags
+func chatOption(entry chatEntry) string {
+	option := entry.Title()
+	if entry.Meta.Favorite {
+		option += " ★"
+	}
+	for _, tag := range entry.Meta.Tags {
+		option += " #" + tag
+	}
+	return option
+}
+
+// openChat loads a chat and opens it in the chat interface
+func openChat(chatName string) {
+	chatFile, err := loadChatWithMetadata(chatName)
+	if err != nil {
+		showMessage("Failed to load chat: "+err.Error(), "Error")
+		return
+	}
+	model := chatFile.Metadata.Model
+	if model == "" {
+		model = DefaultModel()
+	}
+	runChatGUI(chatName, chatFile.Messages, nil, model)
+}
+
+// GUIMenuFavorites displays the Favorites menu
+func GUIMenuFavorites() error {
+	for {
+		options := []string{"List favorites", "Load favorite", "Back"}
+		model := MenuModel{
+			title:    "Favorites Menu",
+			options:  options,
+			selected: 0,
+			quitting: false,
+		}
+		choice, err := runMenu(model)
+		if err != nil {
+			return fmt.Errorf("failed to run favorites menu: %w", err)
+		}
+		if choice.Cancelled || choice.Selected == len(options)-1 {
+			return nil
+		}
+		switch options[choice.Selected] {
+		case "List favorites":
+			if err := GUIListFavorites(); err != nil {
+				return err
+			}
+		case "Load favorite":
+			if err := GUILoadFavorite(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GUIListFavorites displays a list of favorite chats
+func GUIListFavorites() error {
+	favorites, err := listFavoriteChats()
+	if err != nil {
+		return err
+	}
+	if len(favorites) == 0 {
+		showMessage("No favorite chats.", "Favorites List")
+		return nil
+	}
+
+	entries := loadChatEntries(favorites)
+	choice, err := runMenu(newChatMenu("Favorite Chats", entries))
+	if err != nil {
+		return fmt.Errorf("failed to run favorites list: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(entries) {
+		chatName := entries[choice.Selected].ID
+		err := updateChatMetadata(chatName, func(meta *ChatMetadata) {
+			meta.Favorite = !meta.Favorite
+		})
+		if err == nil {
+			// Refresh the list
+			return GUIListFavorites()
+		}
+	}
+	return nil
+}
+
+// GUILoadFavorite lets the user select and open a favorite chat
+func GUILoadFavorite() error {
+	favorites, err := listFavoriteChats()
+	if err != nil {
+		return err
+	}
+	if len(favorites) == 0 {
+		showMessage("No favorite chats.", "Load Favorite")
+		return nil
+	}
+
+	entries := loadChatEntries(favorites)
+	choice, err := runMenu(newChatMenu("Select Favorite to Load", entries))
+	if err != nil {
+		return fmt.Errorf("failed to run load favorite: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(entries) {
+		openChat(entries[choice.Selected].ID)
+	}
+	return nil
+}
+
+// GUIMenuPrompts displays the Prompts menu
+func GUIMenuPrompts() error {
+	for {
+		options := []string{"List prompts", "Add prompt", "Set default", "Remove prompt", "Back"}
+		model := MenuModel{
+			title:    "Prompts Menu",
+			options:  options,
+			selected: 0,
+			quitting: false,
+		}
+		choice, err := runMenu(model)
+		if err != nil {
+			return fmt.Errorf("failed to run prompts menu: %w", err)
+		}
+		if choice.Cancelled || choice.Selected == len(options)-1 {
+			return nil
+		}
+		switch options[choice.Selected] {
+		case "List prompts":
+			if err := GUIListPrompts(); err != nil {
+				return err
+			}
+		case "Add prompt":
+			if err := GUIAddPrompt(); err != nil {
+				return err
+			}
+		case "Set default":
+			if err := GUISetDefaultPrompt(); err != nil {
+				return err
+			}
+		case "Remove prompt":
+			if err := GUIRemovePrompt(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GUIListPrompts displays a list of prompts
+func GUIListPrompts() error {
+	prompts, err := loadPrompts()
+	if err != nil {
+		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		return nil
+	}
+
+	var formattedPrompts []string
+	for _, prompt := range prompts {
+		mark := " "
+		if prompt.Default {
+			mark = "*"
+		}
+		if prompt.Project {
+			mark += " [project]"
+		}
+		formattedPrompts = append(formattedPrompts, fmt.Sprintf("%s %s", prompt.Name, mark))
+	}
+
+	model := MenuModel{
+		title:    "Prompts",
+		options:  formattedPrompts,
+		selected: 0,
+		quitting: false,
+	}
+
+	choice, err := runMenu(model)
+	if err != nil {
+		return fmt.Errorf("failed to run prompts list: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(prompts) {
+		prompt := prompts[choice.Selected]
+		details := fmt.Sprintf("Name: %s\n\nContent:\n%s", prompt.Name, prompt.Content)
+		showMessage(details, "Prompt Details")
+	}
+	return nil
+}
+
+// GUIAddPrompt adds a new prompt with clipboard support
+func GUIAddPrompt() error {
+	// First, prompt for the prompt name
+	nameModel := InputModel{
+		title:     "Add Prompt",
+		prompt:    "Enter a name for this prompt:",
+		input:     "",
+		multiline: false,
+	}
+
+	nameAnswer, err := runInput(nameModel)
+	if err != nil {
+		return fmt.Errorf("failed to run name input: %w", err)
+	}
+	if nameAnswer.Cancelled {
+		return nil
+	}
+
+	name := strings.TrimSpace(nameAnswer.Value)
+	if name == "" {
+		showMessage("Prompt name cannot be empty.", "Error")
+		return nil
+	}
+
+	// Check if prompt name already exists
+	prompts, err := loadPrompts()
+	if err != nil {
+		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		return nil
+	}
+
+	for _, prompt := range prompts {
+		if prompt.Name == name {
+			showMessage("A prompt with this name already exists.", "Error")
+			return nil
+		}
+	}
+
+	// Now prompt for the prompt content with clipboard option
+	contentModel := InputModel{
+		title:     "Add Prompt Content",
+		prompt:    "Enter the prompt content (or submit it empty to paste from the clipboard):",
+		input:     "",
+		multiline: true,
+		optional:  true,
+	}
+
+	contentAnswer, err := runInput(contentModel)
+	if err != nil {
+		return fmt.Errorf("failed to run content input: %w", err)
+	}
+	if contentAnswer.Cancelled {
+		return nil
+	}
+
+	content := strings.TrimSpace(contentAnswer.Value)
+
+	// If content is empty, try to read from clipboard
+	if content == "" {
+		clipOut, err := readClipboard()
+		if err != nil {
+			showMessage("Failed to read clipboard: "+err.Error()+"\nPlease enter the prompt content manually.", "Error")
+			return nil
+		}
+
+		content = strings.TrimSpace(clipOut)
+		if content == "" {
+			showMessage("Clipboard is empty. Please enter the prompt content manually.", "Error")
+			return nil
+		}
+
+		showMessage("Content read from clipboard successfully.", "Info")
+	}
+
+	// Add the new prompt
+	newPrompt := Prompt{
+		Name:    name,
+		Content: content,
+		Default: false,
+	}
+
+	prompts = append(prompts, newPrompt)
+
+	if err := savePrompts(prompts); err != nil {
+		showMessage("Failed to save prompt: "+err.Error(), "Error")
+		return nil
+	}
+
+	showMessage(fmt.Sprintf("Prompt '%s' added successfully.", name), "Success")
+	return nil
+}
+
+// GUISetDefaultPrompt sets a prompt as default
+func GUISetDefaultPrompt() error {
+	prompts, err := loadPrompts()
+	if err != nil {
+		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		return nil
+	}
+
+	var formattedPrompts []string
+	for _, prompt := range prompts {
+		mark := " "
+		if prompt.Default {
+			mark = "*"
+		}
+		formattedPrompts = append(formattedPrompts, fmt.Sprintf("%s %s", prompt.Name, mark))
+	}
+
+	model := MenuModel{
+		title:    "Select Prompt to Set as Default",
+		options:  formattedPrompts,
+		selected: 0,
+		quitting: false,
+	}
+
+	choice, err := runMenu(model)
+	if err != nil {
+		return fmt.Errorf("failed to run set default prompt: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(prompts) {
+		prompt := prompts[choice.Selected]
+		if prompt.Project {
+			showMessage("Project prompts cannot be the default; edit "+projectPromptsPath()+" instead.", "Error")
+			return nil
+		}
+		if err := setPromptAsDefault(prompt.Name); err == nil {
+			showMessage(fmt.Sprintf("Set '%s' as default prompt.", prompt.Name), "Success")
+		} else {
+			showMessage("Failed to set default prompt: "+err.Error(), "Error")
+		}
+	}
+	return nil
+}
+
+// GUIRemovePrompt removes a prompt
+func GUIRemovePrompt() error {
+	prompts, err := loadPrompts()
+	if err != nil {
+		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		return nil
+	}
+
+	if len(prompts) == 0 {
+		showMessage("No prompts to remove.", "Remove Prompt")
+		return nil
+	}
+
+	var formattedPrompts []string
+	for _, prompt := range prompts {
+		mark := " "
+		if prompt.Default {
+			mark = "*"
+		}
+		formattedPrompts = append(formattedPrompts, fmt.Sprintf("%s %s", prompt.Name, mark))
+	}
+
+	model := MenuModel{
+		title:    "Select Prompt to Remove",
+		options:  formattedPrompts,
+		selected: 0,
+		quitting: false,
+	}
+
+	choice, err := runMenu(model)
+	if err != nil {
+		return fmt.Errorf("failed to run remove prompt: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(prompts) {
+		prompt := prompts[choice.Selected]
+		if prompt.Project {
+			showMessage("Project prompts are removed by editing "+projectPromptsPath()+".", "Error")
+			return nil
+		}
+		if prompt.Default {
+			showMessage("Cannot remove the default prompt. Please set another prompt as default first.", "Error")
+			return nil
+		}
+
+		// Remove the prompt
+		newPrompts := make([]Prompt, 0, len(prompts)-1)
+		for _, p := range prompts {
+			if p.Name != prompt.Name {
+				newPrompts = append(newPrompts, p)
+			}
+		}
+
+		if err := savePrompts(newPrompts); err == nil {
+			showMessage(fmt.Sprintf("Removed prompt '%s'.", prompt.Name), "Success")
+		} else {
+			showMessage("Failed to remove prompt: "+err.Error(), "Error")
+		}
+	}
+	return nil
+}
+
+// GUIMenuModels displays the Models menu
+func GUIMenuModels() error {
+	for {
+		options := []string{"List models", "Add model", "Set default", "Remove model", "Back"}
+		model := MenuModel{
+			title:    "Models Menu",
+			options:  options,
+			selected: 0,
+			quitting: false,
+		}
+		choice, err := runMenu(model)
+		if err != nil {
+			return fmt.Errorf("failed to run models menu: %w", err)
+		}
+		if choice.Cancelled || choice.Selected == len(options)-1 {
+			return nil
+		}
+		switch options[choice.Selected] {
+		case "List models":
+			if err := GUIListModels(); err != nil {
+				return err
+			}
+		case "Add model":
+			if err := GUIAddModel(); err != nil {
+				return err
+			}
+		case "Set default":
+			if err := GUISetDefaultModel(); err != nil {
+				return err
+			}
+		case "Remove model":
+			if err := GUIRemoveModel(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GUIListModels displays a list of models
+func GUIListModels() error {
+	models, defaultModel, err := loadModelsWithMostRecent()
+	if err != nil {
+		showMessage("Failed to load models: "+err.Error(), "Error")
+		return nil
+	}
+
+	var formattedModels []string
+	for _, model := range models {
+		mark := " "
+		if model == defaultModel {
+			mark = "*"
+		}
+		formattedModels = append(formattedModels, fmt.Sprintf("%s %s", model, mark))
+	}
+
+	model := MenuModel{
+		title:    "Models",
+		options:  formattedModels,
+		selected: 0,
+		quitting: false,
+	}
+
+	choice, err := runMenu(model)
+	if err != nil {
+		return fmt.Errorf("failed to run models list: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(models) {
+		modelName := models[choice.Selected]
+		details := fmt.Sprintf("Model: %s\nDefault: %t", modelName, modelName == defaultModel)
+		showMessage(details, "Model Details")
+	}
+	return nil
+}
+
+// GUIAddModel adds a new model
+func GUIAddModel() error {
+	showMessage("Add model functionality not yet implemented in GUI.\nUse CLI version for now.", "Add Model")
+	return nil
+}
+
+// GUISetDefaultModel sets a model as default
+func GUISetDefaultModel() error {
+	models, defaultModel, err := loadModelsWithMostRecent()
+	if err != nil {
+		showMessage("Failed to load models: "+err.Error(), "Error")
+		return nil
+	}
+
+	var formattedModels []string
+	for _, model := range models {
+		mark := " "
+		if model == defaultModel {
+			mark = "*"
+		}
+		formattedModels = append(formattedModels, fmt.Sprintf("%s %s", model, mark))
+	}
+
+	model := MenuModel{
+		title:    "Select Model to Set as Default",
+		options:  formattedModels,
+		selected: 0,
+		quitting: false,
+	}
+
+	choice, err := runMenu(model)
+	if err != nil {
+		return fmt.Errorf("failed to run set default model: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(models) {
+		modelName := models[choice.Selected]
+		if err := saveModelsWithMostRecent(modelName, models); err == nil {
+			showMessage(fmt.Sprintf("Set '%s' as default model.", modelName), "Success")
+		} else {
+			showMessage("Failed to set default model: "+err.Error(), "Error")
+		}
+	}
+	return nil
+}
+
+// GUIRemoveModel removes a model
+func GUIRemoveModel() error {
+	showMessage("Remove model functionality not yet implemented in GUI.\nUse CLI version for now.", "Remove Model")
+	return nil
+}
+
+// GUIMenuAPIKey displays the API Key menu
+func GUIMenuAPIKey() error {
+	for {
+		options := []string{"List API keys", "Add API key", "Set active", "Remove API key", "Back"}
+		model := MenuModel{
+			title:    "API Key Menu",
+			options:  options,
+			selected: 0,
+			quitting: false,
+		}
+		choice, err := runMenu(model)
+		if err != nil {
+			return fmt.Errorf("failed to run API key menu: %w", err)
+		}
+		if choice.Cancelled || choice.Selected == len(options)-1 {
+			return nil
+		}
+		switch options[choice.Selected] {
+		case "List API keys":
+			if err := GUIListAPIKeys(); err != nil {
+				return err
+			}
+		case "Add API key":
+			if err := GUIAddAPIKey(); err != nil {
+				return err
+			}
+		case "Set active":
+			if err := GUISetActiveAPIKey(); err != nil {
+				return err
+			}
+		case "Remove API key":
+			if err := GUIRemoveAPIKey(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GUIListAPIKeys displays a list of API keys
+func GUIListAPIKeys() error {
+	keys, activeKey, err := listAPIKeys()
+	if err != nil {
+		showMessage("Failed to load API keys: "+err.Error(), "Error")
+		return nil
+	}
+
+	title := "API Keys"
+	if source := apiKeyOverride(); source != "" {
+		title = fmt.Sprintf("API Keys (requests use %s)", source)
+	}
+
+	var formattedKeys []string
+	for _, key := range keys {
+		mark := " "
+		if key.Title == activeKey {
+			mark = "*"
+		}
+		formattedKeys = append(formattedKeys, fmt.Sprintf("%s %s", key.Title, mark))
+	}
+
+	model := apiKeyMenuModel{
+		MenuModel: MenuModel{
+			title:    title,
+			options:  formattedKeys,
+			selected: 0,
+			quitting: false,
+		},
+		keys:      keys,
+		activeKey: activeKey,
+	}
+
+	choice, err := runScreen[MenuResult](model, false)
+	if err != nil {
+		return fmt.Errorf("failed to run API keys list: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(keys) {
+		key := keys[choice.Selected]
+		details := fmt.Sprintf("Title: %s\nActive: %t", key.Title, key.Title == activeKey)
+		showMessage(details, "API Key Details")
+	}
+	return nil
+}
+
+// InputModel represents a simple input model for getting user input
+type InputModel struct {
+	title     string
+	prompt    string
+	input     string
+	quitting  bool
+	submitted bool
+	multiline bool
+	masked    bool // Hide the typed text, for passphrases
+	optional  bool // Allow submitting an empty value
+}
+
+func (m InputModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m InputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			m.quitting = true
+			return m, m.done()
+		case "enter":
+			if m.multiline {
+				// For multiline input, Enter adds a newline
+				m.input += "\n"
+			} else {
+				// For single line input, Enter submits
+				if m.input != "" || m.optional {
+					m.submitted = true
+					return m, m.done()
+				}
+			}
+		case "ctrl+s":
+			// Ctrl+S submits multiline input
+			if m.multiline && (m.input != "" || m.optional) {
+				m.submitted = true
+				return m, m.done()
+			}
+		default:
+			m.input, _ = editLine(m.input, msg, m.multiline)
+		}
+	}
+	return m, nil
+}
+
+// done closes the input, reporting the text or that it was cancelled
+func (m InputModel) done() tea.Cmd {
+	return screenDone(InputResult{Value: m.input, Cancelled: m.quitting || !m.submitted})
+}
+
+func (m InputModel) View() string {
+	theme := currentSettings().UI.Colors
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Title))
+	promptStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Text))
+	inputStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Accent)).Bold(true)
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Muted))
+
+	helpText := "Press Enter to submit, Esc to cancel"
+	if m.multiline {
+		helpText = "Press Ctrl+S to submit, Esc to cancel"
+	}
+
+	input := m.input
+	if m.masked {
+		input = maskText(m.input)
+	}
+	content := fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s",
+		titleStyle.Render(m.title),
+		promptStyle.Render(m.prompt),
+		inputStyle.Render("> "+input),
+		helpStyle.Render(helpText))
+
+	boxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(theme.Border)).
+		Padding(1, 2).
+		Width(60).
+		Align(lipgloss.Center)
+
+	return boxStyle.Render(content)
+}
+
+// promptPassphrase asks for a passphrase without echoing it. ok is false
+// when the user cancelled.
+func promptPassphrase(title, prompt string) (string, bool, error) {
+	model := InputModel{title: title, prompt: prompt, masked: true}
+	answer, err := runInput(model)
+	if err != nil {
+		return "", false, err
+	}
+	if answer.Cancelled {
+		return "", false, nil
+	}
+	return answer.Value, true, nil
+}
+
+// GUIAddAPIKey adds a new API key by reading from clipboard and prompting for name
+func GUIAddAPIKey() error {
+	// Confirmation prompt
+	confirmModel := InputModel{
+		title:     "Add API Key",
+		prompt:    "Press Enter to read API key from clipboard, or Esc to cancel.",
+		input:     "",
+		multiline: false,
+	}
+	answer, err := runInput(confirmModel)
+	if err != nil {
+		return err
+	}
+	if answer.Cancelled {
 		return nil
 	}
-	var formattedChats []string
-	for _, chat := range chats {
-		chatFile, err := loadChatWithMetadata(chat)
-		favoriteMark := " "
-		if err == nil && chatFile.Metadata.Favorite {
-			favoriteMark = "★"
-		}
-		formattedChats = append(formattedChats, fmt.Sprintf("%s %s", chat, favoriteMark))
+
+	// Read from clipboard
+	clipOut, err := readClipboard()
+	if err != nil {
+		showMessage("Failed to read clipboard: "+err.Error()+"\nPlease copy your API key first.", "Error")
+		return nil
 	}
-	model := MenuModel{
-		title:    "Select Chat to Load",
-		options:  formattedChats,
-		selected: 0,
-		quitting: false,
+	key := strings.TrimSpace(clipOut)
+	if key == "" {
+		showMessage("Clipboard is empty. Please copy your API key first.", "Error")
+		return nil
+	}
+
+	// Prompt for key name
+	nameModel := InputModel{
+		title:  "Add API Key",
+		prompt: "Enter a title for this API key:",
+		input:  "",
 	}
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	nameAnswer, err := runInput(nameModel)
 	if err != nil {
-		return fmt.Errorf("failed to run load chat: %w", err)
+		return err
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if nameAnswer.Cancelled {
 		return nil
 	}
-	if menuModel.selected < len(chats) {
-		chatName := chats[menuModel.selected]
-		chatFile, err := loadChatWithMetadata(chatName)
-		if err != nil {
-			showMessage("Failed to load chat: "+err.Error(), "Error")
-			return nil
-		}
-		model := chatFile.Metadata.Model
-		if model == "" {
-			model = DefaultModel()
-		}
-		runChatGUI(chatName, chatFile.Messages, nil, model)
+	title := strings.TrimSpace(nameAnswer.Value)
+	if title == "" {
+		title = "Default"
 	}
-	return nil
-}
-
-// GUIMenuFavorites displays the Favorites menu
-func GUIMenuFavorites() error {
-	for {
-		options := []string{"List favorites", "Load favorite", "Back"}
-		model := MenuModel{
-			title:    "Favorites Menu",
-			options:  options,
-			selected: 0,
-			quitting: false,
-		}
-		p := tea.NewProgram(model, tea.WithAltScreen())
-		finalModel, err := p.Run()
-		if err != nil {
-			return fmt.Errorf("failed to run favorites menu: %w", err)
-		}
-		menuModel := finalModel.(MenuModel)
-		if menuModel.quitting || menuModel.selected == len(options)-1 {
-			return nil
-		}
-		switch options[menuModel.selected] {
-		case "List favorites":
-			if err := GUIListFavorites(); err != nil {
-				return err
-			}
-		case "Load favorite":
-			if err := GUILoadFavorite(); err != nil {
-				return err
-			}
-		}
+	if err := addAPIKey(title, key); err != nil {
+		showMessage("Failed to add API key: "+err.Error(), "Error")
+		return nil
 	}
+	showMessage(fmt.Sprintf("API key '%s' added successfully.", title), "Success")
+	return nil
 }
 
-// GUIListFavorites displays a list of favorite chats
-func GUIListFavorites() error {
-	favorites, err := listFavoriteChats()
+// GUISetActiveAPIKey sets an API key as active
+func GUISetActiveAPIKey() error {
+	keys, activeKey, err := listAPIKeys()
 	if err != nil {
-		return err
-	}
-	if len(favorites) == 0 {
-		showMessage("No favorite chats.", "Favorites List")
+		showMessage("Failed to load API keys: "+err.Error(), "Error")
 		return nil
 	}
 
+	var formattedKeys []string
+	for _, key := range keys {
+		mark := " "
+		if key.Title == activeKey {
+			mark = "*"
+		}
+		formattedKeys = append(formattedKeys, fmt.Sprintf("%s %s", key.Title, mark))
+	}
+
 	model := MenuModel{
-		title:    "Favorite Chats",
-		options:  favorites,
+		title:    "Select API Key to Set as Active",
+		options:  formattedKeys,
 		selected: 0,
 		quitting: false,
 	}
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	choice, err := runMenu(model)
 	if err != nil {
-		return fmt.Errorf("failed to run favorites list: %w", err)
+		return fmt.Errorf("failed to run set active API key: %w", err)
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if choice.Cancelled {
 		return nil
 	}
-	if menuModel.selected < len(favorites) {
-		chatName := favorites[menuModel.selected]
-		chatFile, err := loadChatWithMetadata(chatName)
-		if err == nil {
-			chatFile.Metadata.Favorite = !chatFile.Metadata.Favorite
-			if err := saveChat(chatName, chatFile.Messages); err == nil {
-				// Refresh the list
-				return GUIListFavorites()
-			}
+	if choice.Selected < len(keys) {
+		key := keys[choice.Selected]
+		if err := setActiveAPIKey(key.Title); err == nil {
+			showMessage(fmt.Sprintf("Set '%s' as active API key.", key.Title), "Success")
+		} else {
+			showMessage("Failed to set active API key: "+err.Error(), "Error")
 		}
 	}
 	return nil
 }
 
-// GUILoadFavorite lets the user select and open a favorite chat
-func GUILoadFavorite() error {
-	favorites, err := listFavoriteChats()
+// GUIRemoveAPIKey removes an API key
+func GUIRemoveAPIKey() error {
+	keys, activeKey, err := listAPIKeys()
 	if err != nil {
-		return err
+		showMessage("Failed to load API keys: "+err.Error(), "Error")
+		return nil
 	}
-	if len(favorites) == 0 {
-		showMessage("No favorite chats.", "Load Favorite")
+
+	if len(keys) == 0 {
+		showMessage("No API keys to remove.", "Remove API Key")
 		return nil
 	}
 
+	var formattedKeys []string
+	for _, key := range keys {
+		mark := " "
+		if key.Title == activeKey {
+			mark = "*"
+		}
+		formattedKeys = append(formattedKeys, fmt.Sprintf("%s %s", key.Title, mark))
+	}
+
 	model := MenuModel{
-		title:    "Select Favorite to Load",
-		options:  favorites,
+		title:    "Select API Key to Remove",
+		options:  formattedKeys,
 		selected: 0,
 		quitting: false,
 	}
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	choice, err := runMenu(model)
 	if err != nil {
-		return fmt.Errorf("failed to run load favorite: %w", err)
+		return fmt.Errorf("failed to run remove API key: %w", err)
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if choice.Cancelled {
 		return nil
 	}
-	if menuModel.selected < len(favorites) {
-		chatName := favorites[menuModel.selected]
-		chatFile, err := loadChatWithMetadata(chatName)
-		if err != nil {
-			showMessage("Failed to load chat: "+err.Error(), "Error")
+	if choice.Selected < len(keys) {
+		key := keys[choice.Selected]
+		if key.Title == activeKey {
+			showMessage("Cannot remove the active API key. Please set another key as active first.", "Error")
 			return nil
 		}
-		model := chatFile.Metadata.Model
-		if model == "" {
-			model = DefaultModel()
+		if err := removeAPIKey(key.Title); err == nil {
+			showMessage(fmt.Sprintf("Removed API key '%s'.", key.Title), "Success")
+		} else {
+			showMessage("Failed to remove API key: "+err.Error(), "Error")
 		}
-		runChatGUI(chatName, chatFile.Messages, nil, model)
 	}
 	return nil
 }
 
-// GUIMenuPrompts displays the Prompts menu
-func GUIMenuPrompts() error {
+// GUIListChats displays a list of recent chats using Bubble Tea
+func GUIListChats() error {
+	chats, err := listChats()
+	if err != nil {
+		showMessage("Failed to list chats: "+err.Error(), "Chats List")
+		return nil
+	}
+	if len(chats) == 0 {
+		showMessage("No saved chats.", "Chats List")
+		return nil
+	}
+	entries := loadChatEntries(chats)
+	choice, err := runMenu(newChatMenu("Recent Chats", entries))
+	if err != nil {
+		return fmt.Errorf("failed to run chat list: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(entries) {
+		// Toggle favorite on selection
+		chatName := entries[choice.Selected].ID
+		err := updateChatMetadata(chatName, func(meta *ChatMetadata) {
+			meta.Favorite = !meta.Favorite
+		})
+		if err == nil {
+			return GUIListChats()
+		}
+	}
+	return nil
+}
+
+// GUIBrowseTags lists every tag and opens a chat carrying the chosen one
+func GUIBrowseTags() error {
+	chats, err := listAllChats()
+	if err != nil {
+		showMessage("Failed to list chats: "+err.Error(), "Browse by Tag")
+		return nil
+	}
+	entries := loadChatEntries(chats)
 	for {
-		options := []string{"List prompts", "Add prompt", "Set default", "Remove prompt", "Back"}
+		counts := tagCounts(entries)
+		if len(counts) == 0 {
+			showMessage("No tagged chats. Tag chats with :tag or Organize chats.", "Browse by Tag")
+			return nil
+		}
+		var options []string
+		for _, tc := range counts {
+			options = append(options, fmt.Sprintf("#%s (%d)", tc.Tag, tc.Count))
+		}
 		model := MenuModel{
-			title:    "Prompts Menu",
+			title:    "Tags",
 			options:  options,
 			selected: 0,
 			quitting: false,
 		}
-		p := tea.NewProgram(model, tea.WithAltScreen())
-		finalModel, err := p.Run()
+		choice, err := runMenu(model)
 		if err != nil {
-			return fmt.Errorf("failed to run prompts menu: %w", err)
+			return fmt.Errorf("failed to run tag list: %w", err)
 		}
-		menuModel := finalModel.(MenuModel)
-		if menuModel.quitting || menuModel.selected == len(options)-1 {
+		if choice.Cancelled {
 			return nil
 		}
-		switch options[menuModel.selected] {
-		case "List prompts":
-			if err := GUIListPrompts(); err != nil {
-				return err
-			}
-		case "Add prompt":
-			if err := GUIAddPrompt(); err != nil {
-				return err
-			}
-		case "Set default":
-			if err := GUISetDefaultPrompt(); err != nil {
-				return err
-			}
-		case "Remove prompt":
-			if err := GUIRemovePrompt(); err != nil {
-				return err
-			}
+		tag := counts[choice.Selected].Tag
+		tagged := chatsWithTag(entries, tag)
+		chatChoice, err := runMenu(newChatMenu("Chats tagged #"+tag, tagged))
+		if err != nil {
+			return fmt.Errorf("failed to run tagged chat list: %w", err)
+		}
+		if !chatChoice.Cancelled && chatChoice.Selected < len(tagged) {
+			openChat(tagged[chatChoice.Selected].ID)
+			return nil
 		}
 	}
 }
 
-// GUIListPrompts displays a list of prompts
-func GUIListPrompts() error {
-	prompts, err := loadPrompts()
+// GUIBrowseFolders walks the folder hierarchy and opens the chosen chat
+func GUIBrowseFolders() error {
+	chats, err := listAllChats()
 	if err != nil {
-		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		showMessage("Failed to list chats: "+err.Error(), "Browse by Folder")
 		return nil
 	}
+	entries := loadChatEntries(chats)
+	folder := ""
+	for {
+		subfolders, filed := folderContents(entries, folder)
+		model := newChatMenu("Folder: /"+folder, filed)
+		// Subfolders come first and carry no tags, so the tag filter hides them
+		var folderOptions []string
+		if folder != "" {
+			folderOptions = append(folderOptions, "..")
+		}
+		for _, sub := range subfolders {
+			folderOptions = append(folderOptions, sub+"/")
+		}
+		model.options = append(folderOptions, model.options...)
+		model.tags = append(make([][]string, len(folderOptions)), model.tags...)
+		if len(model.options) == 0 {
+			showMessage("No chats yet.", "Browse by Folder")
+			return nil
+		}
 
-	var formattedPrompts []string
-	for _, prompt := range prompts {
-		mark := " "
-		if prompt.Default {
-			mark = "*"
+		choice, err := runMenu(model)
+		if err != nil {
+			return fmt.Errorf("failed to run folder browser: %w", err)
 		}
-		formattedPrompts = append(formattedPrompts, fmt.Sprintf("%s %s", prompt.Name, mark))
+		if choice.Cancelled {
+			if folder == "" {
+				return nil
+			}
+			folder = parentFolder(folder)
+			continue
+		}
+		if choice.Selected < len(folderOptions) {
+			option := folderOptions[choice.Selected]
+			if option == ".." {
+				folder = parentFolder(folder)
+			} else {
+				folder = normalizeFolder(folder + "/" + option)
+			}
+			continue
+		}
+		openChat(filed[choice.Selected-len(folderOptions)].ID)
+		return nil
 	}
+}
 
+// GUIOrganizeChats lets the user retag or move several chats at once
+func GUIOrganizeChats() error {
+	options := []string{"Retag chats", "Move chats to folder", "Back"}
 	model := MenuModel{
-		title:    "Prompts",
-		options:  formattedPrompts,
+		title:    "Organize Chats",
+		options:  options,
 		selected: 0,
 		quitting: false,
 	}
-
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("failed to run prompts list: %w", err)
-	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
-		return nil
-	}
-	if menuModel.selected < len(prompts) {
-		prompt := prompts[menuModel.selected]
-		details := fmt.Sprintf("Name: %s\n\nContent:\n%s", prompt.Name, prompt.Content)
-		showMessage(details, "Prompt Details")
-	}
-	return nil
-}
-
-// GUIAddPrompt adds a new prompt with clipboard support
-func GUIAddPrompt() error {
-	// First, prompt for the prompt name
-	nameModel := InputModel{
-		title:     "Add Prompt",
-		prompt:    "Enter a name for this prompt:",
-		input:     "",
-		multiline: false,
-	}
-
-	p := tea.NewProgram(nameModel, tea.WithAltScreen())
-	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("failed to run name input: %w", err)
-	}
-
-	nameInputModel := finalModel.(InputModel)
-	if nameInputModel.quitting || !nameInputModel.submitted {
-		return nil
-	}
-
-	name := strings.TrimSpace(nameInputModel.input)
-	if name == "" {
-		showMessage("Prompt name cannot be empty.", "Error")
-		return nil
-	}
-
-	// Check if prompt name already exists
-	prompts, err := loadPrompts()
+	choice, err := runMenu(model)
 	if err != nil {
-		showMessage("Failed to load prompts: "+err.Error(), "Error")
-		return nil
-	}
-
-	for _, prompt := range prompts {
-		if prompt.Name == name {
-			showMessage("A prompt with this name already exists.", "Error")
-			return nil
-		}
+		return fmt.Errorf("failed to run organize menu: %w", err)
 	}
-
-	// Now prompt for the prompt content with clipboard option
-	contentModel := InputModel{
-		title:     "Add Prompt Content",
-		prompt:    "Enter the prompt content (or press Enter to read from clipboard):",
-		input:     "",
-		multiline: true,
+	if choice.Cancelled || choice.Selected == len(options)-1 {
+		return nil
 	}
+	retag := options[choice.Selected] == "Retag chats"
 
-	p = tea.NewProgram(contentModel, tea.WithAltScreen())
-	finalModel, err = p.Run()
+	chats, err := listAllChats()
 	if err != nil {
-		return fmt.Errorf("failed to run content input: %w", err)
+		showMessage("Failed to list chats: "+err.Error(), "Organize Chats")
+		return nil
 	}
-
-	contentInputModel := finalModel.(InputModel)
-	if contentInputModel.quitting {
+	entries := loadChatEntries(chats)
+	if len(entries) == 0 {
+		showMessage("No saved chats.", "Organize Chats")
 		return nil
 	}
+	chatMenu := newChatMenu("Mark chats with Space, then press Enter", entries)
+	chatMenu.multi = true
+	marked, err := runMenu(chatMenu)
+	if err != nil {
+		return fmt.Errorf("failed to run chat selection: %w", err)
+	}
+	if marked.Cancelled {
+		return nil
+	}
+	var ids []string
+	for _, i := range marked.Chosen {
+		ids = append(ids, entries[i].ID)
+	}
 
-	content := strings.TrimSpace(contentInputModel.input)
-
-	// If content is empty, try to read from clipboard
-	if content == "" {
-		clipCmd := "powershell Get-Clipboard"
-		clipOut, err := execCommand(clipCmd)
-		if err != nil {
-			showMessage("Failed to read clipboard. Please enter the prompt content manually.", "Error")
-			return nil
-		}
-
-		content = strings.TrimSpace(clipOut)
-		if content == "" {
-			showMessage("Clipboard is empty. Please enter the prompt content manually.", "Error")
-			return nil
+	input := InputModel{
+		title:  "Move Chats",
+		prompt: fmt.Sprintf("Folder for %d chats, e.g. work/project-x (/ for none):", len(ids)),
+	}
+	if retag {
+		input = InputModel{
+			title:  "Retag Chats",
+			prompt: fmt.Sprintf("Tags for %d chats; prefix a tag with - to remove it:", len(ids)),
 		}
-
-		showMessage("Content read from clipboard successfully.", "Info")
 	}
-
-	// Add the new prompt
-	newPrompt := Prompt{
-		Name:    name,
-		Content: content,
-		Default: false,
+	answer, err := runInput(input)
+	if err != nil {
+		return fmt.Errorf("failed to run organize input: %w", err)
 	}
-
-	prompts = append(prompts, newPrompt)
-
-	if err := savePrompts(prompts); err != nil {
-		showMessage("Failed to save prompt: "+err.Error(), "Error")
+	if answer.Cancelled {
 		return nil
 	}
 
-	showMessage(fmt.Sprintf("Prompt '%s' added successfully.", name), "Success")
+	if retag {
+		err = retagChats(ids, strings.Fields(answer.Value))
+	} else {
+		err = moveChatsToFolder(ids, answer.Value)
+	}
+	if err != nil {
+		showMessage(err.Error(), "Error")
+		return nil
+	}
+	showMessage(fmt.Sprintf("Updated %d chats.", len(ids)), "Success")
 	return nil
 }
 
-// GUISetDefaultPrompt sets a prompt as default
-func GUISetDefaultPrompt() error {
-	prompts, err := loadPrompts()
+// GUIExportChat exports a chat chosen from the list to a file
+func GUIExportChat() error {
+	chats, err := listAllChats()
 	if err != nil {
-		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		showMessage("Failed to list chats: "+err.Error(), "Export Chat")
 		return nil
 	}
-
-	var formattedPrompts []string
-	for _, prompt := range prompts {
-		mark := " "
-		if prompt.Default {
-			mark = "*"
-		}
-		formattedPrompts = append(formattedPrompts, fmt.Sprintf("%s %s", prompt.Name, mark))
+	entries := loadChatEntries(chats)
+	if len(entries) == 0 {
+		showMessage("No saved chats.", "Export Chat")
+		return nil
+	}
+	choice, err := runMenu(newChatMenu("Select Chat to Export", entries))
+	if err != nil {
+		return fmt.Errorf("failed to run export chat: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
 	}
+	chatID := entries[choice.Selected].ID
 
-	model := MenuModel{
-		title:    "Select Prompt to Set as Default",
-		options:  formattedPrompts,
+	formats := []string{exportMarkdown, exportHTML, exportJSONL}
+	formatMenu := MenuModel{
+		title:    "Export Format",
+		options:  []string{"Markdown", "HTML page", "JSONL (OpenAI chat format)"},
 		selected: 0,
 		quitting: false,
 	}
-
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	format, err := runMenu(formatMenu)
 	if err != nil {
-		return fmt.Errorf("failed to run set default prompt: %w", err)
+		return fmt.Errorf("failed to run export format: %w", err)
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if format.Cancelled {
 		return nil
 	}
-	if menuModel.selected < len(prompts) {
-		prompt := prompts[menuModel.selected]
-		if err := setPromptAsDefault(prompt.Name); err == nil {
-			showMessage(fmt.Sprintf("Set '%s' as default prompt.", prompt.Name), "Success")
-		} else {
-			showMessage("Failed to set default prompt: "+err.Error(), "Error")
-		}
-	}
-	return nil
-}
+	opts := defaultExportOptions(formats[format.Selected])
 
-// GUIRemovePrompt removes a prompt
-func GUIRemovePrompt() error {
-	prompts, err := loadPrompts()
+	optionMenu := MenuModel{
+		title:     "Include (Space to toggle, Enter to export)",
+		options:   []string{"System prompts", "Reasoning", "Metadata"},
+		selected:  0,
+		quitting:  false,
+		multi:     true,
+		chosen:    map[int]bool{2: opts.IncludeMetadata},
+		allowNone: true,
+	}
+	included, err := runMenu(optionMenu)
 	if err != nil {
-		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		return fmt.Errorf("failed to run export options: %w", err)
+	}
+	if included.Cancelled {
 		return nil
 	}
+	opts.IncludeSystem = slices.Contains(included.Chosen, 0)
+	opts.IncludeReasoning = slices.Contains(included.Chosen, 1)
+	opts.IncludeMetadata = slices.Contains(included.Chosen, 2)
 
-	if len(prompts) == 0 {
-		showMessage("No prompts to remove.", "Remove Prompt")
+	path, err := exportChatToFile(chatID, opts, "")
+	if err != nil {
+		showMessage("Failed to export chat: "+err.Error(), "Error")
 		return nil
 	}
+	showMessage("Exported to "+path, "Success")
+	return nil
+}
 
-	var formattedPrompts []string
-	for _, prompt := range prompts {
-		mark := " "
-		if prompt.Default {
-			mark = "*"
-		}
-		formattedPrompts = append(formattedPrompts, fmt.Sprintf("%s %s", prompt.Name, mark))
+// GUIImportChats imports a ChatGPT or Claude data export
+func GUIImportChats() error {
+	input := InputModel{
+		title:  "Import Chats",
+		prompt: "Path to a ChatGPT or Claude export (.zip, folder or conversations.json):",
+	}
+	answer, err := runInput(input)
+	if err != nil {
+		return fmt.Errorf("failed to run import input: %w", err)
+	}
+	if answer.Cancelled {
+		return nil
 	}
 
-	model := MenuModel{
-		title:    "Select Prompt to Remove",
-		options:  formattedPrompts,
+	branchMenu := MenuModel{
+		title:    "Branches",
+		options:  []string{"Preserve all branches", "Keep only the current branch"},
 		selected: 0,
 		quitting: false,
 	}
-
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	branches, err := runMenu(branchMenu)
 	if err != nil {
-		return fmt.Errorf("failed to run remove prompt: %w", err)
+		return fmt.Errorf("failed to run import options: %w", err)
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if branches.Cancelled {
 		return nil
 	}
-	if menuModel.selected < len(prompts) {
-		prompt := prompts[menuModel.selected]
-		if prompt.Default {
-			showMessage("Cannot remove the default prompt. Please set another prompt as default first.", "Error")
-			return nil
-		}
 
-		// Remove the prompt
-		newPrompts := make([]Prompt, 0, len(prompts)-1)
-		for _, p := range prompts {
-			if p.Name != prompt.Name {
-				newPrompts = append(newPrompts, p)
-			}
-		}
+	path := strings.Trim(strings.TrimSpace(answer.Value), "'\"")
+	report, err := importConversations(path, branches.Selected == 1)
+	if err != nil {
+		showMessage(err.Error()+"\n\n"+report.String(), "Import Failed")
+		return nil
+	}
+	showMessage(report.String(), "Import Complete")
+	return nil
+}
 
-		if err := savePrompts(newPrompts); err == nil {
-			showMessage(fmt.Sprintf("Removed prompt '%s'.", prompt.Name), "Success")
+// GUIDeleteChat lets the user move a chat to the trash
+func GUIDeleteChat() error {
+	chats, err := listChats()
+	if err != nil {
+		showMessage("Failed to list chats: "+err.Error(), "Delete Chat")
+		return nil
+	}
+	if len(chats) == 0 {
+		showMessage("No saved chats.", "Delete Chat")
+		return nil
+	}
+	entries := loadChatEntries(chats)
+	choice, err := runMenu(newChatMenu("Select Chat to Delete", entries))
+	if err != nil {
+		return fmt.Errorf("failed to run delete chat: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	if choice.Selected < len(entries) {
+		title := entries[choice.Selected].Title()
+		if err := trashChat(entries[choice.Selected].ID); err != nil {
+			showMessage("Failed to delete chat: "+err.Error(), "Error")
 		} else {
-			showMessage("Failed to remove prompt: "+err.Error(), "Error")
+			showMessage(fmt.Sprintf("Moved '%s' to the trash.", title), "Success")
 		}
 	}
 	return nil
 }
 
-// GUIMenuModels displays the Models menu
-func GUIMenuModels() error {
+// GUIMenuTrash displays the Trash menu
+func GUIMenuTrash() error {
 	for {
-		options := []string{"List models", "Add model", "Set default", "Remove model", "Back"}
+		options := []string{"Restore chat", "Delete permanently", "Empty trash", "Retention report", "Back"}
 		model := MenuModel{
-			title:    "Models Menu",
+			title:    "Trash Menu",
 			options:  options,
 			selected: 0,
 			quitting: false,
 		}
-		p := tea.NewProgram(model, tea.WithAltScreen())
-		finalModel, err := p.Run()
+		choice, err := runMenu(model)
 		if err != nil {
-			return fmt.Errorf("failed to run models menu: %w", err)
+			return fmt.Errorf("failed to run trash menu: %w", err)
 		}
-		menuModel := finalModel.(MenuModel)
-		if menuModel.quitting || menuModel.selected == len(options)-1 {
+		if choice.Cancelled || choice.Selected == len(options)-1 {
 			return nil
 		}
-		switch options[menuModel.selected] {
-		case "List models":
-			if err := GUIListModels(); err != nil {
+		switch options[choice.Selected] {
+		case "Restore chat":
+			if err := GUISelectTrashedChat("Select Chat to Restore", restoreChat, "Restored"); err != nil {
 				return err
 			}
-		case "Add model":
-			if err := GUIAddModel(); err != nil {
+		case "Delete permanently":
+			if err := GUISelectTrashedChat("Select Chat to Delete Permanently", purgeTrashedChat, "Permanently deleted"); err != nil {
 				return err
 			}
-		case "Set default":
-			if err := GUISetDefaultModel(); err != nil {
+		case "Empty trash":
+			if err := GUIEmptyTrash(); err != nil {
 				return err
 			}
-		case "Remove model":
-			if err := GUIRemoveModel(); err != nil {
+		case "Retention report":
+			if err := GUIRetentionReport(); err != nil {
 				return err
 			}
 		}
 	}
 }
 
-// GUIListModels displays a list of models
-func GUIListModels() error {
-	models, defaultModel, err := loadModelsWithMostRecent()
+// GUISelectTrashedChat lets the user pick a trashed chat and applies action to it
+func GUISelectTrashedChat(title string, action func(id string) error, done string) error {
+	trashed, err := listTrashedChats()
 	if err != nil {
-		showMessage("Failed to load models: "+err.Error(), "Error")
+		showMessage("Failed to list trash: "+err.Error(), "Trash")
 		return nil
 	}
-
-	var formattedModels []string
-	for _, model := range models {
-		mark := " "
-		if model == defaultModel {
-			mark = "*"
-		}
-		formattedModels = append(formattedModels, fmt.Sprintf("%s %s", model, mark))
+	if len(trashed) == 0 {
+		showMessage("The trash is empty.", "Trash")
+		return nil
+	}
+	var options []string
+	for _, chat := range trashed {
+		options = append(options, fmt.Sprintf("%s (deleted %s)", chat.Title, chat.DeletedAt.Format("2006-01-02 15:04")))
 	}
-
 	model := MenuModel{
-		title:    "Models",
-		options:  formattedModels,
+		title:    title,
+		options:  options,
 		selected: 0,
 		quitting: false,
 	}
-
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	choice, err := runMenu(model)
 	if err != nil {
-		return fmt.Errorf("failed to run models list: %w", err)
+		return fmt.Errorf("failed to run trash list: %w", err)
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if choice.Cancelled {
 		return nil
 	}
-	if menuModel.selected < len(models) {
-		modelName := models[menuModel.selected]
-		details := fmt.Sprintf("Model: %s\nDefault: %t", modelName, modelName == defaultModel)
-		showMessage(details, "Model Details")
+	if choice.Selected < len(trashed) {
+		chat := trashed[choice.Selected]
+		if err := action(chat.ID); err != nil {
+			showMessage(err.Error(), "Error")
+		} else {
+			showMessage(fmt.Sprintf("%s '%s'.", done, chat.Title), "Success")
+		}
 	}
 	return nil
 }
 
-// GUIAddModel adds a new model
-func GUIAddModel() error {
-	showMessage("Add model functionality not yet implemented in GUI.\nUse CLI version for now.", "Add Model")
-	return nil
+// GUIMenuProfiles displays the Profiles menu
+func GUIMenuProfiles() error {
+	for {
+		options := []string{"List profiles", "New profile", "Edit profile", "Remove profile", "Back"}
+		choice, ok, err := GUIChoose("Profiles Menu", options, 0)
+		if err != nil {
+			return err
+		}
+		if !ok || choice == len(options)-1 {
+			return nil
+		}
+		switch options[choice] {
+		case "List profiles":
+			if err := GUIListProfiles(); err != nil {
+				return err
+			}
+		case "New profile":
+			if err := GUIEditProfile(Profile{}); err != nil {
+				return err
+			}
+		case "Edit profile":
+			p, ok, err := GUISelectProfile("Select Profile to Edit")
+			if err != nil {
+				return err
+			}
+			if ok {
+				if err := GUIEditProfile(p); err != nil {
+					return err
+				}
+			}
+		case "Remove profile":
+			p, ok, err := GUISelectProfile("Select Profile to Remove")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			confirmed, err := GUIConfirm(fmt.Sprintf("Remove profile '%s'? Chats started with it keep their settings.", p.Name))
+			if err != nil {
+				return err
+			}
+			if confirmed {
+				if err := removeProfile(p.Name); err != nil {
+					showMessage(err.Error(), "Error")
+				} else {
+					showMessage(fmt.Sprintf("Removed profile '%s'.", p.Name), "Success")
+				}
+			}
+		}
+	}
 }
 
-// GUISetDefaultModel sets a model as default
-func GUISetDefaultModel() error {
-	models, defaultModel, err := loadModelsWithMostRecent()
+// GUISelectProfile lets the user pick a profile; ok is false when there are
+// none or the user went back
+func GUISelectProfile(title string) (Profile, bool, error) {
+	profiles, err := loadProfiles()
 	if err != nil {
-		showMessage("Failed to load models: "+err.Error(), "Error")
-		return nil
+		showMessage("Failed to load profiles: "+err.Error(), "Error")
+		return Profile{}, false, nil
 	}
+	if len(profiles) == 0 {
+		showMessage("No profiles yet. Create one with New profile.", "Profiles")
+		return Profile{}, false, nil
+	}
+	var options []string
+	for _, p := range profiles {
+		options = append(options, p.Name)
+	}
+	choice, ok, err := GUIChoose(title, options, 0)
+	if err != nil || !ok {
+		return Profile{}, false, err
+	}
+	return profiles[choice], true, nil
+}
 
-	var formattedModels []string
-	for _, model := range models {
-		mark := " "
-		if model == defaultModel {
-			mark = "*"
+// describeProfile lists a profile's choices, one per line
+func describeProfile(p Profile) string {
+	orDefault := func(value, fallback string) string {
+		if value == "" {
+			return fallback
 		}
-		formattedModels = append(formattedModels, fmt.Sprintf("%s %s", model, mark))
+		return value
 	}
+	tags := "none"
+	if len(p.Tags) > 0 {
+		tags = "#" + strings.Join(p.Tags, " #")
+	}
+	return fmt.Sprintf("Name: %s\nAPI key: %s\nModel: %s\nPrompt: %s\nParameters: %s\nTags: %s",
+		p.Name, orDefault(p.APIKey, "(active key)"), orDefault(p.Model, "(default model)"),
+		orDefault(p.Prompt, "(default prompt)"), p.Params, tags)
+}
 
-	model := MenuModel{
-		title:    "Select Model to Set as Default",
-		options:  formattedModels,
-		selected: 0,
-		quitting: false,
+// GUIListProfiles shows the details of a chosen profile
+func GUIListProfiles() error {
+	p, ok, err := GUISelectProfile("Profiles")
+	if err != nil || !ok {
+		return err
 	}
+	showMessage(describeProfile(p), "Profile Details")
+	return nil
+}
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("failed to run set default model: %w", err)
+// GUIEditProfile walks through every choice of a profile, starting from p's
+// current values, and saves it
+func GUIEditProfile(p Profile) error {
+	previous := p.Name
+	name, ok, err := GUIInput("Profile Name", "Enter a name, e.g. work-code-review:", p.Name, false)
+	if err != nil || !ok {
+		return err
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
-		return nil
+	p.Name = strings.TrimSpace(name)
+
+	// API key, model and prompt: the first option keeps the global default
+	pick := func(title, none string, values []string, current string) (string, bool, error) {
+		options := append([]string{none}, values...)
+		selected := 0
+		for i, value := range values {
+			if value == current {
+				selected = i + 1
+			}
+		}
+		choice, ok, err := GUIChoose(title, options, selected)
+		if err != nil || !ok || choice == 0 {
+			return "", ok, err
+		}
+		return values[choice-1], true, nil
 	}
-	if menuModel.selected < len(models) {
-		modelName := models[menuModel.selected]
-		if err := saveModelsWithMostRecent(modelName, models); err == nil {
-			showMessage(fmt.Sprintf("Set '%s' as default model.", modelName), "Success")
-		} else {
-			showMessage("Failed to set default model: "+err.Error(), "Error")
+	if p.APIKey, ok, err = pick("API Key for "+p.Name, "(active key)", apiKeyChoices(), p.APIKey); err != nil || !ok {
+		return err
+	}
+	if p.Model, ok, err = pick("Model for "+p.Name, "(default model)", modelChoices(), p.Model); err != nil || !ok {
+		return err
+	}
+	var prompts []string
+	if loaded, err := loadPrompts(); err == nil {
+		for _, prompt := range loaded {
+			prompts = append(prompts, prompt.Name)
 		}
 	}
-	return nil
-}
+	if p.Prompt, ok, err = pick("Prompt for "+p.Name, "(default prompt)", prompts, p.Prompt); err != nil || !ok {
+		return err
+	}
+
+	// Generation parameters: an empty answer keeps the default
+	floatParam := func(label string, current *float64) (*float64, bool, error) {
+		initial := ""
+		if current != nil {
+			initial = strconv.FormatFloat(*current, 'g', -1, 64)
+		}
+		for {
+			value, ok, err := GUIInput(p.Name+": "+label, "Enter a value, or leave empty for the default:", initial, true)
+			if err != nil || !ok {
+				return nil, ok, err
+			}
+			if strings.TrimSpace(value) == "" {
+				return nil, true, nil
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err == nil {
+				return &f, true, nil
+			}
+			showMessage(fmt.Sprintf("'%s' is not a number.", value), "Invalid Value")
+			initial = value
+		}
+	}
+	if p.Params.Temperature, ok, err = floatParam("temperature (0-2)", p.Params.Temperature); err != nil || !ok {
+		return err
+	}
+	if p.Params.TopP, ok, err = floatParam("top_p (0-1)", p.Params.TopP); err != nil || !ok {
+		return err
+	}
+	initial := ""
+	if p.Params.MaxTokens > 0 {
+		initial = strconv.Itoa(p.Params.MaxTokens)
+	}
+	value, ok, err := GUIInput(p.Name+": max_tokens", "Enter a value, or leave empty for the default:", initial, true)
+	if err != nil || !ok {
+		return err
+	}
+	p.Params.MaxTokens = 0
+	if value = strings.TrimSpace(value); value != "" {
+		if p.Params.MaxTokens, err = strconv.Atoi(value); err != nil {
+			showMessage(fmt.Sprintf("'%s' is not a whole number.", value), "Invalid Value")
+			return nil
+		}
+	}
+
+	tags, ok, err := GUIInput(p.Name+": tags", "Tags added to its chats, separated by spaces:", strings.Join(p.Tags, " "), true)
+	if err != nil || !ok {
+		return err
+	}
+	p.Tags = normalizeTags(strings.Fields(strings.ReplaceAll(tags, ",", " ")))
 
-// GUIRemoveModel removes a model
-func GUIRemoveModel() error {
-	showMessage("Remove model functionality not yet implemented in GUI.\nUse CLI version for now.", "Remove Model")
+	if err := saveProfile(p, previous); err != nil {
+		showMessage("Failed to save profile: "+err.Error(), "Error")
+		return nil
+	}
+	showMessage(describeProfile(p), "Profile Saved")
 	return nil
 }
 
-// GUIMenuAPIKey displays the API Key menu
-func GUIMenuAPIKey() error {
+// GUIMenuSettings lists every setting with its current value and edits the
+// chosen one
+func GUIMenuSettings() error {
+	// Report problems found in a hand-edited settings file once
+	if err := settingsError(); err != nil {
+		showMessage("settings.json has problems, defaults are used instead:\n"+err.Error(), "Settings")
+	}
+	selected := 0
 	for {
-		options := []string{"List API keys", "Add API key", "Set active", "Remove API key", "Back"}
+		settings := currentSettings()
+		fields := settingFields()
+		var options []string
+		for _, field := range fields {
+			options = append(options, fmt.Sprintf("%s: %s", field.Key, field.Get(settings)))
+		}
+		options = append(options, "Reset to defaults", "Back")
 		model := MenuModel{
-			title:    "API Key Menu",
+			title:    "Settings",
 			options:  options,
-			selected: 0,
+			selected: selected,
 			quitting: false,
 		}
-		p := tea.NewProgram(model, tea.WithAltScreen())
-		finalModel, err := p.Run()
+		choice, err := runMenu(model)
 		if err != nil {
-			return fmt.Errorf("failed to run API key menu: %w", err)
+			return fmt.Errorf("failed to run settings menu: %w", err)
 		}
-		menuModel := finalModel.(MenuModel)
-		if menuModel.quitting || menuModel.selected == len(options)-1 {
+		if choice.Cancelled || choice.Selected == len(options)-1 {
 			return nil
 		}
-		switch options[menuModel.selected] {
-		case "List API keys":
-			if err := GUIListAPIKeys(); err != nil {
+		selected = choice.Selected
+		if options[choice.Selected] == "Reset to defaults" {
+			confirmed, err := GUIConfirm("Reset all settings to their defaults?")
+			if err != nil {
 				return err
 			}
-		case "Add API key":
-			if err := GUIAddAPIKey(); err != nil {
-				return err
-			}
-		case "Set active":
-			if err := GUISetActiveAPIKey(); err != nil {
-				return err
-			}
-		case "Remove API key":
-			if err := GUIRemoveAPIKey(); err != nil {
-				return err
+			if confirmed {
+				if err := saveSettings(defaultSettings()); err != nil {
+					showMessage("Failed to reset settings: "+err.Error(), "Error")
+				}
 			}
+			continue
+		}
+		if err := GUIEditSetting(fields[choice.Selected], settings); err != nil {
+			return err
 		}
 	}
 }
 
-// GUIListAPIKeys displays a list of API keys
-func GUIListAPIKeys() error {
-	keys, activeKey, err := listAPIKeys()
-	if err != nil {
-		showMessage("Failed to load API keys: "+err.Error(), "Error")
-		return nil
-	}
-
-	var formattedKeys []string
-	for _, key := range keys {
-		mark := " "
-		if key.Title == activeKey {
-			mark = "*"
+// GUIEditSetting asks for a new value of one setting and saves it
+func GUIEditSetting(field settingField, settings Settings) error {
+	var value string
+	var choices []string
+	if field.Choices != nil {
+		choices = field.Choices()
+	}
+	if len(choices) > 0 {
+		selected := 0
+		for i, choice := range choices {
+			if choice == field.Get(settings) {
+				selected = i
+			}
 		}
-		formattedKeys = append(formattedKeys, fmt.Sprintf("%s %s", key.Title, mark))
-	}
-
-	model := apiKeyMenuModel{
-		MenuModel: MenuModel{
-			title:    "API Keys",
-			options:  formattedKeys,
-			selected: 0,
+		model := MenuModel{
+			title:    field.Key,
+			options:  choices,
+			selected: selected,
 			quitting: false,
-		},
-		keys:      keys,
-		activeKey: activeKey,
+		}
+		choice, err := runMenu(model)
+		if err != nil {
+			return fmt.Errorf("failed to run setting choices: %w", err)
+		}
+		if choice.Cancelled {
+			return nil
+		}
+		value = choices[choice.Selected]
+	} else {
+		model := InputModel{
+			title:    "Edit " + field.Key,
+			prompt:   "Enter the new value:",
+			input:    field.Get(settings),
+			optional: true,
+		}
+		answer, err := runInput(model)
+		if err != nil {
+			return fmt.Errorf("failed to run setting input: %w", err)
+		}
+		if answer.Cancelled {
+			return nil
+		}
+		value = answer.Value
 	}
-
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("failed to run API keys list: %w", err)
+	if err := field.Set(&settings, value); err != nil {
+		showMessage(err.Error(), "Invalid Setting")
+		return nil
 	}
-	menuModel := finalModel.(apiKeyMenuModel)
-	if menuModel.quitting {
+	if err := validateSettings(&settings); err != nil {
+		showMessage(err.Error(), "Invalid Setting")
 		return nil
 	}
-	if menuModel.selected < len(keys) {
-		key := keys[menuModel.selected]
-		details := fmt.Sprintf("Title: %s\nActive: %t", key.Title, key.Title == activeKey)
-		showMessage(details, "API Key Details")
+	if err := saveSettings(settings); err != nil {
+		showMessage("Failed to save settings: "+err.Error(), "Error")
 	}
 	return nil
 }
 
-// InputModel represents a simple input model for getting user input
-type InputModel struct {
-	title     string
-	prompt    string
-	input     string
-	quitting  bool
-	submitted bool
-	multiline bool
+// logViewerLevels are the minimum levels the log viewer cycles through
+var logViewerLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// LogViewerModel shows the newest records of the log file
+type LogViewerModel struct {
+	records  []logRecord
+	level    slog.Level
+	selected int
+	err      error
+	width    int
+	height   int
+	quitting bool
+	open     bool // Show the selected record in full
 }
 
-func (m InputModel) Init() tea.Cmd {
+// newLogViewerModel loads the records at or above level
+func newLogViewerModel(level slog.Level) LogViewerModel {
+	m := LogViewerModel{level: level, width: 100, height: 24}
+	m.reload()
+	return m
+}
+
+// reload reads the log file again and selects the newest record
+func (m *LogViewerModel) reload() {
+	m.records, m.err = readLogRecords(m.level, logViewerRecords)
+	m.selected = max(0, len(m.records)-1)
+}
+
+func (m LogViewerModel) Init() tea.Cmd {
 	return nil
 }
 
-func (m InputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+func (m LogViewerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
 	case tea.KeyMsg:
+		if m.open {
+			m.open = false
+			return m, nil
+		}
+		page := max(1, m.height-6)
 		switch msg.String() {
-		case "ctrl+c", "q", "esc":
+		case "ctrl+c", "esc", "q":
 			m.quitting = true
-			return m, tea.Quit
-		case "enter":
-			if m.multiline {
-				// For multiline input, Enter adds a newline
-				m.input += "\n"
-			} else {
-				// For single line input, Enter submits
-				if m.input != "" {
-					m.submitted = true
-					return m, tea.Quit
-				}
-			}
-		case "ctrl+s":
-			// Ctrl+S submits multiline input
-			if m.multiline && m.input != "" {
-				m.submitted = true
-				return m, tea.Quit
-			}
-		case "backspace":
-			if len(m.input) > 0 {
-				m.input = m.input[:len(m.input)-1]
-			}
-		default:
-			if len(msg.String()) == 1 {
-				char := msg.String()[0]
-				if char >= 32 && char <= 126 {
-					m.input += msg.String()
+			return m, screenDone(struct{}{})
+		case "up", "k":
+			m.selected = max(0, m.selected-1)
+		case "down", "j":
+			m.selected = min(len(m.records)-1, m.selected+1)
+		case "pgup":
+			m.selected = max(0, m.selected-page)
+		case "pgdown":
+			m.selected = min(len(m.records)-1, m.selected+page)
+		case "home", "g":
+			m.selected = 0
+		case "end", "G":
+			m.selected = max(0, len(m.records)-1)
+		case "l":
+			for i, level := range logViewerLevels {
+				if level == m.level {
+					m.level = logViewerLevels[(i+1)%len(logViewerLevels)]
+					break
 				}
 			}
+			m.reload()
+		case "r":
+			m.reload()
+		case "enter":
+			m.open = len(m.records) > 0
 		}
 	}
 	return m, nil
 }
 
-func (m InputModel) View() string {
-	if m.quitting {
-		return ""
+func (m LogViewerModel) View() string {
+	theme := currentSettings().UI.Colors
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Title))
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Muted))
+	levelColors := map[slog.Level]string{
+		slog.LevelDebug: theme.Muted,
+		slog.LevelInfo:  theme.Text,
+		slog.LevelWarn:  theme.Loading,
+		slog.LevelError: theme.Error,
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Logs: %s and above, %d records", m.level, len(m.records))) + "\n")
+	b.WriteString(helpStyle.Render(logPath()) + "\n\n")
+	switch {
+	case m.err != nil:
+		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Error)).Render("Failed to read the log: "+m.err.Error()) + "\n")
+	case len(m.records) == 0:
+		b.WriteString(helpStyle.Render("  (no records)") + "\n")
+	case m.open:
+		record := m.records[m.selected]
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color(levelColors[record.Level])).Width(max(20, m.width-2))
+		b.WriteString(style.Render(record.Line) + "\n")
+	default:
+		rows := max(1, m.height-6)
+		start := max(0, min(m.selected-rows/2, len(m.records)-rows))
+		for i := start; i < min(len(m.records), start+rows); i++ {
+			record := m.records[i]
+			line := record.Line
+			if width := max(20, m.width-4); len(line) > width {
+				line = line[:width-1] + "…"
+			}
+			style := lipgloss.NewStyle().Foreground(lipgloss.Color(levelColors[record.Level]))
+			if i == m.selected {
+				b.WriteString(style.Bold(true).Render("> "+line) + "\n")
+			} else {
+				b.WriteString(style.Render("  "+line) + "\n")
+			}
+		}
 	}
-
-	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("63"))
-	promptStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("252"))
-	inputStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("203")).Bold(true)
-	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
-
-	helpText := "Press Enter to submit, Esc to cancel"
-	if m.multiline {
-		helpText = "Press Ctrl+S to submit, Esc to cancel"
+	helpText := "\n↑↓ to move, Enter to show a record in full, l to change the level, r to reload, Esc to go back"
+	if m.open {
+		helpText = "\nPress any key to return to the list"
 	}
-
-	content := fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s",
-		titleStyle.Render(m.title),
-		promptStyle.Render(m.prompt),
-		inputStyle.Render("> "+m.input),
-		helpStyle.Render(helpText))
-
-	boxStyle := lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("62")).
-		Padding(1, 2).
-		Width(60).
-		Align(lipgloss.Center)
-
-	return boxStyle.Render(content)
+	return b.String() + helpStyle.Render(helpText)
 }
 
-// GUIAddAPIKey adds a new API key by reading from clipboard and prompting for name
-func GUIAddAPIKey() error {
-	// Confirmation prompt
-	confirmModel := InputModel{
-		title:     "Add API Key",
-		prompt:    "Press Enter to read API key from clipboard, or Esc to cancel.",
-		input:     "",
-		multiline: false,
-	}
-	p := tea.NewProgram(confirmModel, tea.WithAltScreen())
-	finalModel, err := p.Run()
-	if err != nil {
-		return err
-	}
-	inputModel := finalModel.(InputModel)
-	if inputModel.quitting {
-		return nil
-	}
-
-	// Read from clipboard
-	clipCmd := "powershell Get-Clipboard"
-	clipOut, err := execCommand(clipCmd)
-	if err != nil {
-		showMessage("Failed to read clipboard. Please copy your API key first.", "Error")
-		return nil
-	}
-	key := strings.TrimSpace(clipOut)
-	if key == "" {
-		showMessage("Clipboard is empty. Please copy your API key first.", "Error")
-		return nil
+// GUILogViewer shows the log file, starting at the warning level
+func GUILogViewer() error {
+	if _, err := runScreen[struct{}](newLogViewerModel(slog.LevelWarn), false); err != nil {
+		return fmt.Errorf("failed to run log viewer: %w", err)
 	}
+	return nil
+}
 
-	// Prompt for key name
-	nameModel := InputModel{
-		title:  "Add API Key",
-		prompt: "Enter a title for this API key:",
-		input:  "",
+// GUIChoose shows options and returns the index picked; ok is false when
+// the user went back
+func GUIChoose(title string, options []string, selected int) (int, bool, error) {
+	model := MenuModel{
+		title:    title,
+		options:  options,
+		selected: selected,
+		quitting: false,
 	}
-	p = tea.NewProgram(nameModel, tea.WithAltScreen())
-	finalModel, err = p.Run()
+	choice, err := runMenu(model)
 	if err != nil {
-		return err
+		return 0, false, fmt.Errorf("failed to run selection: %w", err)
 	}
-	nameInputModel := finalModel.(InputModel)
-	if nameInputModel.quitting || !nameInputModel.submitted {
-		return nil
-	}
-	title := strings.TrimSpace(nameInputModel.input)
-	if title == "" {
-		title = "Default"
-	}
-	if err := addAPIKey(title, key); err != nil {
-		showMessage("Failed to add API key: "+err.Error(), "Error")
-		return nil
+	if choice.Cancelled {
+		return 0, false, nil
 	}
-	showMessage(fmt.Sprintf("API key '%s' added successfully.", title), "Success")
-	return nil
+	return choice.Selected, true, nil
 }
 
-// GUISetActiveAPIKey sets an API key as active
-func GUISetActiveAPIKey() error {
-	keys, activeKey, err := listAPIKeys()
+// GUIInput asks for one line of text, starting from initial. optional
+// allows an empty answer; ok is false when the user cancelled.
+func GUIInput(title, prompt, initial string, optional bool) (string, bool, error) {
+	model := InputModel{title: title, prompt: prompt, input: initial, optional: optional}
+	answer, err := runInput(model)
 	if err != nil {
-		showMessage("Failed to load API keys: "+err.Error(), "Error")
-		return nil
+		return "", false, fmt.Errorf("failed to run input: %w", err)
 	}
-
-	var formattedKeys []string
-	for _, key := range keys {
-		mark := " "
-		if key.Title == activeKey {
-			mark = "*"
-		}
-		formattedKeys = append(formattedKeys, fmt.Sprintf("%s %s", key.Title, mark))
+	if answer.Cancelled {
+		return "", false, nil
 	}
+	return answer.Value, true, nil
+}
 
+// GUIConfirm asks a yes/no question in a dialog and reports whether the
+// user agreed
+func GUIConfirm(question string) (bool, error) {
 	model := MenuModel{
-		title:    "Select API Key to Set as Active",
-		options:  formattedKeys,
+		title:    question,
+		options:  []string{"No", "Yes"},
 		selected: 0,
 		quitting: false,
 	}
-
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	choice, err := runScreen[MenuResult](model, true)
 	if err != nil {
-		return fmt.Errorf("failed to run set active API key: %w", err)
-	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
-		return nil
-	}
-	if menuModel.selected < len(keys) {
-		key := keys[menuModel.selected]
-		if err := setActiveAPIKey(key.Title); err == nil {
-			showMessage(fmt.Sprintf("Set '%s' as active API key.", key.Title), "Success")
-		} else {
-			showMessage("Failed to set active API key: "+err.Error(), "Error")
-		}
+		return false, fmt.Errorf("failed to run confirmation: %w", err)
 	}
-	return nil
+	return !choice.Cancelled && choice.Selected == 1, nil
 }
 
-// GUIRemoveAPIKey removes an API key
-func GUIRemoveAPIKey() error {
-	keys, activeKey, err := listAPIKeys()
+// GUIEmptyTrash permanently deletes everything in the trash after confirmation
+func GUIEmptyTrash() error {
+	trashed, err := listTrashedChats()
 	if err != nil {
-		showMessage("Failed to load API keys: "+err.Error(), "Error")
+		showMessage("Failed to list trash: "+err.Error(), "Trash")
 		return nil
 	}
-
-	if len(keys) == 0 {
-		showMessage("No API keys to remove.", "Remove API Key")
+	if len(trashed) == 0 {
+		showMessage("The trash is empty.", "Trash")
 		return nil
 	}
-
-	var formattedKeys []string
-	for _, key := range keys {
-		mark := " "
-		if key.Title == activeKey {
-			mark = "*"
-		}
-		formattedKeys = append(formattedKeys, fmt.Sprintf("%s %s", key.Title, mark))
-	}
-
-	model := MenuModel{
-		title:    "Select API Key to Remove",
-		options:  formattedKeys,
-		selected: 0,
-		quitting: false,
+	ok, err := GUIConfirm(fmt.Sprintf("Permanently delete %d chats in the trash?", len(trashed)))
+	if err != nil || !ok {
+		return err
 	}
-
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	count, err := emptyTrash()
 	if err != nil {
-		return fmt.Errorf("failed to run remove API key: %w", err)
-	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+		showMessage("Failed to empty trash: "+err.Error(), "Error")
 		return nil
 	}
-	if menuModel.selected < len(keys) {
-		key := keys[menuModel.selected]
-		if key.Title == activeKey {
-			showMessage("Cannot remove the active API key. Please set another key as active first.", "Error")
-			return nil
-		}
-		if err := removeAPIKey(key.Title); err == nil {
-			showMessage(fmt.Sprintf("Removed API key '%s'.", key.Title), "Success")
-		} else {
-			showMessage("Failed to remove API key: "+err.Error(), "Error")
-		}
-	}
+	showMessage(fmt.Sprintf("Permanently deleted %d chats.", count), "Success")
 	return nil
 }
 
-// GUIListChats displays a list of recent chats using Bubble Tea
-func GUIListChats() error {
-	chats, err := listChats()
+// GUIRetentionReport shows what the retention rules would do and offers to apply them
+func GUIRetentionReport() error {
+	policy, err := loadRetentionPolicy()
 	if err != nil {
-		showMessage("Failed to list chats: "+err.Error(), "Chats List")
+		showMessage("Failed to load retention policy: "+err.Error(), "Error")
 		return nil
 	}
-	if len(chats) == 0 {
-		showMessage("No saved chats.", "Chats List")
+	actions, err := planRetention(policy)
+	if err != nil {
+		showMessage("Failed to plan retention: "+err.Error(), "Error")
 		return nil
 	}
-	var formattedChats []string
-	for _, chat := range chats {
-		chatFile, err := loadChatWithMetadata(chat)
-		favoriteMark := " "
-		if err == nil && chatFile.Metadata.Favorite {
-			favoriteMark = "★"
-		}
-		formattedChats = append(formattedChats, fmt.Sprintf("%s %s", chat, favoriteMark))
-	}
-	model := MenuModel{
-		title:    "Recent Chats",
-		options:  formattedChats,
-		selected: 0,
-		quitting: false,
+	showMessage(retentionReport(actions, true), "Retention Report")
+	if len(actions) == 0 {
+		return nil
 	}
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("failed to run chat list: %w", err)
+	ok, err := GUIConfirm(fmt.Sprintf("Apply %d retention actions now?", len(actions)))
+	if err != nil || !ok {
+		return err
 	}
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if err := applyRetention(actions); err != nil {
+		showMessage("Failed to apply retention: "+err.Error(), "Error")
 		return nil
 	}
-	if menuModel.selected < len(chats) {
-		// Toggle favorite on selection
-		chatName := chats[menuModel.selected]
-		chatFile, err := loadChatWithMetadata(chatName)
-		if err == nil {
-			chatFile.Metadata.Favorite = !chatFile.Metadata.Favorite
-			if err := saveChat(chatName, chatFile.Messages); err == nil {
-				return GUIListChats()
-			}
-		}
-	}
+	showMessage(retentionReport(actions, false), "Retention Applied")
 	return nil
 }
 
 // GUINewChat creates a new chat and opens it
 func GUINewChat() error {
-	chatName := fmt.Sprintf("chat-%d", time.Now().Unix())
+	// Offer the profiles, if any, before falling back to the defaults
+	profiles, err := loadProfiles()
+	if err != nil {
+		showMessage("Failed to load profiles: "+err.Error(), "Error")
+	}
+	if len(profiles) > 0 {
+		options := []string{"Default settings"}
+		for _, p := range profiles {
+			options = append(options, p.Name)
+		}
+		choice, ok, err := GUIChoose("Start Chat With", options, 0)
+		if err != nil || !ok {
+			return err
+		}
+		if choice > 0 {
+			chatName, messages, model, err := newChatFromProfile(profiles[choice-1])
+			if err != nil {
+				showMessage("Failed to start chat: "+err.Error(), "Error")
+				return nil
+			}
+			runChatGUI(chatName, messages, nil, model)
+			return nil
+		}
+	}
+
+	chatName := newChatID()
 	model := DefaultModel()
 	prompt := "You are a helpful AI assistant."
 	messages := []Message{{Role: "system", Content: prompt}}
 	// Save the new chat
 	var chatFile ChatFile
 	chatFile.Messages = messages
+	chatFile.Metadata.Title = defaultChatTitle()
+	chatFile.Metadata.PlaceholderTitle = true
 	chatFile.Metadata.Model = model
 	chatFile.Metadata.CreatedAt = time.Now()
-	data, err := json.MarshalIndent(chatFile, "", "  ")
-	if err != nil {
-		showMessage("Failed to create chat: "+err.Error(), "Error")
-		return nil
-	}
-	err = os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644)
-	if err != nil {
+	if err := saveChatFile(chatName, &chatFile); err != nil {
 		showMessage("Failed to save chat: "+err.Error(), "Error")
 		return nil
 	}
@@ -1814,18 +3576,15 @@ func GUICustomChat() error {
 		quitting: false,
 	}
 
-	p := tea.NewProgram(apiKeyModel, tea.WithAltScreen())
-	finalModel, err := p.Run()
+	choice, err := runMenu(apiKeyModel)
 	if err != nil {
 		return fmt.Errorf("failed to run API key selection: %w", err)
 	}
-
-	menuModel := finalModel.(MenuModel)
-	if menuModel.quitting {
+	if choice.Cancelled {
 		return nil
 	}
 
-	selectedAPIKey := apiKeys[menuModel.selected].Title
+	selectedAPIKey := apiKeys[choice.Selected].Title
 
 	// Step 2: Select Model
 	models, defaultModel, err := loadModelsWithMostRecent()
@@ -1850,18 +3609,15 @@ func GUICustomChat() error {
 		quitting: false,
 	}
 
-	p = tea.NewProgram(modelMenuModel, tea.WithAltScreen())
-	finalModel, err = p.Run()
+	choice, err = runMenu(modelMenuModel)
 	if err != nil {
 		return fmt.Errorf("failed to run model selection: %w", err)
 	}
-
-	menuModel = finalModel.(MenuModel)
-	if menuModel.quitting {
+	if choice.Cancelled {
 		return nil
 	}
 
-	selectedModel := models[menuModel.selected]
+	selectedModel := models[choice.Selected]
 
 	// Step 3: Select Prompt
 	prompts, err := loadPrompts()
@@ -1886,53 +3642,169 @@ func GUICustomChat() error {
 		quitting: false,
 	}
 
-	p = tea.NewProgram(promptMenuModel, tea.WithAltScreen())
-	finalModel, err = p.Run()
+	choice, err = runMenu(promptMenuModel)
 	if err != nil {
 		return fmt.Errorf("failed to run prompt selection: %w", err)
 	}
-
-	menuModel = finalModel.(MenuModel)
-	if menuModel.quitting {
+	if choice.Cancelled {
 		return nil
 	}
 
-	selectedPrompt := prompts[menuModel.selected]
+	selectedPrompt := prompts[choice.Selected]
+
+	// Step 4: Optionally keep the choices as a profile for next time
+	profile := Profile{APIKey: selectedAPIKey, Model: selectedModel, Prompt: selectedPrompt.Name}
+	save, err := GUIConfirm("Save these choices as a profile?")
+	if err != nil {
+		return err
+	}
+	if save {
+		name, ok, err := GUIInput("New Profile", "Enter a name for the profile:", "", false)
+		if err != nil {
+			return err
+		}
+		if ok {
+			profile.Name = strings.TrimSpace(name)
+			if err := saveProfile(profile, ""); err != nil {
+				showMessage("Failed to save profile: "+err.Error(), "Error")
+				profile.Name = ""
+			}
+		}
+	}
 
-	// Step 4: Set the selected API key as active for this session
-	if err := setActiveAPIKey(selectedAPIKey); err != nil {
-		showMessage("Failed to set active API key: "+err.Error(), "Error")
+	// Step 5: Create and start the chat; the key is stored with the chat
+	// rather than made the active key
+	chatName, messages, model, err := newChatFromProfile(profile)
+	if err != nil {
+		showMessage("Failed to save chat: "+err.Error(), "Error")
 		return nil
 	}
+	runChatGUI(chatName, messages, nil, model)
+	return nil
+}
 
-	// Step 5: Create and start the chat
-	chatName := fmt.Sprintf("chat-%d", time.Now().Unix())
-	messages := []Message{{Role: "system", Content: selectedPrompt.Content}}
+// GUINewDebate sets up a debate between two models, runs it and saves it
+// as a chat
+func GUINewDebate() error {
+	// Step 1: Select the mode
+	modes := []string{"Discussion", "Draft and critique"}
+	choice, err := runMenu(MenuModel{title: "Debate Mode", options: modes})
+	if err != nil {
+		return fmt.Errorf("failed to run debate mode selection: %w", err)
+	}
+	if choice.Cancelled {
+		return nil
+	}
+	cfg := DebateConfig{Mode: debateConverse}
+	if choice.Selected == 1 {
+		cfg.Mode = debateCritique
+	}
 
-	// Save the new chat
-	var chatFile ChatFile
-	chatFile.Messages = messages
-	chatFile.Metadata.Model = selectedModel
-	chatFile.Metadata.CreatedAt = time.Now()
-	data, err := json.MarshalIndent(chatFile, "", "  ")
+	// Step 2: Select a model and a prompt for each speaker
+	models, defaultModel, err := loadModelsWithMostRecent()
 	if err != nil {
-		showMessage("Failed to create chat: "+err.Error(), "Error")
+		showMessage("Failed to load models: "+err.Error(), "Error")
 		return nil
 	}
-	err = os.WriteFile(filepath.Join(chatsPath, chatName+".json"), data, 0644)
+	prompts, err := loadPrompts()
 	if err != nil {
-		showMessage("Failed to save chat: "+err.Error(), "Error")
+		showMessage("Failed to load prompts: "+err.Error(), "Error")
+		return nil
+	}
+	if len(models) == 0 || len(prompts) == 0 {
+		showMessage("A debate needs at least one model and one prompt.", "Debate")
+		return nil
+	}
+	roles := [2]string{"Speaker A", "Speaker B"}
+	if cfg.Mode == debateCritique {
+		roles = [2]string{"Writer (A)", "Critic (B)"}
+	}
+	for i, role := range roles {
+		var modelOptions []string
+		for _, model := range models {
+			mark := " "
+			if model == defaultModel {
+				mark = "*"
+			}
+			modelOptions = append(modelOptions, fmt.Sprintf("%s %s", model, mark))
+		}
+		choice, err := runMenu(MenuModel{title: "Model for " + role, options: modelOptions})
+		if err != nil {
+			return fmt.Errorf("failed to run model selection: %w", err)
+		}
+		if choice.Cancelled {
+			return nil
+		}
+		cfg.Speakers[i].Model = models[choice.Selected]
+
+		var promptOptions []string
+		for _, prompt := range prompts {
+			mark := " "
+			if prompt.Default {
+				mark = "*"
+			}
+			promptOptions = append(promptOptions, fmt.Sprintf("%s %s", prompt.Name, mark))
+		}
+		choice, err = runMenu(MenuModel{title: "Prompt for " + role, options: promptOptions})
+		if err != nil {
+			return fmt.Errorf("failed to run prompt selection: %w", err)
+		}
+		if choice.Cancelled {
+			return nil
+		}
+		cfg.Speakers[i].Prompt = prompts[choice.Selected]
+	}
+
+	// Step 3: Enter the topic and the number of rounds
+	title := "Debate Topic"
+	if cfg.Mode == debateCritique {
+		title = "Writing Task"
+	}
+	topic, ok, err := GUIInput(title, "What should they work on?", "", false)
+	if err != nil {
+		return err
+	}
+	if !ok || strings.TrimSpace(topic) == "" {
 		return nil
 	}
+	cfg.Topic = strings.TrimSpace(topic)
+
+	for {
+		input, ok, err := GUIInput("Rounds", fmt.Sprintf("Number of rounds (1-%d):", maxDebateRounds), "3", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		rounds, err := strconv.Atoi(strings.TrimSpace(input))
+		if err == nil && rounds >= 1 && rounds <= maxDebateRounds {
+			cfg.Rounds = rounds
+			break
+		}
+		showMessage(fmt.Sprintf("Enter a number from 1 to %d.", maxDebateRounds), "Invalid Rounds")
+	}
 
-	runChatGUI(chatName, messages, nil, selectedModel)
+	// Step 4: Run the debate and open the chat it was saved as
+	result, err := runScreen[debateResult](newDebateModel(cfg), false)
+	if err != nil {
+		return fmt.Errorf("failed to run debate: %w", err)
+	}
+	if result.Open {
+		openChat(result.ChatName)
+	}
 	return nil
 }
 
-// MessageModel represents a simple message display model
+// MessageModel is a dialog showing a message until a key is pressed
 type MessageModel struct {
-	content  string
-	quitting bool
+	title   string
+	content string
+}
+
+// newMessageModel creates a message dialog
+func newMessageModel(msg, title string) MessageModel {
+	return MessageModel{title: title, content: msg}
 }
 
 func (m MessageModel) Init() tea.Cmd {
@@ -1942,31 +3814,24 @@ func (m MessageModel) Init() tea.Cmd {
 func (m MessageModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg.(type) {
 	case tea.KeyMsg:
-		m.quitting = true
-		return m, tea.Quit
+		return m, screenDone(struct{}{})
 	}
 	return m, nil
 }
 
 func (m MessageModel) View() string {
-	return m.content
+	theme := currentSettings().UI.Colors
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Title))
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(theme.Muted))
+	body := lipgloss.NewStyle().Width(46).Align(lipgloss.Center).Render(m.content)
+	return lipgloss.JoinVertical(lipgloss.Center, titleStyle.Render(m.title), "", body, "", helpStyle.Render("Press any key to continue"))
 }
 
-// showMessage displays a simple message
+// showMessage displays a message in a dialog over the current screen
 func showMessage(msg, title string) {
-	messageStyle := lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("62")).
-		Padding(1, 2).
-		Width(50).
-		Align(lipgloss.Center)
-	content := messageStyle.Render(fmt.Sprintf("%s\n\n%s\n\nPress any key to continue", title, msg))
-	msgModel := MessageModel{
-		content:  content,
-		quitting: false,
+	if _, err := runScreen[struct{}](newMessageModel(msg, title), true); err != nil {
+		logger.Warn("failed to show message", "title", title, "err", err)
 	}
-	p := tea.NewProgram(msgModel, tea.WithAltScreen())
-	_, _ = p.Run()
 }
 
 // Patch MenuModel's Update for apiKeyMenuModel to handle 's' key
@@ -1974,12 +3839,9 @@ func (m apiKeyMenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q":
-			m.quitting = true
-			return m, tea.Quit
-		case "esc":
+		case "ctrl+c", "q", "esc":
 			m.quitting = true
-			return m, tea.Quit
+			return m, m.done()
 		case "up", "k":
 			if m.selected > 0 {
 				m.selected--
@@ -1989,77 +3851,441 @@ func (m apiKeyMenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.selected++
 			}
 		case "enter":
-			return m, tea.Quit
+			return m, m.done()
 		case "s":
 			if m.selected < len(m.keys) {
 				key := m.keys[m.selected]
-				showMessage(fmt.Sprintf("Title: %s\n\nAPI Key (Sensitive!):\n%s", key.Title, key.Key), "Show API Key")
+				return m, openModal(newMessageModel(fmt.Sprintf("Title: %s\n\nAPI Key (Sensitive!):\n%s", key.Title, key.Key), "Show API Key"))
 			}
 		}
 	}
 	return m, nil
 }
 
-// getVisibleMessages returns the list of visible messages (excluding system messages)
-func (m ChatModel) getVisibleMessages() []Message {
-	var visible []Message
-	for _, msg := range m.messages {
-		if msg.Role != "system" {
-			visible = append(visible, msg)
+func (m *ChatModel) handleVimCommand(cmd string) (bool, tea.Cmd) {
+	fields := strings.Fields(cmd)
+	switch fields[0] {
+	case ":e":
+		idx, ok := m.parseMessageNumber(fields)
+		if !ok || m.messages[idx].Role != "user" {
+			m.status = "Usage: :e N (N is the number of a user message)"
+			return true, nil
+		}
+		m.startEdit(idx)
+		return true, nil
+	case ":bn", ":bp":
+		idx, ok := m.parseMessageNumber(fields)
+		if !ok {
+			m.status = "Usage: :bn N or :bp N"
+			return true, nil
 		}
+		delta := 1
+		if fields[0] == ":bp" {
+			delta = -1
+		}
+		m.switchBranchAt(idx, delta)
+		return true, nil
+	case ":pin":
+		idx, ok := m.parseMessageNumber(fields)
+		if !ok {
+			m.status = "Usage: :pin N (toggles pinning message N in the context)"
+			return true, nil
+		}
+		m.togglePin(idx)
+		return true, nil
+	case ":context":
+		m.setContextStrategy(fields[1:])
+		return true, nil
+	case ":tag":
+		m.editTags(fields[1:])
+		return true, nil
+	case ":export":
+		m.exportChat(fields[1:])
+		return true, nil
+	case ":copy":
+		return true, m.copyToClipboard(fields[1:])
+	case ":profile":
+		m.switchProfile(strings.TrimSpace(strings.TrimPrefix(cmd, ":profile")))
+		return true, nil
+	case ":folder":
+		m.setFolder(strings.TrimSpace(strings.TrimPrefix(cmd, ":folder")))
+		return true, nil
+	case ":raw":
+		m.toggleRaw()
+		return true, nil
+	case ":regen":
+		return true, m.regenerateLast(fields[1:])
+	case ":compare":
+		return true, m.pickCompareModels(fields[1:])
 	}
-	return visible
-}
-
-func (m *ChatModel) handleVimCommand(cmd string) bool {
 	switch cmd {
 	case ":g":
-		if len(m.messages) > 0 {
-			var lastUserMsg string
-			for i := len(m.messages) - 1; i >= 0; i-- {
-				if m.messages[i].Role == "user" {
-					lastUserMsg = m.messages[i].Content
-					break
-				}
-			}
-			if lastUserMsg != "" {
-				words := strings.Fields(lastUserMsg)
-				if len(words) > 0 {
-					titleWords := words
-					if len(words) > 5 {
-						titleWords = words[:5]
-					}
-					newTitle := strings.Join(titleWords, "-")
-					oldPath := filepath.Join(chatsPath, m.chatName+".json")
-					newPath := filepath.Join(chatsPath, newTitle+".json")
-					if err := os.Rename(oldPath, newPath); err == nil {
-						m.chatName = newTitle
-						m.status = "Title generated successfully"
-					}
-				}
-			}
+		if m.countRole("user") == 0 {
+			m.status = "Nothing to title yet"
+			return true, nil
 		}
-		return true
+		// Ask the model for a title in the background
+		if jobRunner.Enqueue(backgroundJob{Kind: jobTitle, ChatID: m.chatName, Model: m.model, Force: true}) {
+			m.status = "Generating title..."
+		} else {
+			m.status = "Title generation already in progress"
+		}
+		return true, nil
 	case ":f":
-		chatFile, err := loadChatWithMetadata(m.chatName)
+		favorite := false
+		err := updateChatMetadata(m.chatName, func(meta *ChatMetadata) {
+			meta.Favorite = !meta.Favorite
+			favorite = meta.Favorite
+		})
 		if err == nil {
-			chatFile.Metadata.Favorite = !chatFile.Metadata.Favorite
-			if err := saveChat(m.chatName, chatFile.Messages); err == nil {
-				status := "unfavorited"
-				if chatFile.Metadata.Favorite {
-					status = "favorited"
-				}
-				m.status = fmt.Sprintf("Chat %s", status)
+			status := "unfavorited"
+			if favorite {
+				status = "favorited"
 			}
+			m.status = fmt.Sprintf("Chat %s", status)
 		}
-		return true
+		return true, nil
 	case ":q":
 		if err := saveChat(m.chatName, m.messages); err == nil {
 			m.quitting = true
-			return true
+			return true, nil
 		}
-		return true
+		return true, nil
+	case ":delete":
+		if m.loading {
+			m.status = "Wait for the response before deleting the chat"
+			return true, nil
+		}
+		if err := trashChat(m.chatName); err != nil {
+			m.status = fmt.Sprintf("Delete error: %v", err)
+			return true, nil
+		}
+		m.deleted = true
+		m.quitting = true
+		return true, nil
 	default:
-		return false
+		return false, nil
+	}
+}
+
+// visibleIndices returns the indices in messages of all non-system messages
+func (m ChatModel) visibleIndices() []int {
+	var indices []int
+	for i, msg := range m.messages {
+		if msg.Role != "system" {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// messageLabel renders a message heading with its number and branch position
+func (m ChatModel) messageLabel(role string, idx, number int) string {
+	label := fmt.Sprintf("%s #%d", role, number)
+	if idx < len(m.branches) && m.branches[idx].Count > 1 {
+		pos := m.branches[idx]
+		if m.messages[idx].Role == "assistant" {
+			// Alternative replies are swiped through with ←/→
+			label += fmt.Sprintf(" ◀ %d/%d ▶", pos.Index, pos.Count)
+			if pos.Chosen {
+				label += " ✓"
+			}
+		} else {
+			label += fmt.Sprintf(" (%d/%d)", pos.Index, pos.Count)
+		}
+	}
+	if idx < len(m.pinned) && m.pinned[idx] {
+		label += " [pinned]"
+	}
+	return label + ": "
+}
+
+// parseMessageNumber resolves the visible message number in a command to an index in messages
+func (m ChatModel) parseMessageNumber(fields []string) (int, bool) {
+	if len(fields) < 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(fields[1])
+	indices := m.visibleIndices()
+	if err != nil || n < 1 || n > len(indices) {
+		return 0, false
+	}
+	return indices[n-1], true
+}
+
+// refreshBranches reloads the branch and pin indicators for the active path
+func (m *ChatModel) refreshBranches() {
+	chatFile, err := loadChatWithMetadata(m.chatName)
+	if err != nil {
+		m.branches = nil
+		m.pinned = nil
+		return
+	}
+	m.branches = branchPositions(chatFile)
+	m.pinned = pinnedPositions(chatFile)
+}
+
+// togglePin pins or unpins message idx so context trimming always keeps it
+func (m *ChatModel) togglePin(idx int) {
+	pinned := !(idx < len(m.pinned) && m.pinned[idx])
+	found := false
+	err := updateChat(m.chatName, func(chatFile *ChatFile) {
+		found = setPinned(chatFile, idx, pinned)
+	})
+	if err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	if !found {
+		m.status = "Message is not saved yet"
+		return
+	}
+	m.refreshBranches()
+	if pinned {
+		m.status = "Message pinned in context"
+	} else {
+		m.status = "Message unpinned"
+	}
+}
+
+// editTags shows the chat's tags, or adds and removes tags ("work -draft")
+func (m *ChatModel) editTags(edits []string) {
+	var tags []string
+	err := updateChatMetadata(m.chatName, func(meta *ChatMetadata) {
+		meta.Tags = applyTagEdits(meta.Tags, edits)
+		tags = meta.Tags
+	})
+	if err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	if len(tags) == 0 {
+		m.status = "No tags; use :tag name to add one or :tag -name to remove it"
+		return
+	}
+	m.status = "Tags: #" + strings.Join(tags, " #")
+}
+
+// exportChat writes the chat to a file, e.g. ":export html +system"
+func (m *ChatModel) exportChat(args []string) {
+	opts, err := parseExportArgs(args)
+	if err != nil {
+		m.status = fmt.Sprintf("%v; usage: :export [md|html|jsonl] [+system] [+reasoning] [-metadata]", err)
+		return
+	}
+	if err := saveChat(m.chatName, m.messages); err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	path, err := exportChatToFile(m.chatName, opts, "")
+	if err != nil {
+		m.status = fmt.Sprintf("Export error: %v", err)
+		return
+	}
+	m.status = "Exported to " + path
+}
+
+// copyToClipboard copies a message or one of its code blocks, e.g. ":copy",
+// ":copy 3" or ":copy code 2". The last reply is used when no number is given.
+func (m *ChatModel) copyToClipboard(args []string) tea.Cmd {
+	const usage = "usage: :copy [N] [code [K]]"
+	idx := -1
+	if len(args) > 0 && args[0] != "code" {
+		var ok bool
+		if idx, ok = m.parseMessageNumber(append([]string{":copy"}, args...)); !ok {
+			m.status = "No such message; " + usage
+			return nil
+		}
+		args = args[1:]
+	} else {
+		for i := len(m.messages) - 1; i >= 0; i-- {
+			if m.messages[i].Role == "assistant" {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			m.status = "No reply to copy yet"
+			return nil
+		}
+	}
+	text, what := m.messages[idx].Content, "message"
+	if len(args) > 0 {
+		if args[0] != "code" || len(args) > 2 {
+			m.status = usage
+			return nil
+		}
+		blocks := codeBlocks(text)
+		k := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 || n > len(blocks) {
+				m.status = fmt.Sprintf("The message has %d code block(s); %s", len(blocks), usage)
+				return nil
+			}
+			k = n
+		} else if len(blocks) != 1 {
+			m.status = fmt.Sprintf("The message has %d code blocks; pick one with :copy code K", len(blocks))
+			return nil
+		}
+		text, what = blocks[k-1], fmt.Sprintf("code block %d", k)
+	}
+	m.status = "Copying..."
+	return copyCmd(text, what)
+}
+
+// switchProfile shows the chat's profile, switches it to another one, or
+// with "none" goes back to the global key and default parameters. Before
+// the first message the profile's prompt replaces the system prompt too.
+func (m *ChatModel) switchProfile(name string) {
+	if m.loading {
+		m.status = "Wait for the response before switching profiles"
+		return
+	}
+	if name == "" {
+		chatFile, err := loadChatWithMetadata(m.chatName)
+		if err != nil {
+			m.status = fmt.Sprintf("Load error: %v", err)
+			return
+		}
+		meta := chatFile.Metadata
+		if meta.Profile == "" && meta.APIKey == "" && meta.Params == nil {
+			m.status = "No profile; using the active key and default parameters"
+			return
+		}
+		params := GenerationParams{}
+		if meta.Params != nil {
+			params = *meta.Params
+		}
+		key := meta.APIKey
+		if key == "" {
+			key = "active key"
+		}
+		m.status = fmt.Sprintf("Profile: %s (key %s, %s)", meta.Profile, key, params)
+		return
+	}
+
+	var profile Profile
+	if name != "none" {
+		var err error
+		if profile, err = findProfile(name); err != nil {
+			m.status = err.Error()
+			return
+		}
+	}
+	prompt := ""
+	if name != "none" && m.countRole("user") == 0 {
+		content, err := profilePromptContent(profile)
+		if err != nil {
+			m.status = err.Error()
+			return
+		}
+		prompt = content
+	}
+	if prompt != "" && len(m.messages) > 0 && m.messages[0].Role == "system" && m.messages[0].Content != prompt {
+		m.messages[0].Content = prompt
+		if err := saveChat(m.chatName, m.messages); err != nil {
+			m.status = fmt.Sprintf("Save error: %v", err)
+			return
+		}
+	}
+	model := m.model
+	err := updateChatMetadata(m.chatName, func(meta *ChatMetadata) {
+		if name == "none" {
+			clearProfile(meta)
+			return
+		}
+		applyProfile(meta, profile)
+		model = meta.Model
+	})
+	if err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	m.model = model
+	if name == "none" {
+		m.status = "Profile cleared; using the active key and default parameters"
+	} else {
+		m.status = fmt.Sprintf("Switched to profile %s (model %s)", profile.Name, m.model)
+	}
+}
+
+// setFolder shows the chat's folder, or files it under a new one ("/" for none)
+func (m *ChatModel) setFolder(folder string) {
+	if folder == "" {
+		current := ""
+		if chatFile, err := loadChatWithMetadata(m.chatName); err == nil {
+			current = chatFile.Metadata.Folder
+		}
+		m.status = "Folder: /" + current
+		return
+	}
+	if err := moveChatsToFolder([]string{m.chatName}, folder); err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	m.status = "Moved to folder /" + normalizeFolder(folder)
+}
+
+// setContextStrategy shows or overrides the context strategy of this chat
+func (m *ChatModel) setContextStrategy(args []string) {
+	if len(args) == 0 {
+		strategy := loadContextSettings().Strategy
+		if chatFile, err := loadChatWithMetadata(m.chatName); err == nil && chatFile.Metadata.ContextStrategy != "" {
+			strategy = chatFile.Metadata.ContextStrategy
+		}
+		m.status = fmt.Sprintf("Context strategy: %s (~%d of %d tokens)", strategy, estimateTokens(m.messages), m.contextLen)
+		return
+	}
+	strategy := args[0]
+	if strategy == "default" {
+		strategy = ""
+	} else if !isContextStrategy(strategy) {
+		m.status = "Usage: :context [sliding|pinned|summarize|default]"
+		return
+	}
+	err := updateChatMetadata(m.chatName, func(meta *ChatMetadata) {
+		meta.ContextStrategy = strategy
+	})
+	if err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	if strategy == "" {
+		strategy = "default (" + loadContextSettings().Strategy + ")"
+	}
+	m.status = "Context strategy set to " + strategy
+}
+
+// switchBranchAt moves message idx to a sibling branch and shows that path
+func (m *ChatModel) switchBranchAt(idx, delta int) {
+	chatFile, err := loadChatWithMetadata(m.chatName)
+	if err != nil {
+		m.status = fmt.Sprintf("Load error: %v", err)
+		return
+	}
+	if !switchBranch(chatFile, idx, delta) {
+		m.status = "No other branches at this message"
+		return
+	}
+	if err := saveChatFile(m.chatName, chatFile); err != nil {
+		m.status = fmt.Sprintf("Save error: %v", err)
+		return
+	}
+	m.messages = chatFile.Messages
+	m.branches = branchPositions(chatFile)
+	m.editing = false
+	pos := m.branches[min(idx, len(m.branches)-1)]
+	m.status = fmt.Sprintf("Switched to branch %d/%d", pos.Index, pos.Count)
+}
+
+// switchLatestBranch switches the branch of the newest message that has siblings
+func (m *ChatModel) switchLatestBranch(delta int) {
+	for idx := len(m.branches) - 1; idx >= 0; idx-- {
+		if m.branches[idx].Count > 1 {
+			m.switchBranchAt(idx, delta)
+			return
+		}
 	}
+	m.status = "No branches in this chat"
 }
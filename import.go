@@ -0,0 +1,512 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Import sources recorded in ChatMetadata.ImportSource
+const (
+	importChatGPT = "chatgpt"
+	importClaude  = "claude"
+)
+
+// claudeRootParent is the parent UUID Claude exports give first messages
+const claudeRootParent = "00000000-0000-4000-8000-000000000000"
+
+// importedNode is a message of a foreign export before it becomes a MessageNode.
+// Nodes without a message (hidden, tool or empty ones) only keep the tree connected.
+type importedNode struct {
+	ID       string
+	ParentID string
+	Message  *Message
+	Created  time.Time
+}
+
+// importedChat is a conversation parsed from a foreign export. Nodes are
+// ordered so that parents come before their children.
+type importedChat struct {
+	Source  string // e.g. "chatgpt:<conversation id>", used to skip duplicates
+	Title   string
+	Model   string
+	Created time.Time
+	Updated time.Time
+	Nodes   []importedNode
+	Current string // ID of the node the conversation was left at
+}
+
+// skippedImport records a conversation that was not imported
+type skippedImport struct {
+	Title  string
+	Reason string
+}
+
+// ImportReport summarizes an import run
+type ImportReport struct {
+	Chats    int
+	Messages int
+	Skipped  []skippedImport
+}
+
+// String describes the report for display
+func (r ImportReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Imported %d chats with %d messages.", r.Chats, r.Messages)
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&b, "\nSkipped %d:", len(r.Skipped))
+		for i, s := range r.Skipped {
+			if i == 10 {
+				fmt.Fprintf(&b, "\n  ...and %d more", len(r.Skipped)-i)
+				break
+			}
+			fmt.Fprintf(&b, "\n  %s (%s)", s.Title, s.Reason)
+		}
+	}
+	return b.String()
+}
+
+// readExportConversations returns the conversations.json data of an export,
+// given the archive itself, its extracted directory or the JSON file
+func readExportConversations(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export '%s': %w", path, err)
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, "conversations.json")
+	} else if strings.EqualFold(filepath.Ext(path), ".zip") {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open export archive '%s': %w", path, err)
+		}
+		defer archive.Close()
+		for _, f := range archive.File {
+			if filepath.Base(f.Name) != "conversations.json" {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read '%s' in archive: %w", f.Name, err)
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+		return nil, fmt.Errorf("no conversations.json in archive '%s'", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export '%s': %w", path, err)
+	}
+	return data, nil
+}
+
+// parseExport detects the export format and parses its conversations
+func parseExport(data []byte) ([]importedChat, error) {
+	var probe []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse conversations: %w", err)
+	}
+	if len(probe) == 0 {
+		return nil, nil
+	}
+	if _, ok := probe[0]["mapping"]; ok {
+		return parseChatGPTExport(data)
+	}
+	if _, ok := probe[0]["chat_messages"]; ok {
+		return parseClaudeExport(data)
+	}
+	return nil, fmt.Errorf("unrecognized export format; expected a ChatGPT or Claude conversations.json")
+}
+
+// unixSeconds converts the fractional Unix timestamps of ChatGPT exports
+func unixSeconds(ts *float64) time.Time {
+	if ts == nil || *ts <= 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(*ts)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// parseChatGPTExport parses a ChatGPT conversations.json
+func parseChatGPTExport(data []byte) ([]importedChat, error) {
+	type chatGPTMessage struct {
+		ID     string `json:"id"`
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		CreateTime *float64 `json:"create_time"`
+		Content    struct {
+			ContentType string            `json:"content_type"`
+			Parts       []json.RawMessage `json:"parts"`
+			Text        string            `json:"text"`
+		} `json:"content"`
+		Recipient string `json:"recipient"`
+		Metadata  struct {
+			ModelSlug string `json:"model_slug"`
+			Hidden    bool   `json:"is_visually_hidden_from_conversation"`
+		} `json:"metadata"`
+	}
+	type chatGPTNode struct {
+		ID       string          `json:"id"`
+		Message  *chatGPTMessage `json:"message"`
+		Parent   *string         `json:"parent"`
+		Children []string        `json:"children"`
+	}
+	var conversations []struct {
+		ID               string                 `json:"id"`
+		ConversationID   string                 `json:"conversation_id"`
+		Title            string                 `json:"title"`
+		CreateTime       *float64               `json:"create_time"`
+		UpdateTime       *float64               `json:"update_time"`
+		Mapping          map[string]chatGPTNode `json:"mapping"`
+		CurrentNode      string                 `json:"current_node"`
+		DefaultModelSlug string                 `json:"default_model_slug"`
+	}
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("failed to parse ChatGPT conversations: %w", err)
+	}
+
+	var chats []importedChat
+	for _, conv := range conversations {
+		id := conv.ConversationID
+		if id == "" {
+			id = conv.ID
+		}
+		chat := importedChat{
+			Source:  importChatGPT + ":" + id,
+			Title:   conv.Title,
+			Created: unixSeconds(conv.CreateTime),
+			Updated: unixSeconds(conv.UpdateTime),
+			Current: conv.CurrentNode,
+		}
+		modelSlug := conv.DefaultModelSlug
+
+		// Walk from the roots so parents precede children and siblings keep their order
+		var roots []string
+		for nodeID, node := range conv.Mapping {
+			if node.Parent == nil || *node.Parent == "" {
+				roots = append(roots, nodeID)
+			}
+		}
+		sort.Strings(roots)
+		stack := append([]string{}, roots...)
+		for len(stack) > 0 {
+			nodeID := stack[0]
+			stack = stack[1:]
+			node, ok := conv.Mapping[nodeID]
+			if !ok {
+				continue
+			}
+			imported := importedNode{ID: nodeID}
+			if node.Parent != nil {
+				imported.ParentID = *node.Parent
+			}
+			if msg := node.Message; msg != nil {
+				imported.Created = unixSeconds(msg.CreateTime)
+				role := msg.Author.Role
+				visible := (role == "user" || role == "assistant" || role == "system") &&
+					!msg.Metadata.Hidden && (msg.Recipient == "" || msg.Recipient == "all")
+				if content := chatGPTContent(msg.Content.ContentType, msg.Content.Parts, msg.Content.Text); visible && content != "" {
+					imported.Message = &Message{Role: role, Content: content}
+				}
+				if role == "assistant" && msg.Metadata.ModelSlug != "" {
+					modelSlug = msg.Metadata.ModelSlug
+				}
+			}
+			chat.Nodes = append(chat.Nodes, imported)
+			stack = append(append([]string{}, node.Children...), stack...)
+		}
+		if modelSlug != "" && modelSlug != "auto" {
+			chat.Model = "openai/" + modelSlug
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+// chatGPTContent extracts the readable text of a ChatGPT message
+func chatGPTContent(contentType string, parts []json.RawMessage, text string) string {
+	switch contentType {
+	case "text", "multimodal_text":
+		var texts []string
+		for _, part := range parts {
+			var s string
+			if err := json.Unmarshal(part, &s); err == nil {
+				if s = strings.TrimSpace(s); s != "" {
+					texts = append(texts, s)
+				}
+				continue
+			}
+			var obj struct {
+				ContentType string `json:"content_type"`
+			}
+			if json.Unmarshal(part, &obj) == nil && strings.Contains(obj.ContentType, "image") {
+				texts = append(texts, "[image]")
+			}
+		}
+		return strings.Join(texts, "\n\n")
+	case "code":
+		if strings.TrimSpace(text) == "" {
+			return ""
+		}
+		return "```\n" + text + "\n```"
+	default:
+		// Browsing results, tool output, reasoning traces and the like
+		return ""
+	}
+}
+
+// parseClaudeExport parses the conversations.json of a Claude data export
+func parseClaudeExport(data []byte) ([]importedChat, error) {
+	type claudeContent struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		Thinking string `json:"thinking"`
+	}
+	var conversations []struct {
+		UUID        string    `json:"uuid"`
+		Name        string    `json:"name"`
+		Model       string    `json:"model"`
+		CreatedAt   time.Time `json:"created_at"`
+		UpdatedAt   time.Time `json:"updated_at"`
+		CurrentLeaf string    `json:"current_leaf_message_uuid"`
+		Messages    []struct {
+			UUID        string          `json:"uuid"`
+			Text        string          `json:"text"`
+			Content     []claudeContent `json:"content"`
+			Sender      string          `json:"sender"`
+			CreatedAt   time.Time       `json:"created_at"`
+			Parent      string          `json:"parent_message_uuid"`
+			Attachments []struct {
+				FileName string `json:"file_name"`
+			} `json:"attachments"`
+			Files []struct {
+				FileName string `json:"file_name"`
+			} `json:"files"`
+		} `json:"chat_messages"`
+	}
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("failed to parse Claude conversations: %w", err)
+	}
+
+	var chats []importedChat
+	for _, conv := range conversations {
+		chat := importedChat{
+			Source:  importClaude + ":" + conv.UUID,
+			Title:   conv.Name,
+			Created: conv.CreatedAt,
+			Updated: conv.UpdatedAt,
+			Current: conv.CurrentLeaf,
+		}
+		if conv.Model != "" {
+			chat.Model = "anthropic/" + conv.Model
+		}
+
+		// Older exports have no parent links; their messages form a single thread
+		linked := false
+		for _, msg := range conv.Messages {
+			if msg.Parent != "" {
+				linked = true
+			}
+		}
+		sorted := append(conv.Messages[:0:0], conv.Messages...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+		})
+		previous := ""
+		for _, msg := range sorted {
+			var parts []string
+			if len(msg.Content) > 0 {
+				for _, c := range msg.Content {
+					switch {
+					case c.Type == "text" && strings.TrimSpace(c.Text) != "":
+						parts = append(parts, strings.TrimSpace(c.Text))
+					case c.Type == "thinking" && strings.TrimSpace(c.Thinking) != "":
+						parts = append(parts, "<think>\n"+strings.TrimSpace(c.Thinking)+"\n</think>")
+					}
+				}
+			} else if text := strings.TrimSpace(msg.Text); text != "" {
+				parts = append(parts, text)
+			}
+			for _, f := range append(msg.Attachments, msg.Files...) {
+				if f.FileName != "" {
+					parts = append(parts, "[Attached file: "+f.FileName+"]")
+				}
+			}
+
+			node := importedNode{ID: msg.UUID, ParentID: previous, Created: msg.CreatedAt}
+			if linked {
+				node.ParentID = msg.Parent
+				if node.ParentID == claudeRootParent {
+					node.ParentID = ""
+				}
+			}
+			role := map[string]string{"human": "user", "assistant": "assistant"}[msg.Sender]
+			if role != "" && len(parts) > 0 {
+				node.Message = &Message{Role: role, Content: strings.Join(parts, "\n\n")}
+			}
+			chat.Nodes = append(chat.Nodes, node)
+			previous = msg.UUID
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+// buildImportedChat turns an imported conversation into a ChatFile. With
+// flatten, only the branch the conversation was left at is kept.
+func buildImportedChat(chat importedChat, flatten bool) *ChatFile {
+	chatFile := &ChatFile{}
+	chatFile.Metadata.Title = cleanChatTitle(chat.Title)
+	chatFile.Metadata.Model = chat.Model
+	chatFile.Metadata.CreatedAt = chat.Created
+	chatFile.Metadata.ImportSource = chat.Source
+
+	// Map every source node to its nearest ancestor that holds a message
+	kept := make(map[string]string)
+	lastID := ""
+	for _, node := range chat.Nodes {
+		parentID := kept[node.ParentID]
+		if node.Message == nil {
+			kept[node.ID] = parentID
+			continue
+		}
+		if _, dup := kept[node.ID]; dup || node.ID == "" {
+			continue
+		}
+		created := node.Created
+		if created.IsZero() {
+			created = chat.Created
+		}
+		chatFile.Nodes = append(chatFile.Nodes, MessageNode{ID: node.ID, ParentID: parentID, Message: *node.Message, CreatedAt: created})
+		kept[node.ID] = node.ID
+		lastID = node.ID
+	}
+
+	chatFile.ActiveLeaf = kept[chat.Current]
+	if chatFile.ActiveLeaf == "" {
+		chatFile.ActiveLeaf = lastID
+	}
+	if flatten {
+		chatFile.Nodes = activePath(chatFile)
+	}
+	syncActivePath(chatFile)
+	return chatFile
+}
+
+// importedSources returns the import sources of all chats, including
+// trashed ones so deleted imports are not brought back
+func importedSources() (map[string]bool, error) {
+	sources := make(map[string]bool)
+	for _, dir := range allChatDirs() {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read chat directory: %w", err)
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			name := strings.TrimSuffix(f.Name(), ".json")
+			var chatFile *ChatFile
+			if filepath.Base(dir) != trashDir {
+				chatFile, _, err = readChat(name)
+			} else if data, rerr := os.ReadFile(filepath.Join(dir, f.Name())); rerr == nil {
+				chatFile, err = parseChatSnapshot(name, data)
+			}
+			if err == nil && chatFile != nil && chatFile.Metadata.ImportSource != "" {
+				sources[chatFile.Metadata.ImportSource] = true
+			}
+		}
+	}
+	return sources, nil
+}
+
+// importConversations imports the ChatGPT or Claude export at path
+func importConversations(path string, flatten bool) (ImportReport, error) {
+	var report ImportReport
+	data, err := readExportConversations(path)
+	if err != nil {
+		return report, err
+	}
+	chats, err := parseExport(data)
+	if err != nil {
+		return report, err
+	}
+	sources, err := importedSources()
+	if err != nil {
+		return report, err
+	}
+
+	for _, chat := range chats {
+		title := chat.Title
+		if title == "" {
+			title = chat.Source
+		}
+		if sources[chat.Source] {
+			report.Skipped = append(report.Skipped, skippedImport{Title: title, Reason: "already imported"})
+			continue
+		}
+		chatFile := buildImportedChat(chat, flatten)
+		if len(chatFile.Messages) == 0 {
+			report.Skipped = append(report.Skipped, skippedImport{Title: title, Reason: "no messages"})
+			continue
+		}
+
+		created := chat.Created
+		if created.IsZero() {
+			created = time.Now()
+		}
+		id := newULID(created)
+		if err := saveChatFile(id, chatFile); err != nil {
+			return report, err
+		}
+		// Sort imported chats by when they were last used, not by import time
+		if !chat.Updated.IsZero() {
+			os.Chtimes(chatSnapshotPath(id), chat.Updated, chat.Updated)
+		}
+		sources[chat.Source] = true
+		report.Chats++
+		report.Messages += len(chatFile.Nodes)
+	}
+	return report, nil
+}
+
+// runImportCommand implements "aichat import", returning the exit code
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	flatten := fs.Bool("flatten", false, "keep only the branch each conversation was left at")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: aichat import [flags] <export.zip | export directory | conversations.json>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	code := 0
+	for _, path := range fs.Args() {
+		report, err := importConversations(path, *flatten)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+		fmt.Printf("%s: %s\n", path, report)
+	}
+	return code
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseExport(t *testing.T) {
+	tests := []struct {
+		name      string
+		fixture   string
+		flatten   bool
+		chat      int // Conversation checked
+		wantTitle string
+		wantModel string
+		want      []Message // Active path
+		wantNodes int
+	}{
+		{
+			name:      "ChatGPT keeps regenerated replies",
+			fixture:   "chatgpt_conversations.json",
+			wantTitle: "Sorting in Go",
+			wantModel: "openai/gpt-4o",
+			want: []Message{
+				{Role: "user", Content: "How do I sort a slice?"},
+				{Role: "assistant", Content: "Use slices.Sort.\n\n[image]"},
+			},
+			wantNodes: 3,
+		},
+		{
+			name:      "ChatGPT flattened",
+			fixture:   "chatgpt_conversations.json",
+			flatten:   true,
+			wantTitle: "Sorting in Go",
+			wantModel: "openai/gpt-4o",
+			want: []Message{
+				{Role: "user", Content: "How do I sort a slice?"},
+				{Role: "assistant", Content: "Use slices.Sort.\n\n[image]"},
+			},
+			wantNodes: 2,
+		},
+		{
+			name:      "Claude keeps regenerated replies",
+			fixture:   "claude_conversations.json",
+			wantTitle: "Haiku about rain",
+			wantModel: "anthropic/claude-3-opus",
+			want: []Message{
+				{Role: "user", Content: "Write a haiku about rain.\n\n[Attached file: notes.txt]"},
+				{Role: "assistant", Content: "<think>\nTry a different image.\n</think>\n\nGrey clouds let go"},
+			},
+			wantNodes: 3,
+		},
+		{
+			name:      "Claude export without parent links",
+			fixture:   "claude_conversations.json",
+			chat:      1,
+			wantTitle: "Old export",
+			want: []Message{
+				{Role: "user", Content: "Hello"},
+				{Role: "assistant", Content: "Hi there"},
+			},
+			wantNodes: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			chats, err := parseExport(data)
+			if err != nil {
+				t.Fatalf("parseExport: %v", err)
+			}
+			chatFile := buildImportedChat(chats[tt.chat], tt.flatten)
+			if chatFile.Metadata.Title != tt.wantTitle {
+				t.Errorf("title %q, want %q", chatFile.Metadata.Title, tt.wantTitle)
+			}
+			if chatFile.Metadata.Model != tt.wantModel {
+				t.Errorf("model %q, want %q", chatFile.Metadata.Model, tt.wantModel)
+			}
+			if !slices.Equal(chatFile.Messages, tt.want) {
+				t.Errorf("active path %q, want %q", chatFile.Messages, tt.want)
+			}
+			if len(chatFile.Nodes) != tt.wantNodes {
+				t.Errorf("%d nodes, want %d", len(chatFile.Nodes), tt.wantNodes)
+			}
+		})
+	}
+}
+
+func TestParseExportUnknownFormat(t *testing.T) {
+	if _, err := parseExport([]byte(`[{"messages": []}]`)); err == nil {
+		t.Error("parseExport accepted an unknown format")
+	}
+}
+
+func TestImportConversationsSkipsDuplicates(t *testing.T) {
+	useTempDirs(t)
+	path := filepath.Join("testdata", "chatgpt_conversations.json")
+	report, err := importConversations(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Chats != 1 || report.Messages != 3 || len(report.Skipped) != 1 || report.Skipped[0].Reason != "no messages" {
+		t.Errorf("first import: %+v", report)
+	}
+
+	report, err = importConversations(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Chats != 0 || len(report.Skipped) != 2 || report.Skipped[0].Reason != "already imported" {
+		t.Errorf("second import: %+v", report)
+	}
+}
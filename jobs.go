@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Background job kinds
+const (
+	jobTitle   = "title"
+	jobSummary = "summary"
+	jobTags    = "tags"
+)
+
+// Job states reported to the UI
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// backgroundJob describes a unit of work run outside the UI loop
+type backgroundJob struct {
+	Kind   string
+	ChatID string
+	Model  string
+	Force  bool // Overwrite a title the user chose
+}
+
+// key identifies a job so the same work is not queued twice
+func (j backgroundJob) key() string {
+	return j.Kind + ":" + j.ChatID
+}
+
+// jobStatusMsg reports job progress to the attached Bubble Tea program
+type jobStatusMsg struct {
+	Job    backgroundJob
+	State  string
+	Result string
+	Err    error
+}
+
+// JobRunner executes background jobs one at a time and reports their
+// progress to whichever Bubble Tea program is attached
+type JobRunner struct {
+	mu       sync.Mutex
+	queue    chan backgroundJob
+	program  *tea.Program
+	inflight map[string]bool
+	pending  sync.WaitGroup
+}
+
+// NewJobRunner creates a job runner and starts its worker
+func NewJobRunner() *JobRunner {
+	r := &JobRunner{
+		queue:    make(chan backgroundJob, 64),
+		inflight: make(map[string]bool),
+	}
+	go r.work()
+	return r
+}
+
+var jobRunner = NewJobRunner()
+
+// Enqueue schedules a job unless an identical one is already pending
+func (r *JobRunner) Enqueue(job backgroundJob) bool {
+	r.mu.Lock()
+	if r.inflight[job.key()] {
+		r.mu.Unlock()
+		return false
+	}
+	r.inflight[job.key()] = true
+	r.pending.Add(1)
+	r.mu.Unlock()
+
+	select {
+	case r.queue <- job:
+		r.report(jobStatusMsg{Job: job, State: jobQueued})
+		return true
+	default:
+		r.finish(job)
+		return false
+	}
+}
+
+// Attach routes progress updates to p until Detach is called
+func (r *JobRunner) Attach(p *tea.Program) {
+	r.mu.Lock()
+	r.program = p
+	r.mu.Unlock()
+}
+
+// Detach stops routing progress updates to the current program
+func (r *JobRunner) Detach() {
+	r.mu.Lock()
+	r.program = nil
+	r.mu.Unlock()
+}
+
+// Pending reports how many jobs are queued or running
+func (r *JobRunner) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.inflight)
+}
+
+// Wait blocks until all jobs finish or the timeout elapses
+func (r *JobRunner) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (r *JobRunner) report(msg jobStatusMsg) {
+	r.mu.Lock()
+	p := r.program
+	r.mu.Unlock()
+	if p != nil {
+		// Send from a goroutine so a busy UI never stalls the worker
+		go p.Send(msg)
+	}
+}
+
+func (r *JobRunner) finish(job backgroundJob) {
+	r.mu.Lock()
+	delete(r.inflight, job.key())
+	r.mu.Unlock()
+	r.pending.Done()
+}
+
+func (r *JobRunner) work() {
+	for job := range r.queue {
+		r.report(jobStatusMsg{Job: job, State: jobRunning})
+		result, err := runJob(job)
+		if err != nil {
+			logger.Error("background job failed", "kind", job.Kind, "chat", job.ChatID, "err", err)
+			r.report(jobStatusMsg{Job: job, State: jobFailed, Err: err})
+		} else {
+			r.report(jobStatusMsg{Job: job, State: jobDone, Result: result})
+		}
+		r.finish(job)
+	}
+}
+
+// runJob performs a job and persists its result into the chat metadata
+func runJob(job backgroundJob) (string, error) {
+	chatFile, err := loadChatWithMetadata(job.ChatID)
+	if err != nil {
+		return "", err
+	}
+
+	switch job.Kind {
+	case jobTitle:
+		if !job.Force && chatFile.Metadata.Title != "" && !chatFile.Metadata.PlaceholderTitle {
+			return chatFile.Metadata.Title, nil
+		}
+		title, err := generateChatTitle(chatFile.Messages, job.Model, chatFile.Metadata.APIKey)
+		if err != nil {
+			return "", err
+		}
+		err = updateChatMetadata(job.ChatID, func(meta *ChatMetadata) {
+			// The user may have renamed the chat while the job ran
+			if job.Force || meta.Title == "" || meta.PlaceholderTitle {
+				meta.Title = title
+				meta.PlaceholderTitle = false
+			}
+		})
+		return title, err
+	case jobSummary:
+		summary, err := generateChatSummaryText(chatFile.Messages, job.Model, chatFile.Metadata.APIKey)
+		if err != nil {
+			return "", err
+		}
+		err = updateChatMetadata(job.ChatID, func(meta *ChatMetadata) {
+			meta.Summary = summary
+		})
+		return summary, err
+	case jobTags:
+		tags, err := generateChatTags(chatFile.Messages, chatFile.Metadata.Tags, job.Model, chatFile.Metadata.APIKey)
+		if err != nil {
+			return "", err
+		}
+		err = updateChatMetadata(job.ChatID, func(meta *ChatMetadata) {
+			// Add to the user's tags rather than replacing them
+			meta.Tags = normalizeTags(append(meta.Tags, tags...))
+		})
+		return strings.Join(tags, ", "), err
+	default:
+		return "", fmt.Errorf("unknown job kind '%s'", job.Kind)
+	}
+}
+
+// completeChat sends messages to the model with the default parameters and
+// returns the full reply. apiKey is the title of the chat's stored key, or ""
+// for the configured key.
+func completeChat(messages []Message, model, apiKey string) (string, error) {
+	return streamChatResponseGUI(messages, model, requestOptions{APIKey: apiKey}, nil)
+}
+
+// conversationExcerpt renders the non-system messages as plain text,
+// keeping the first exchange and the most recent messages
+func conversationExcerpt(messages []Message, maxMessages int) string {
+	var visible []Message
+	for _, msg := range messages {
+		if msg.Role != "system" {
+			visible = append(visible, msg)
+		}
+	}
+	if len(visible) > maxMessages {
+		visible = append(visible[:2:2], visible[len(visible)-(maxMessages-2):]...)
+	}
+	var b strings.Builder
+	for _, msg := range visible {
+		content := msg.Content
+		if len(content) > 2000 {
+			// Cut on a rune boundary so the request stays valid UTF-8
+			cut := 2000
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			content = content[:cut] + "..."
+		}
+		fmt.Fprintf(&b, "%s: %s\n", roleHeading(msg.Role), content)
+	}
+	return b.String()
+}
+
+// generateChatTitle asks the model for a short title for a conversation
+func generateChatTitle(messages []Message, model, apiKey string) (string, error) {
+	excerpt := conversationExcerpt(messages, 6)
+	if excerpt == "" {
+		return "", fmt.Errorf("no messages to title")
+	}
+	titleMessages := []Message{
+		{Role: "system", Content: "You are a helpful assistant that generates concise, descriptive titles for chat conversations."},
+		{Role: "user", Content: "Conversation:\n" + excerpt + "\nDevise a short title for this chat, no longer than 5 words so that it can be easily picked and recognized from a list of chats. Return only the title, nothing else."},
+	}
+	title, err := completeChat(titleMessages, model, apiKey)
+	if err != nil {
+		return "", err
+	}
+	words := strings.Fields(cleanChatTitle(title))
+	if len(words) > 5 {
+		words = words[:5]
+	}
+	title = cleanChatTitle(strings.Join(words, " "))
+	if title == "" {
+		return "", fmt.Errorf("model returned an empty title")
+	}
+	return title, nil
+}
+
+// generateChatSummaryText asks the model for a short summary of a conversation
+func generateChatSummaryText(messages []Message, model, apiKey string) (string, error) {
+	excerpt := conversationExcerpt(messages, 20)
+	if excerpt == "" {
+		return "", fmt.Errorf("no messages to summarize")
+	}
+	summaryMessages := []Message{
+		{Role: "system", Content: "You summarize chat conversations."},
+		{Role: "user", Content: "Conversation:\n" + excerpt + "\nPlease provide a short summary of the chat, no longer than 2 sentences."},
+	}
+	summary, err := completeChat(summaryMessages, model, apiKey)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// jobStatusText describes a job update for the status bar
+func jobStatusText(msg jobStatusMsg) string {
+	switch msg.State {
+	case jobQueued:
+		return fmt.Sprintf("%s queued", msg.Job.Kind)
+	case jobRunning:
+		return fmt.Sprintf("generating %s...", msg.Job.Kind)
+	case jobFailed:
+		return fmt.Sprintf("%s failed: %v", msg.Job.Kind, msg.Err)
+	default:
+		return fmt.Sprintf("%s updated", msg.Job.Kind)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Journal event types
+const (
+	eventMessageAdded      = "message_added"
+	eventMessageEdited     = "message_edited"
+	eventMessagesTruncated = "messages_truncated"
+	eventActiveLeafChanged = "active_leaf_changed"
+	eventMetadataChanged   = "metadata_changed"
+	eventMessagePinned     = "message_pinned"
+	eventMessageChosen     = "message_chosen"
+)
+
+// journalCompactThreshold is the number of journal events after which the
+// journal is folded back into the snapshot file
+const journalCompactThreshold = 50
+
+// ChatEvent is a single entry in a chat's append-only journal.
+// Index-based events predate the message tree and address the active path.
+type ChatEvent struct {
+	Type       string        `json:"type"`
+	Time       time.Time     `json:"time"`
+	Index      int           `json:"index,omitempty"`
+	NodeID     string        `json:"node_id,omitempty"`
+	Node       *MessageNode  `json:"node,omitempty"`
+	Message    *Message      `json:"message,omitempty"`
+	ActiveLeaf string        `json:"active_leaf,omitempty"`
+	Metadata   *ChatMetadata `json:"metadata,omitempty"`
+	Pinned     bool          `json:"pinned,omitempty"`
+	Chosen     bool          `json:"chosen,omitempty"`
+}
+
+// chatStoreMu serializes all writes to chat snapshots and journals
+var chatStoreMu sync.Mutex
+
+// chatSnapshotPath returns the path of a chat's snapshot file
+func chatSnapshotPath(name string) string {
+	return filepath.Join(chatDir(name), name+".json")
+}
+
+// chatJournalPath returns the path of a chat's journal file
+func chatJournalPath(name string) string {
+	return filepath.Join(chatDir(name), name+".journal.jsonl")
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// parseChatSnapshot decodes a snapshot file, migrating older schema versions
+// such as the legacy bare message array in memory
+func parseChatSnapshot(name string, data []byte) (*ChatFile, error) {
+	data, err := openData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chat file '%s': %w", name, err)
+	}
+	data, _, err = migrateData(chatSchema, name, data)
+	if err != nil {
+		return nil, err
+	}
+	var chatFile ChatFile
+	if err := json.Unmarshal(data, &chatFile); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal chat file '%s': %w", name, err)
+	}
+	return &chatFile, nil
+}
+
+// readChatJournal reads all complete events from a chat's journal. A torn
+// trailing line left by a crash mid-append is ignored; an unreadable line
+// elsewhere is logged and skipped, so the saves after it still replay.
+func readChatJournal(name string) ([]ChatEvent, error) {
+	data, err := os.ReadFile(chatJournalPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read journal for chat '%s': %w", name, err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan journal for chat '%s': %w", name, err)
+	}
+
+	var events []ChatEvent
+	for i, line := range lines {
+		plain, err := openData([]byte(line))
+		if errors.Is(err, errVaultLocked) {
+			return nil, fmt.Errorf("failed to open journal for chat '%s': %w", name, err)
+		}
+		var event ChatEvent
+		if err == nil {
+			err = json.Unmarshal(plain, &event)
+		}
+		if err != nil {
+			if i < len(lines)-1 {
+				// A failed append left this line behind; later saves are intact
+				logger.Error("skipping unreadable journal event", "chat", name, "line", i+1, "err", err)
+			}
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// applyChatEvent replays a single journal event onto a chat
+func applyChatEvent(chatFile *ChatFile, event ChatEvent) {
+	switch event.Type {
+	case eventMessageAdded:
+		if event.Node != nil {
+			chatFile.Nodes = append(chatFile.Nodes, *event.Node)
+		} else if event.Message != nil {
+			node := MessageNode{ID: legacyNodeID(len(chatFile.Nodes)), ParentID: chatFile.ActiveLeaf, Message: *event.Message, CreatedAt: event.Time}
+			chatFile.Nodes = append(chatFile.Nodes, node)
+			chatFile.ActiveLeaf = node.ID
+		}
+	case eventMessageEdited:
+		if event.Message == nil {
+			return
+		}
+		id := event.NodeID
+		if id == "" {
+			path := activePath(chatFile)
+			if event.Index < 0 || event.Index >= len(path) {
+				return
+			}
+			id = path[event.Index].ID
+		}
+		if idx := findNode(chatFile, id); idx >= 0 {
+			chatFile.Nodes[idx].Message = *event.Message
+		}
+	case eventMessagesTruncated:
+		path := activePath(chatFile)
+		if event.Index <= 0 {
+			chatFile.ActiveLeaf = ""
+		} else if event.Index < len(path) {
+			chatFile.ActiveLeaf = path[event.Index-1].ID
+		}
+	case eventMessagePinned:
+		if idx := findNode(chatFile, event.NodeID); idx >= 0 {
+			chatFile.Nodes[idx].Pinned = event.Pinned
+		}
+	case eventMessageChosen:
+		if idx := findNode(chatFile, event.NodeID); idx >= 0 {
+			chatFile.Nodes[idx].Chosen = event.Chosen
+		}
+	case eventActiveLeafChanged:
+		chatFile.ActiveLeaf = event.ActiveLeaf
+	case eventMetadataChanged:
+		if event.Metadata != nil {
+			chatFile.Metadata = *event.Metadata
+		}
+	}
+}
+
+// readChat loads a chat snapshot and replays its journal on top of it.
+// It also returns the number of journal events that were replayed.
+func readChat(name string) (*ChatFile, int, error) {
+	chatFile := &ChatFile{}
+	data, err := os.ReadFile(chatSnapshotPath(name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("failed to read chat file '%s': %w", name, err)
+		}
+		if _, jerr := os.Stat(chatJournalPath(name)); jerr != nil {
+			return nil, 0, fmt.Errorf("failed to read chat file '%s': %w", name, err)
+		}
+	} else {
+		chatFile, err = parseChatSnapshot(name, data)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	ensureTree(chatFile)
+
+	events, err := readChatJournal(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, event := range events {
+		applyChatEvent(chatFile, event)
+	}
+	syncActivePath(chatFile)
+	return chatFile, len(events), nil
+}
+
+// diffChat computes the journal events that turn old into new
+func diffChat(old, new *ChatFile) []ChatEvent {
+	now := time.Now()
+	var events []ChatEvent
+
+	existing := make(map[string]MessageNode, len(old.Nodes))
+	for _, node := range old.Nodes {
+		existing[node.ID] = node
+	}
+	for _, node := range new.Nodes {
+		prev, ok := existing[node.ID]
+		if !ok {
+			added := node
+			events = append(events, ChatEvent{Type: eventMessageAdded, Time: now, Node: &added})
+			continue
+		}
+		if prev.Message != node.Message {
+			msg := node.Message
+			events = append(events, ChatEvent{Type: eventMessageEdited, Time: now, NodeID: node.ID, Message: &msg})
+		}
+		if prev.Pinned != node.Pinned {
+			events = append(events, ChatEvent{Type: eventMessagePinned, Time: now, NodeID: node.ID, Pinned: node.Pinned})
+		}
+		if prev.Chosen != node.Chosen {
+			events = append(events, ChatEvent{Type: eventMessageChosen, Time: now, NodeID: node.ID, Chosen: node.Chosen})
+		}
+	}
+
+	if old.ActiveLeaf != new.ActiveLeaf {
+		events = append(events, ChatEvent{Type: eventActiveLeafChanged, Time: now, ActiveLeaf: new.ActiveLeaf})
+	}
+
+	if !metadataEqual(old.Metadata, new.Metadata) {
+		meta := new.Metadata
+		events = append(events, ChatEvent{Type: eventMetadataChanged, Time: now, Metadata: &meta})
+	}
+	return events
+}
+
+// metadataEqual reports whether two metadata values serialize identically
+func metadataEqual(a, b ChatMetadata) bool {
+	aData, errA := json.Marshal(a)
+	bData, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aData, bData)
+}
+
+// appendChatEvents appends events to a chat's journal
+func appendChatEvents(name string, events []ChatEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal journal event: %w", err)
+		}
+		if line, err = sealData(line, true); err != nil {
+			return fmt.Errorf("failed to seal journal event: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(chatJournalPath(name), os.O_APPEND|os.O_CREATE|os.O_RDWR, chatFileMode())
+	if err != nil {
+		return fmt.Errorf("failed to open journal for chat '%s': %w", name, err)
+	}
+	defer f.Close()
+	// Start on a fresh line if an earlier append was torn, so the new events
+	// are not glued onto the broken one
+	data := buf.Bytes()
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to append to journal for chat '%s': %w", name, err)
+	}
+	return f.Sync()
+}
+
+// writeChatSnapshot writes the full chat snapshot and drops the journal
+func writeChatSnapshot(name string, chatFile *ChatFile) error {
+	chatFile.SchemaVersion = chatSchema.Version()
+	data, err := json.MarshalIndent(chatFile, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat: %w", err)
+	}
+	if data, err = sealData(data, true); err != nil {
+		return fmt.Errorf("failed to seal chat '%s': %w", name, err)
+	}
+	if err := writeFileAtomic(chatSnapshotPath(name), data, chatFileMode()); err != nil {
+		return fmt.Errorf("failed to write chat file '%s': %w", name, err)
+	}
+	if err := os.Remove(chatJournalPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal for chat '%s': %w", name, err)
+	}
+	return nil
+}
+
+// storeChat persists chatFile by journaling the changes since the last save,
+// compacting into the snapshot once the journal grows past the threshold
+func storeChat(name string, chatFile *ChatFile) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+
+	existing, eventCount, err := readChat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		// A new chat starts from a fresh snapshot
+		return writeChatSnapshot(name, chatFile)
+	}
+	if err != nil {
+		// Never replace a chat that exists but could not be read
+		return err
+	}
+
+	events := diffChat(existing, chatFile)
+	if eventCount+len(events) > journalCompactThreshold {
+		return writeChatSnapshot(name, chatFile)
+	}
+	return appendChatEvents(name, events)
+}
+
+// updateChat applies fn to the stored state of a chat and journals the
+// result. The read-modify-write happens under the store lock, so concurrent
+// updates from background jobs cannot overwrite each other.
+func updateChat(name string, fn func(chatFile *ChatFile)) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+
+	existing, eventCount, err := readChat(name)
+	if err != nil {
+		return err
+	}
+	updated, err := cloneChatFile(existing)
+	if err != nil {
+		return err
+	}
+	fn(updated)
+	applyMessages(updated, updated.Messages)
+
+	events := diffChat(existing, updated)
+	if eventCount+len(events) > journalCompactThreshold {
+		return writeChatSnapshot(name, updated)
+	}
+	return appendChatEvents(name, events)
+}
+
+// updateChatMetadata applies fn to the metadata of a stored chat
+func updateChatMetadata(name string, fn func(meta *ChatMetadata)) error {
+	return updateChat(name, func(chatFile *ChatFile) {
+		fn(&chatFile.Metadata)
+	})
+}
+
+// cloneChatFile returns a deep copy of a chat
+func cloneChatFile(chatFile *ChatFile) (*ChatFile, error) {
+	data, err := json.Marshal(chatFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy chat: %w", err)
+	}
+	var clone ChatFile
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("failed to copy chat: %w", err)
+	}
+	return &clone, nil
+}
+
+// compactChat folds a chat's journal into its snapshot
+func compactChat(name string) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+
+	chatFile, eventCount, err := readChat(name)
+	if err != nil {
+		return err
+	}
+	if eventCount == 0 {
+		return nil
+	}
+	return writeChatSnapshot(name, chatFile)
+}
+
+// recoverChatJournals replays and compacts any journals left behind by an
+// interrupted session
+func recoverChatJournals() error {
+	for _, dir := range chatDirs() {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to read chat directory: %w", err)
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".journal.jsonl") {
+				continue
+			}
+			name := strings.TrimSuffix(f.Name(), ".journal.jsonl")
+			if err := compactChat(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTempDirs points the app directories at a fresh tree for one test
+func useTempDirs(t *testing.T) {
+	t.Helper()
+	old := appDirs{Config: configPath, Data: dataPath, Cache: cachePath, Project: projectPath}
+	root := t.TempDir()
+	setAppDirs(appDirs{
+		Config: filepath.Join(root, "config"),
+		Data:   filepath.Join(root, "data"),
+		Cache:  filepath.Join(root, "cache"),
+	})
+	for _, dir := range []string{configPath, chatsPath, cachePath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { setAppDirs(old) })
+}
+
+// journalLine encodes an event as one journal line
+func journalLine(t *testing.T, event ChatEvent) string {
+	t.Helper()
+	line, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(line)
+}
+
+func TestReadChatJournal(t *testing.T) {
+	first := ChatEvent{Type: eventMessageAdded, Time: time.Unix(1, 0).UTC(), Message: &Message{Role: "user", Content: "hi"}}
+	second := ChatEvent{Type: eventMessageAdded, Time: time.Unix(2, 0).UTC(), Message: &Message{Role: "assistant", Content: "hello"}}
+
+	tests := []struct {
+		name    string
+		journal func(t *testing.T) string
+		want    []string // Contents of the replayed messages
+	}{
+		{
+			name:    "complete",
+			journal: func(t *testing.T) string { return journalLine(t, first) + "\n" + journalLine(t, second) + "\n" },
+			want:    []string{"hi", "hello"},
+		},
+		{
+			name: "torn last line",
+			journal: func(t *testing.T) string {
+				return journalLine(t, first) + "\n" + journalLine(t, second)[:20]
+			},
+			want: []string{"hi"},
+		},
+		{
+			name: "unreadable line in the middle",
+			journal: func(t *testing.T) string {
+				return journalLine(t, first) + "\n{\"type\":\"mess\n" + journalLine(t, second) + "\n"
+			},
+			want: []string{"hi", "hello"},
+		},
+		{
+			name:    "blank lines",
+			journal: func(t *testing.T) string { return "\n" + journalLine(t, first) + "\n\n" },
+			want:    []string{"hi"},
+		},
+		{
+			name:    "empty",
+			journal: func(t *testing.T) string { return "" },
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempDirs(t)
+			if err := os.WriteFile(chatJournalPath("chat"), []byte(tt.journal(t)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			events, err := readChatJournal("chat")
+			if err != nil {
+				t.Fatalf("readChatJournal: %v", err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.Message.Content)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("replayed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadChatJournalMissing(t *testing.T) {
+	useTempDirs(t)
+	events, err := readChatJournal("chat")
+	if err != nil || events != nil {
+		t.Errorf("readChatJournal = %v, %v; want no events and no error", events, err)
+	}
+}
+
+func TestSaveChatAfterTornAppend(t *testing.T) {
+	useTempDirs(t)
+	messages := []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}
+	if err := saveChat("chat", messages[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveChat("chat", messages); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash mid-append leaves a line without its newline
+	f, err := os.OpenFile(chatJournalPath("chat"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"type":"message_ad`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	messages = append(messages, Message{Role: "user", Content: "again"})
+	if err := saveChat("chat", messages); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadChat("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, messages) {
+		t.Errorf("loaded %v, want %v", got, messages)
+	}
+}
+
+func TestSaveChatKeepsJournalOnlyMetadata(t *testing.T) {
+	useTempDirs(t)
+	messages := []Message{{Role: "user", Content: "hi"}}
+	if err := saveChat("chat", messages); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateChatMetadata("chat", func(meta *ChatMetadata) { meta.Title = "Kept" }); err != nil {
+		t.Fatal(err)
+	}
+	// Leave the chat as a journal only, as a crash before the first
+	// snapshot would
+	chatFile, err := loadChatWithMetadata("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var journal strings.Builder
+	for _, node := range chatFile.Nodes {
+		journal.WriteString(journalLine(t, ChatEvent{Type: eventMessageAdded, Node: &node}) + "\n")
+	}
+	journal.WriteString(journalLine(t, ChatEvent{Type: eventActiveLeafChanged, ActiveLeaf: chatFile.ActiveLeaf}) + "\n")
+	journal.WriteString(journalLine(t, ChatEvent{Type: eventMetadataChanged, Metadata: &chatFile.Metadata}) + "\n")
+	if err := os.Remove(chatSnapshotPath("chat")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(chatJournalPath("chat"), []byte(journal.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saveChat("chat", append(messages, Message{Role: "assistant", Content: "hello"})); err != nil {
+		t.Fatal(err)
+	}
+	chatFile, err = loadChatWithMetadata("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatFile.Metadata.Title != "Kept" {
+		t.Errorf("title = %q, want %q", chatFile.Metadata.Title, "Kept")
+	}
+	if len(chatFile.Messages) != 2 {
+		t.Errorf("loaded %d messages, want 2", len(chatFile.Messages))
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Logging constants
+const (
+	logFileName      = "aichat.log"
+	debugFlag        = "--debug"
+	maxLoggedBody    = 64 << 10 // Bytes of a request or response body kept in the log
+	logViewerRecords = 1000     // Most recent records shown by the log viewer
+)
+
+// Log levels accepted in settings.json
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+var (
+	// logger records to the rotating log file; it discards until setupLogging runs
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	// logLevel is the minimum level written, adjustable while running
+	logLevel = new(slog.LevelVar)
+	// debugMode records sanitized request and response bodies (--debug)
+	debugMode bool
+	// tuiActive is set while the full-screen interface owns the terminal
+	tuiActive atomic.Bool
+	// logOutput is the open log file, closed when logging is set up again
+	logOutput *rotatingWriter
+)
+
+// LogSettings configures the log file
+type LogSettings struct {
+	Level     string `json:"level"`       // debug, info, warn or error
+	Format    string `json:"format"`      // text or json
+	MaxSizeMB int    `json:"max_size_mb"` // Size at which the log is rotated
+	MaxFiles  int    `json:"max_files"`   // Rotated logs kept besides the current one
+}
+
+// defaultLogSettings returns the log settings used when nothing is configured
+func defaultLogSettings() LogSettings {
+	return LogSettings{Level: "info", Format: "text", MaxSizeMB: 5, MaxFiles: 3}
+}
+
+// logPath returns the path of the current log file
+func logPath() string {
+	return filepath.Join(cachePath, logFileName)
+}
+
+// rotatingWriter appends to a file and renames it to .1, .2, ... once it
+// grows past maxSize, keeping at most backups old files
+type rotatingWriter struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+// newRotatingWriter opens path for appending
+func newRotatingWriter(path string, maxSize int64, backups int) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxSize: maxSize, backups: backups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first when it would not fit
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the old logs up by one and starts an empty file
+func (w *rotatingWriter) rotate() error {
+	w.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.backups))
+	for i := w.backups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	if w.backups > 0 {
+		os.Rename(w.path, w.path+".1")
+	} else {
+		os.Remove(w.path)
+	}
+	return w.open()
+}
+
+// Close closes the log file
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// setupLogging opens the log file in the cache directory using the log
+// settings. It is called again when the directories change.
+func setupLogging(debug bool) {
+	debugMode = debug
+	settings := currentSettings().Log
+	applyLogLevel(settings.Level)
+
+	if logOutput != nil {
+		logOutput.Close()
+		logOutput = nil
+	}
+	w, err := newRotatingWriter(logPath(), int64(settings.MaxSizeMB)<<20, settings.MaxFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Logging disabled: %v\n", err)
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		return
+	}
+	logOutput = w
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if settings.Format == "json" {
+		logger = slog.New(slog.NewJSONHandler(w, opts))
+	} else {
+		logger = slog.New(slog.NewTextHandler(w, opts))
+	}
+}
+
+// applyLogLevel sets the minimum level; --debug always logs everything
+func applyLogLevel(level string) {
+	if debugMode {
+		logLevel.Set(slog.LevelDebug)
+		return
+	}
+	if l, ok := logLevels[level]; ok {
+		logLevel.Set(l)
+	}
+}
+
+// handleError logs err and, unless the full-screen interface is showing,
+// reports it on standard error
+func handleError(err error, context string) {
+	if err == nil {
+		return
+	}
+	logger.Error(context, "err", err)
+	if tuiActive.Load() {
+		return
+	}
+	switch e := err.(type) {
+	case *AppError:
+		fmt.Fprintf(os.Stderr, "\033[31mError: %s\033[0m\n", e.Error())
+	case *ModelError:
+		fmt.Fprintf(os.Stderr, "\033[31mModel error: %s\033[0m\n", e.Error())
+	case *PromptError:
+		fmt.Fprintf(os.Stderr, "\033[31mPrompt error: %s\033[0m\n", e.Error())
+	default:
+		fmt.Fprintf(os.Stderr, "\033[31mError during %s: %v\033[0m\n", context, err)
+	}
+}
+
+// newRequestID returns a short random ID that ties together the log records
+// of one API request
+func newRequestID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// secretPattern matches API keys as providers format them: OpenAI-style
+// sk-/pk-/rk- keys (also OpenRouter, Anthropic and DeepSeek), Groq gsk_,
+// Fireworks fw_, xAI xai- and Google AIza keys, and bearer tokens
+var secretPattern = regexp.MustCompile(`\b(?:(?:sk|pk|rk|xai)-[A-Za-z0-9_\-]{8,}|(?:gsk|fw)_[A-Za-z0-9]{8,}|AIza[A-Za-z0-9_\-]{20,})|(?i:bearer)\s+[A-Za-z0-9._~+/=\-]{8,}`)
+
+// debugBody returns a request or response body for the debug log. While a
+// vault is set up the chats it protects stay out of the log, so only the
+// size and SHA-256 of the whole body are recorded.
+func debugBody(data []byte, size int, sum []byte) string {
+	if vaultEnabled() {
+		return fmt.Sprintf("(%d bytes, sha256 %x; withheld while the vault is set up)", size, sum)
+	}
+	return sanitizeForLog(string(data))
+}
+
+// sanitizeForLog removes API keys from s and shortens it to maxLoggedBody
+func sanitizeForLog(s string) string {
+	s = secretPattern.ReplaceAllString(s, "[REDACTED]")
+	if len(s) > maxLoggedBody {
+		s = s[:maxLoggedBody] + fmt.Sprintf("... (%d bytes truncated)", len(s)-maxLoggedBody)
+	}
+	return s
+}
+
+// apiClient sends all requests to the chat API through loggingTransport
+var apiClient = &http.Client{Transport: &loggingTransport{base: http.DefaultTransport}}
+
+// loggingTransport records each API request and its outcome under a request
+// ID. In debug mode the sanitized bodies are recorded too.
+type loggingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := newRequestID()
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Request-ID", id)
+	log := logger.With("request_id", id)
+	attrs := []any{"method", req.Method, "url", req.URL.String()}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			var meta struct {
+				Model    string            `json:"model"`
+				Messages []json.RawMessage `json:"messages"`
+			}
+			if json.Unmarshal(data, &meta) == nil {
+				attrs = append(attrs, "model", meta.Model, "messages", len(meta.Messages))
+			}
+			if debugMode {
+				sum := sha256.Sum256(data)
+				attrs = append(attrs, "body", debugBody(data, len(data), sum[:]))
+			}
+		}
+	}
+	log.Info("api request", attrs...)
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		log.Error("api request failed", "err", err, "duration_ms", time.Since(start).Milliseconds())
+		return nil, err
+	}
+	level := slog.LevelInfo
+	if resp.StatusCode != http.StatusOK {
+		level = slog.LevelWarn
+	}
+	log.Log(context.Background(), level, "api response", "status", resp.StatusCode, "duration_ms", time.Since(start).Milliseconds())
+	if debugMode || resp.StatusCode != http.StatusOK {
+		resp.Body = &loggedBody{ReadCloser: resp.Body, log: log, start: start, always: debugMode, hash: sha256.New()}
+	}
+	return resp, nil
+}
+
+// loggedBody keeps the start of a response body and records it once the
+// caller closes it
+type loggedBody struct {
+	io.ReadCloser
+	log    *slog.Logger
+	start  time.Time
+	always bool // Record the body even when the request succeeded
+	buf    bytes.Buffer
+	size   int
+	hash   hash.Hash // SHA-256 of the whole body
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += n
+	b.hash.Write(p[:n])
+	if room := maxLoggedBody + 1 - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	level, body := slog.LevelDebug, ""
+	if b.always {
+		body = debugBody(b.buf.Bytes(), b.size, b.hash.Sum(nil))
+	} else {
+		// Error responses describe the failure rather than echo the chat
+		level, body = slog.LevelWarn, sanitizeForLog(b.buf.String())
+	}
+	b.log.Log(context.Background(), level, "api response body", "body", body, "duration_ms", time.Since(b.start).Milliseconds())
+	return b.ReadCloser.Close()
+}
+
+// logRecord is one entry of the log file as shown by the viewer
+type logRecord struct {
+	Level slog.Level
+	Line  string
+}
+
+// readLogRecords returns up to limit of the newest records at or above
+// level, oldest first. Both the text and JSON formats are understood.
+func readLogRecords(level slog.Level, limit int) ([]logRecord, error) {
+	f, err := os.Open(logPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []logRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 4*maxLoggedBody)
+	for scanner.Scan() {
+		record := parseLogLine(scanner.Text())
+		if record.Level < level {
+			continue
+		}
+		records = append(records, record)
+		if len(records) > limit {
+			records = records[1:]
+		}
+	}
+	return records, scanner.Err()
+}
+
+// parseLogLine turns a text or JSON log line into a record with a readable line
+func parseLogLine(line string) logRecord {
+	record := logRecord{Level: slog.LevelInfo, Line: line}
+	if strings.HasPrefix(line, "{") {
+		var fields map[string]any
+		if json.Unmarshal([]byte(line), &fields) == nil {
+			var level slog.Level
+			if s, ok := fields["level"].(string); ok && level.UnmarshalText([]byte(s)) == nil {
+				record.Level = level
+			}
+			parts := []string{fmt.Sprint(fields["time"]), fmt.Sprint(fields["level"]), fmt.Sprint(fields["msg"])}
+			var keys []string
+			for key := range fields {
+				if key != "time" && key != "level" && key != "msg" {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				parts = append(parts, fmt.Sprintf("%s=%v", key, fields[key]))
+			}
+			record.Line = strings.Join(parts, " ")
+		}
+		return record
+	}
+	if i := strings.Index(line, "level="); i >= 0 {
+		name, _, _ := strings.Cut(line[i+len("level="):], " ")
+		var level slog.Level
+		if level.UnmarshalText([]byte(name)) == nil {
+			record.Level = level
+		}
+	}
+	return record
+}
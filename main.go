@@ -4,11 +4,67 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"time"
 )
 
 func main() {
-	// Initialize error logging
-	errorLog = NewErrorLog()
+	// Work out where settings, chats and logs live
+	opts, args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		printUsage()
+		return
+	}
+	apiKeyFile = opts.APIKeyFile
+	if apiKeyFile == "-" {
+		if err := readStdinKey(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	dirs, err := resolveAppDirs(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	setAppDirs(dirs)
+
+	// Log to the cache directory
+	setupLogging(opts.Debug)
+	logger.Info("starting", "args", args, "debug", opts.Debug)
+
+	reader := bufio.NewReader(os.Stdin)
+	subcommand := ""
+	if len(args) > 0 {
+		subcommand = args[0]
+	}
+
+	// Older versions kept everything in ./.util; offer to move it once
+	if pendingLegacyMigration(dirs) {
+		if subcommand == "" {
+			if err := offerLegacyMigration(reader, dirs); err != nil {
+				handleError(err, "data directory migration")
+			}
+		} else {
+			// Keep subcommands working on the old data until it is migrated
+			fmt.Fprintf(os.Stderr, "Using data from an older version in %s; run aichat without arguments to migrate it.\n", legacyUtilPath())
+			dirs = legacyAppDirs(dirs)
+			setAppDirs(dirs)
+			setupLogging(opts.Debug)
+		}
+	}
+
+	// Sealed files can only be read once the vault is unlocked
+	vaultCommand := subcommand == "vault"
+	if !vaultCommand {
+		if err := unlockVaultInteractive(); err != nil {
+			handleError(err, "vault unlock")
+			return
+		}
+	}
 
 	// Ensure environment is set up
 	if err := ensureEnvironment(); err != nil {
@@ -16,10 +72,44 @@ func main() {
 		return
 	}
 
-	reader := bufio.NewReader(os.Stdin)
+	// The vault command manages encryption itself
+	if vaultCommand {
+		os.Exit(runVaultCommand(args[1:]))
+	}
 
-	// Check API key on startup
-	if _, err := readAPIKey(); err != nil {
+	// Upgrade chats written by older versions, keeping backups of the originals
+	if err := upgradeChatFiles(); err != nil {
+		handleError(err, "chat schema migration")
+	}
+
+	// Replay journals left behind by a crashed session
+	if err := recoverChatJournals(); err != nil {
+		handleError(err, "chat journal recovery")
+	}
+
+	// Move chats still stored under their title to ID-based file names
+	if err := migrateChatIDs(); err != nil {
+		handleError(err, "chat ID migration")
+	}
+
+	// Subcommands run without the interactive interface
+	switch subcommand {
+	case "export":
+		os.Exit(runExportCommand(args[1:]))
+	case "import":
+		os.Exit(runImportCommand(args[1:]))
+	}
+
+	// Clean up chats according to the retention policy
+	if report, err := runRetention(); err != nil {
+		handleError(err, "chat retention")
+	} else if report != "" {
+		fmt.Println(report)
+	}
+
+	// Offer to store a key when none is available from any source; the key
+	// itself is only looked up once a request needs it
+	if !apiKeyConfigured() {
 		fmt.Println("No API key found.")
 		if err := promptAndSaveAPIKey(reader); err != nil {
 			handleError(err, "initial API key setup")
@@ -31,4 +121,35 @@ func main() {
 	if err := RunGUIMainMenu(); err != nil {
 		fmt.Printf("GUI error: %v\n", err)
 	}
+
+	// Let background title and summary jobs persist their results
+	if jobRunner.Pending() > 0 {
+		fmt.Println("Finishing background jobs...")
+		if !jobRunner.Wait(30 * time.Second) {
+			fmt.Println("Some background jobs did not finish in time.")
+		}
+	}
+}
+
+// printUsage describes the subcommands and global flags
+func printUsage() {
+	fmt.Printf(`Usage: aichat [global flags] [command]
+
+Without a command the interactive menu is started.
+
+Commands:
+  export    Export chats to Markdown, HTML or JSONL
+  import    Import conversations from ChatGPT or Claude data exports
+  vault     Manage encryption of API keys and chats
+  help      Show this help
+
+Global flags:
+  %[1]s DIR        Keep all files in DIR (also %[2]s)
+  %[3]s       Ignore the .aichat project overlay
+  %[6]s            Log sanitized API request and response bodies
+  %[4]s FILE   Read the API key from FILE, or from standard input with -
+
+The API key is taken from the first of: %[4]s, %[5]s,
+OPENROUTER_API_KEY, the api_key_command setting, and the stored active key.
+`, dataDirFlag, homeEnv, noProjectFlag, apiKeyFileFlag, apiKeyEnv, debugFlag)
 }
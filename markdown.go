@@ -0,0 +1,91 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+)
+
+// defaultMarkdownStyle is the glamour style used for assistant messages
+const defaultMarkdownStyle = "dark"
+
+// markdownStyles lists the styles ui.markdown_style accepts
+func markdownStyles() []string {
+	var names []string
+	for name := range styles.DefaultStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isMarkdownStyle reports whether name is a known style
+func isMarkdownStyle(name string) bool {
+	_, ok := styles.DefaultStyles[name]
+	return ok
+}
+
+// markdownKey identifies one rendering of a message
+type markdownKey struct {
+	hash  uint64
+	width int
+}
+
+// MarkdownRenderer renders messages as terminal markdown with highlighted
+// code blocks and caches the output, so redrawing the chat stays fast
+type MarkdownRenderer struct {
+	mu       sync.Mutex
+	style    string
+	width    int
+	renderer *glamour.TermRenderer
+	cache    map[markdownKey]string
+}
+
+// NewMarkdownRenderer creates an empty renderer
+func NewMarkdownRenderer() *MarkdownRenderer {
+	return &MarkdownRenderer{cache: make(map[markdownKey]string)}
+}
+
+// Render returns content rendered to fit width columns. If rendering
+// fails the content is returned unchanged.
+func (r *MarkdownRenderer) Render(content string, width int) string {
+	style := currentSettings().UI.MarkdownStyle
+	width = max(20, width)
+	h := fnv.New64a()
+	h.Write([]byte(content))
+	key := markdownKey{hash: h.Sum64(), width: width}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if style != r.style {
+		// A new style changes every rendering
+		r.style, r.renderer = style, nil
+		r.cache = make(map[markdownKey]string)
+	}
+	if out, ok := r.cache[key]; ok {
+		return out
+	}
+	if r.renderer == nil || r.width != width {
+		renderer, err := glamour.NewTermRenderer(
+			glamour.WithStandardStyle(style),
+			glamour.WithWordWrap(width),
+		)
+		if err != nil {
+			logger.Warn("failed to create markdown renderer", "style", style, "err", err)
+			return content
+		}
+		r.renderer, r.width = renderer, width
+	}
+	out, err := r.renderer.Render(content)
+	if err != nil {
+		logger.Warn("failed to render markdown", "err", err)
+		return content
+	}
+	out = strings.Trim(out, "\n")
+	r.cache[key] = out
+	return out
+}
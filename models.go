@@ -13,18 +13,36 @@ import (
 	"strings"
 )
 
-var (
-	apiURL = "https://openrouter.ai/api/v1/chat/completions"
-	apiKey string
-)
+var apiURL = "https://openrouter.ai/api/v1/chat/completions"
 
 // StreamRequestBody represents the request body for chat completions
 type StreamRequestBody struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Stream      bool      `json:"stream"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Model       string        `json:"model"`
+	Messages    []Message     `json:"messages"`
+	Stream      bool          `json:"stream"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	TopP        *float64      `json:"top_p,omitempty"`
+	Usage       *UsageRequest `json:"usage,omitempty"`
+}
+
+// UsageRequest asks for the token counts and cost in the last chunk
+type UsageRequest struct {
+	Include bool `json:"include"`
+}
+
+// newStreamRequestBody builds a streaming request, filling in the default
+// parameters that params leaves unset
+func newStreamRequestBody(messages []Message, model string, params GenerationParams) StreamRequestBody {
+	params = params.withDefaults()
+	return StreamRequestBody{
+		Model:       model,
+		Messages:    messages,
+		Stream:      true,
+		MaxTokens:   params.MaxTokens,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+	}
 }
 
 // ErrorResponse represents an error response from the API
@@ -46,31 +64,36 @@ type StreamResponse struct {
 		} `json:"delta"`
 		Error *ErrorResponse `json:"error,omitempty"`
 	} `json:"choices"`
-	Model string `json:"model"`
+	Model string      `json:"model"`
+	Usage *TokenUsage `json:"usage,omitempty"`
+}
+
+// TokenUsage is the token count and cost the API reports for a request
+type TokenUsage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost,omitempty"` // In US dollars
 }
 
 // Model represents a single model with its name and default status
 type Model struct {
-	Name      string `json:"name"`
-	IsDefault bool   `json:"is_default"`
+	Name          string `json:"name"`
+	IsDefault     bool   `json:"-"`                        // Mirrors default_model in the settings
+	ContextLength int    `json:"context_length,omitempty"` // Context window in tokens
+	// Prices in US dollars per million tokens, used when the API reports no cost
+	PromptPrice     float64 `json:"prompt_price,omitempty"`
+	CompletionPrice float64 `json:"completion_price,omitempty"`
 }
 
 // ModelsConfig represents the models configuration stored in JSON
 type ModelsConfig struct {
-	Models []Model `json:"models"`
-}
-
-func init() {
-	key, err := readAPIKey()
-	if err != nil {
-		fmt.Println("Error reading API key:", err)
-		os.Exit(1)
-	}
-	apiKey = key
+	SchemaVersion int     `json:"schema_version"`
+	Models        []Model `json:"models"`
 }
 
 func modelsFilePath() string {
-	return filepath.Join(utilPath, "models.json")
+	return filepath.Join(configPath, "models.json")
 }
 
 // ModelError wraps model-related errors
@@ -100,42 +123,74 @@ func initializeModelsFile() error {
 	defaultModel := DefaultModel()
 	config := ModelsConfig{
 		Models: []Model{
-			{Name: defaultModel, IsDefault: true},
-			{Name: "openai/gpt-4", IsDefault: false},
-			{Name: "meta-llama/llama-3-8b-instruct", IsDefault: false},
+			{Name: defaultModel, IsDefault: true, ContextLength: 163840},
+			{Name: "openai/gpt-4", IsDefault: false, ContextLength: 8191},
+			{Name: "meta-llama/llama-3-8b-instruct", IsDefault: false, ContextLength: 8192},
 		},
 	}
 
+	if err := saveModelsConfig(&config); err != nil {
+		return err
+	}
+
+	fmt.Println("Initialized models file with defaults.")
+	return nil
+}
+
+// loadModelsConfig reads the full models configuration
+func loadModelsConfig() (*ModelsConfig, error) {
+	data, err := readVersionedFile(modelsSchema, modelsFilePath(), 0644)
+	if err != nil {
+		return nil, &ModelError{"read models file", err}
+	}
+
+	var config ModelsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, &ModelError{"parse models file", err}
+	}
+	defaultModel := currentSettings().DefaultModel
+	for i := range config.Models {
+		config.Models[i].IsDefault = config.Models[i].Name == defaultModel
+	}
+	return &config, nil
+}
+
+// saveModelsConfig writes the full models configuration
+func saveModelsConfig(config *ModelsConfig) error {
+	for _, m := range config.Models {
+		if m.IsDefault && m.Name != currentSettings().DefaultModel {
+			name := m.Name
+			if err := updateSettings(func(s *Settings) { s.DefaultModel = name }); err != nil {
+				return &ModelError{"save default model", err}
+			}
+		}
+	}
+
+	config.SchemaVersion = modelsSchema.Version()
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
-		return &ModelError{"marshal default models", err}
+		return &ModelError{"marshal models", err}
 	}
 
 	if err := os.WriteFile(modelsFilePath(), data, 0644); err != nil {
-		return &ModelError{"write models file", err}
+		return &ModelError{"save models file", err}
 	}
-
-	fmt.Println("Initialized models file with defaults.")
 	return nil
 }
 
 // loadModelsWithMostRecent reads models from JSON and returns list plus default model
 func loadModelsWithMostRecent() ([]string, string, error) {
-	data, err := os.ReadFile(modelsFilePath())
-	if err != nil {
-		if os.IsNotExist(err) {
-			if err := initializeModelsFile(); err != nil {
-				return nil, "", &ModelError{"initialize models file", err}
-			}
-			defaultModel := DefaultModel()
-			return []string{defaultModel}, defaultModel, nil
+	if _, err := os.Stat(modelsFilePath()); os.IsNotExist(err) {
+		if err := initializeModelsFile(); err != nil {
+			return nil, "", &ModelError{"initialize models file", err}
 		}
-		return nil, "", &ModelError{"read models file", err}
+		defaultModel := DefaultModel()
+		return []string{defaultModel}, defaultModel, nil
 	}
 
-	var config ModelsConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, "", &ModelError{"parse models file", err}
+	config, err := loadModelsConfig()
+	if err != nil {
+		return nil, "", err
 	}
 
 	var models []string
@@ -157,26 +212,25 @@ func loadModelsWithMostRecent() ([]string, string, error) {
 	return models, defaultModel, nil
 }
 
-// saveModelsWithMostRecent saves models list with updated default model
+// saveModelsWithMostRecent saves models list with updated default model,
+// keeping the per-model settings already on disk
 func saveModelsWithMostRecent(defaultModel string, modelNames []string) error {
 	var config ModelsConfig
-	for _, name := range modelNames {
-		config.Models = append(config.Models, Model{
-			Name:      name,
-			IsDefault: name == defaultModel,
-		})
-	}
-
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return &ModelError{"marshal models", err}
+	existing := make(map[string]Model)
+	if old, err := loadModelsConfig(); err == nil {
+		for _, m := range old.Models {
+			existing[m.Name] = m
+		}
 	}
 
-	if err := os.WriteFile(modelsFilePath(), data, 0644); err != nil {
-		return &ModelError{"save models file", err}
+	for _, name := range modelNames {
+		model := existing[name]
+		model.Name = name
+		model.IsDefault = name == defaultModel
+		config.Models = append(config.Models, model)
 	}
 
-	return nil
+	return saveModelsConfig(&config)
 }
 
 // selectModel interactively lets user pick or add models
@@ -235,19 +289,19 @@ func promptModelAtChatStart(reader *bufio.Reader) (string, error) {
 
 // streamChatResponse handles the chat API response streaming
 func streamChatResponse(messages []Message, model string) (string, error) {
-	reqBody := StreamRequestBody{
-		Model:       model,
-		Messages:    messages,
-		Stream:      true,
-		MaxTokens:   2048,
-		Temperature: 0.7,
-	}
+	reqBody := newStreamRequestBody(messages, model, GenerationParams{})
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		handleError(err, "marshaling request body")
 		return "", err
 	}
 
+	apiKey, err := requestAPIKey("")
+	if err != nil {
+		handleError(err, "reading API key")
+		return "", err
+	}
+
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		handleError(err, "creating API request")
@@ -258,8 +312,7 @@ func streamChatResponse(messages []Message, model string) (string, error) {
 	req.Header.Set("HTTP-Referer", "https://github.com/go-ai-cli")
 	req.Header.Set("X-Title", "Go AI CLI")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		handleError(err, "making API request")
 		return "", err
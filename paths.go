@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Environment variables and flags that override where files are stored
+const (
+	homeEnv           = "AICHAT_HOME"
+	dataDirFlag       = "--data-dir"
+	noProjectFlag     = "--no-project"
+	migrationDeclined = ".migration-declined"
+)
+
+// appDirs holds the directories the application keeps its files in
+type appDirs struct {
+	Config  string // Settings and API keys
+	Data    string // Chats and backups
+	Cache   string // Logs and other disposable files
+	Project string // Project-local .aichat overlay, "" when there is none
+}
+
+// globalOptions are the flags accepted before a subcommand
+type globalOptions struct {
+	DataDir    string
+	NoProject  bool
+	APIKeyFile string
+	Debug      bool
+}
+
+// parseGlobalFlags strips the leading global flags from args
+func parseGlobalFlags(args []string) (globalOptions, []string, error) {
+	var opts globalOptions
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == noProjectFlag:
+			opts.NoProject = true
+			args = args[1:]
+		case arg == debugFlag:
+			opts.Debug = true
+			args = args[1:]
+		case arg == dataDirFlag:
+			if len(args) < 2 {
+				return opts, nil, fmt.Errorf("%s needs a directory", dataDirFlag)
+			}
+			opts.DataDir = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, dataDirFlag+"="):
+			opts.DataDir = strings.TrimPrefix(arg, dataDirFlag+"=")
+			args = args[1:]
+		case arg == apiKeyFileFlag:
+			if len(args) < 2 {
+				return opts, nil, fmt.Errorf("%s needs a file, or - for standard input", apiKeyFileFlag)
+			}
+			opts.APIKeyFile = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, apiKeyFileFlag+"="):
+			opts.APIKeyFile = strings.TrimPrefix(arg, apiKeyFileFlag+"=")
+			args = args[1:]
+		default:
+			return opts, args, nil
+		}
+	}
+	return opts, args, nil
+}
+
+// baseDir returns an XDG base directory, honouring the environment variable
+// when it is set to an absolute path
+func baseDir(env string, fallback func() (string, error)) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName), nil
+	}
+	dir, err := fallback()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// homeSubdir returns a fallback for baseDir below the home directory
+func homeSubdir(parts ...string) func() (string, error) {
+	return func() (string, error) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(append([]string{home}, parts...)...), nil
+	}
+}
+
+// resolveAppDirs works out where files live. An explicit data directory,
+// from --data-dir or AICHAT_HOME, holds everything in one place like the old
+// ./.util did; otherwise the XDG base directories are used.
+func resolveAppDirs(opts globalOptions) (appDirs, error) {
+	var dirs appDirs
+	home := opts.DataDir
+	if home == "" {
+		home = os.Getenv(homeEnv)
+	}
+	if home != "" {
+		abs, err := filepath.Abs(home)
+		if err != nil {
+			return dirs, fmt.Errorf("failed to resolve data directory: %w", err)
+		}
+		dirs = appDirs{Config: abs, Data: abs, Cache: abs}
+	} else {
+		configFallback, dataFallback := os.UserConfigDir, os.UserConfigDir
+		if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+			configFallback = homeSubdir(".config")
+			dataFallback = homeSubdir(".local", "share")
+		}
+		var err error
+		if dirs.Config, err = baseDir("XDG_CONFIG_HOME", configFallback); err != nil {
+			return dirs, fmt.Errorf("failed to find config directory: %w", err)
+		}
+		if dirs.Data, err = baseDir("XDG_DATA_HOME", dataFallback); err != nil {
+			return dirs, fmt.Errorf("failed to find data directory: %w", err)
+		}
+		if dirs.Cache, err = baseDir("XDG_CACHE_HOME", os.UserCacheDir); err != nil {
+			return dirs, fmt.Errorf("failed to find cache directory: %w", err)
+		}
+	}
+	if !opts.NoProject {
+		dirs.Project = findProjectDir()
+	}
+	return dirs, nil
+}
+
+// findProjectDir looks for a .aichat directory in the working directory and
+// its parents, stopping at the home directory
+func findProjectDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	home, _ := os.UserHomeDir()
+	for {
+		candidate := filepath.Join(dir, projectDir)
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if dir == home || parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// setAppDirs points the path variables at the resolved directories. New
+// chats are written to the project overlay when there is one.
+func setAppDirs(dirs appDirs) {
+	configPath = dirs.Config
+	dataPath = dirs.Data
+	cachePath = dirs.Cache
+	projectPath = dirs.Project
+	chatsPath = filepath.Join(dataPath, chatsDir)
+	if projectPath != "" {
+		chatsPath = filepath.Join(projectPath, chatsDir)
+	}
+	trashPath = filepath.Join(chatsPath, trashDir)
+}
+
+// chatDirs returns the directories chats are listed from: chatsPath, where
+// new chats are written, followed by the global chats when a project
+// overlay adds to them
+func chatDirs() []string {
+	dirs := []string{chatsPath}
+	if projectPath != "" {
+		dirs = append(dirs, filepath.Join(dataPath, chatsDir))
+	}
+	return dirs
+}
+
+// allChatDirs returns every directory holding chats, including the trash
+func allChatDirs() []string {
+	var dirs []string
+	for _, dir := range chatDirs() {
+		dirs = append(dirs, dir, filepath.Join(dir, trashDir))
+	}
+	return dirs
+}
+
+// chatDir returns the directory holding a chat, or whose trash holds it.
+// Chats that do not exist yet belong in chatsPath.
+func chatDir(id string) string {
+	dirs := chatDirs()
+	if len(dirs) == 1 {
+		return chatsPath
+	}
+	for _, dir := range dirs {
+		for _, name := range []string{id + ".json", id + ".journal.jsonl", filepath.Join(trashDir, id+".json")} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return dir
+			}
+		}
+	}
+	return chatsPath
+}
+
+// splitAppPath splits a path into the app directory containing it and the
+// path relative to that directory
+func splitAppPath(path string) (string, string) {
+	for _, root := range []string{projectPath, dataPath, configPath} {
+		if root == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return root, rel
+		}
+	}
+	return dataPath, filepath.Base(path)
+}
+
+// legacyUtilPath returns the working-directory .util used by older versions
+func legacyUtilPath() string {
+	return filepath.Join(".", legacyUtilDir)
+}
+
+// legacyAppDirs keeps everything in ./.util, as older versions did
+func legacyAppDirs(dirs appDirs) appDirs {
+	legacy, err := filepath.Abs(legacyUtilPath())
+	if err != nil {
+		legacy = legacyUtilPath()
+	}
+	return appDirs{Config: legacy, Data: legacy, Cache: legacy, Project: dirs.Project}
+}
+
+// pendingLegacyMigration reports whether ./.util holds files from an older
+// version that have not been migrated or declined yet
+func pendingLegacyMigration(dirs appDirs) bool {
+	legacy, err := filepath.Abs(legacyUtilPath())
+	if err != nil {
+		return false
+	}
+	if info, err := os.Stat(legacy); err != nil || !info.IsDir() {
+		return false
+	}
+	// Running with --data-dir .util keeps using it in place
+	if legacy == dirs.Config || legacy == dirs.Data {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(legacy, migrationDeclined)); err == nil {
+		return false
+	}
+	return true
+}
+
+// legacyTarget returns where an entry of the old .util directory belongs
+func legacyTarget(name string, dirs appDirs) string {
+	switch name {
+	case "api_keys.json", "models.json", "prompts.json", "retention.json", "vault.json", ".api_key":
+		return filepath.Join(dirs.Config, name)
+	case "error.log":
+		return filepath.Join(dirs.Cache, name)
+	}
+	return filepath.Join(dirs.Data, name)
+}
+
+// migrateLegacyDir moves the old ./.util into the resolved directories.
+// Entries that already exist at the destination are left in place and
+// returned so they can be reported.
+func migrateLegacyDir(dirs appDirs) ([]string, error) {
+	legacy := legacyUtilPath()
+	entries, err := os.ReadDir(legacy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", legacy, err)
+	}
+	var skipped []string
+	for _, entry := range entries {
+		src := filepath.Join(legacy, entry.Name())
+		dst := legacyTarget(entry.Name(), dirs)
+		if _, err := os.Stat(dst); err == nil {
+			skipped = append(skipped, src)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return skipped, fmt.Errorf("failed to create %s: %w", filepath.Dir(dst), err)
+		}
+		if err := moveTree(src, dst); err != nil {
+			return skipped, fmt.Errorf("failed to move %s: %w", src, err)
+		}
+	}
+	if len(skipped) == 0 {
+		if err := os.Remove(legacy); err != nil {
+			return skipped, fmt.Errorf("failed to remove %s: %w", legacy, err)
+		}
+	} else {
+		// Do not ask again for the leftovers
+		if err := os.WriteFile(filepath.Join(legacy, migrationDeclined), nil, 0644); err != nil {
+			return skipped, fmt.Errorf("failed to mark %s as migrated: %w", legacy, err)
+		}
+	}
+	return skipped, nil
+}
+
+// moveTree moves a file or directory, copying when a rename is not possible
+// because the destination is on another file system
+func moveTree(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyTree(src, dst); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyTree recursively copies a file or directory, keeping permissions
+func copyTree(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+	if err := os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := copyTree(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// offerLegacyMigration asks once whether to move ./.util into the resolved
+// directories. Declining is remembered so the question is not repeated.
+func offerLegacyMigration(reader *bufio.Reader, dirs appDirs) error {
+	fmt.Printf("Found data from an older version in %s.\n", legacyUtilPath())
+	fmt.Printf("Move it to %s (settings) and %s (chats)? [y/N]: ", dirs.Config, dirs.Data)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return nil
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		fmt.Printf("Keeping %s as it is. Use %s %s to keep working with it.\n", legacyUtilPath(), dataDirFlag, legacyUtilPath())
+		return os.WriteFile(filepath.Join(legacyUtilPath(), migrationDeclined), nil, 0644)
+	}
+	skipped, err := migrateLegacyDir(dirs)
+	if err != nil {
+		return err
+	}
+	for _, path := range skipped {
+		fmt.Printf("Not moved, already exists at the destination: %s\n", path)
+	}
+	fmt.Println("Migration complete.")
+	return nil
+}
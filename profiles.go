@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Generation parameters used when neither the chat nor its profile sets them
+const (
+	defaultTemperature = 0.7
+	defaultMaxTokens   = 2048
+)
+
+// GenerationParams tune the model's replies. Unset fields use the defaults.
+type GenerationParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+// Profile bundles the choices made when starting a chat
+type Profile struct {
+	Name   string           `json:"name"`
+	APIKey string           `json:"api_key,omitempty"` // Title of a stored key; empty uses the active key
+	Model  string           `json:"model,omitempty"`   // Empty uses the default model
+	Prompt string           `json:"prompt,omitempty"`  // Prompt name; empty uses the default prompt
+	Params GenerationParams `json:"params"`
+	Tags   []string         `json:"tags,omitempty"` // Added to every chat started with the profile
+}
+
+// ProfilesConfig is the layout of profiles.json
+type ProfilesConfig struct {
+	SchemaVersion int       `json:"schema_version"`
+	Profiles      []Profile `json:"profiles"`
+}
+
+// requestOptions carry the per-chat choices a request is sent with
+type requestOptions struct {
+	APIKey string // Title of a stored key; empty uses the configured sources
+	Params GenerationParams
+}
+
+// profilesPath returns the path of the profiles file
+func profilesPath() string {
+	return filepath.Join(configPath, "profiles.json")
+}
+
+// loadProfiles reads the profiles; a missing file means there are none
+func loadProfiles() ([]Profile, error) {
+	data, err := readVersionedFile(profilesSchema, profilesPath(), 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	var config ProfilesConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %w", err)
+	}
+	return config.Profiles, nil
+}
+
+// saveProfiles writes the profiles
+func saveProfiles(profiles []Profile) error {
+	config := ProfilesConfig{SchemaVersion: profilesSchema.Version(), Profiles: profiles}
+	if config.Profiles == nil {
+		config.Profiles = []Profile{}
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profiles: %w", err)
+	}
+	if err := writeFileAtomic(profilesPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write profiles: %w", err)
+	}
+	return nil
+}
+
+// findProfile returns the profile with the given name
+func findProfile(name string) (Profile, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return Profile{}, err
+	}
+	for _, p := range profiles {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("no profile named '%s'", name)
+}
+
+// validateProfile checks a profile before it is saved
+func validateProfile(p Profile) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("profile name must not be empty")
+	}
+	if t := p.Params.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", *t)
+	}
+	if t := p.Params.TopP; t != nil && (*t <= 0 || *t > 1) {
+		return fmt.Errorf("top_p must be above 0 and at most 1, got %g", *t)
+	}
+	if p.Params.MaxTokens < 0 || p.Params.MaxTokens > 1000000 {
+		return fmt.Errorf("max_tokens must be at most 1000000 (0 uses the default), got %d", p.Params.MaxTokens)
+	}
+	if p.APIKey != "" {
+		if _, err := storedAPIKey(p.APIKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveProfile adds a profile, or replaces the one named previous when a
+// profile is edited. Names must be unique, ignoring case.
+func saveProfile(p Profile, previous string) error {
+	p.Tags = normalizeTags(p.Tags)
+	if err := validateProfile(p); err != nil {
+		return err
+	}
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	var kept []Profile
+	for _, existing := range profiles {
+		if previous != "" && existing.Name == previous {
+			continue
+		}
+		if strings.EqualFold(existing.Name, p.Name) {
+			return fmt.Errorf("a profile named '%s' already exists", existing.Name)
+		}
+		kept = append(kept, existing)
+	}
+	return saveProfiles(append(kept, p))
+}
+
+// removeProfile deletes a profile. Chats started with it keep their choices.
+func removeProfile(name string) error {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	var kept []Profile
+	for _, p := range profiles {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == len(profiles) {
+		return fmt.Errorf("no profile named '%s'", name)
+	}
+	return saveProfiles(kept)
+}
+
+// withDefaults fills in the parameters that are not set
+func (g GenerationParams) withDefaults() GenerationParams {
+	if g.Temperature == nil {
+		t := defaultTemperature
+		g.Temperature = &t
+	}
+	if g.MaxTokens == 0 {
+		g.MaxTokens = defaultMaxTokens
+	}
+	return g
+}
+
+// String describes the parameters, e.g. "temperature 0.2, max_tokens 4096"
+func (g GenerationParams) String() string {
+	var parts []string
+	if g.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("temperature %g", *g.Temperature))
+	}
+	if g.TopP != nil {
+		parts = append(parts, fmt.Sprintf("top_p %g", *g.TopP))
+	}
+	if g.MaxTokens != 0 {
+		parts = append(parts, fmt.Sprintf("max_tokens %d", g.MaxTokens))
+	}
+	if len(parts) == 0 {
+		return "defaults"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// profilePromptContent returns the system prompt a profile starts chats with
+func profilePromptContent(p Profile) (string, error) {
+	if p.Prompt == "" {
+		prompt, err := getDefaultPrompt()
+		if err != nil {
+			return "", err
+		}
+		return prompt.Content, nil
+	}
+	prompts, err := loadPrompts()
+	if err != nil {
+		return "", err
+	}
+	for _, prompt := range prompts {
+		if prompt.Name == p.Prompt {
+			return prompt.Content, nil
+		}
+	}
+	return "", fmt.Errorf("prompt '%s' of profile '%s' no longer exists", p.Prompt, p.Name)
+}
+
+// applyProfile records a profile's key, model, parameters and tags in a
+// chat's metadata, leaving the global settings untouched
+func applyProfile(meta *ChatMetadata, p Profile) {
+	meta.Profile = p.Name
+	meta.APIKey = p.APIKey
+	meta.Model = p.Model
+	if meta.Model == "" {
+		meta.Model = DefaultModel()
+	}
+	meta.Params = nil
+	if p.Params != (GenerationParams{}) {
+		params := p.Params
+		meta.Params = &params
+	}
+	meta.Tags = normalizeTags(append(meta.Tags, p.Tags...))
+}
+
+// clearProfile makes a chat use the global key and default parameters again
+func clearProfile(meta *ChatMetadata) {
+	meta.Profile = ""
+	meta.APIKey = ""
+	meta.Params = nil
+}
+
+// newChatFromProfile creates and saves a chat set up by a profile
+func newChatFromProfile(p Profile) (string, []Message, string, error) {
+	content, err := profilePromptContent(p)
+	if err != nil {
+		return "", nil, "", err
+	}
+	chatName := newChatID()
+	messages := []Message{{Role: "system", Content: content}}
+	var chatFile ChatFile
+	chatFile.Messages = messages
+	chatFile.Metadata.Title = defaultChatTitle()
+	chatFile.Metadata.PlaceholderTitle = true
+	chatFile.Metadata.CreatedAt = time.Now()
+	applyProfile(&chatFile.Metadata, p)
+	if err := saveChatFile(chatName, &chatFile); err != nil {
+		return "", nil, "", err
+	}
+	return chatName, messages, chatFile.Metadata.Model, nil
+}
+
+// chatRequestOptions returns the key and parameters a chat's requests use
+func chatRequestOptions(chatID string) requestOptions {
+	chatFile, err := loadChatWithMetadata(chatID)
+	if err != nil {
+		return requestOptions{}
+	}
+	opts := requestOptions{APIKey: chatFile.Metadata.APIKey}
+	if chatFile.Metadata.Params != nil {
+		opts.Params = *chatFile.Metadata.Params
+	}
+	return opts
+}
@@ -14,17 +14,27 @@ import (
 type Prompt struct {
 	Name    string `json:"name"`
 	Content string `json:"content"`
-	Default bool   `json:"default"`
+	Default bool   `json:"-"` // Mirrors default_prompt in the settings
+	Project bool   `json:"-"` // Read from the project overlay; never saved globally
 }
 
 // PromptsConfig represents the prompts configuration stored in JSON
 type PromptsConfig struct {
-	Prompts []Prompt `json:"prompts"`
+	SchemaVersion int      `json:"schema_version"`
+	Prompts       []Prompt `json:"prompts"`
 }
 
 // Path helpers
 func promptsConfigPath() string {
-	return filepath.Join(utilPath, "prompts.json")
+	return filepath.Join(configPath, "prompts.json")
+}
+
+// projectPromptsPath returns the prompts file of the project overlay, or ""
+func projectPromptsPath() string {
+	if projectPath == "" {
+		return ""
+	}
+	return filepath.Join(projectPath, "prompts.json")
 }
 
 // PromptError wraps prompt-related errors
@@ -68,7 +78,7 @@ func ensurePromptsConfig() error {
 
 // Load prompts from JSON
 func loadPrompts() ([]Prompt, error) {
-	data, err := os.ReadFile(promptsConfigPath())
+	data, err := readVersionedFile(promptsSchema, promptsConfigPath(), 0644)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return initializeDefaultPrompts()
@@ -76,12 +86,60 @@ func loadPrompts() ([]Prompt, error) {
 		return nil, &PromptError{"read prompts file", err}
 	}
 
-	var prompts []Prompt
-	if err := json.Unmarshal(data, &prompts); err != nil {
+	var config PromptsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, &PromptError{"parse prompts file", err}
 	}
 
-	return prompts, nil
+	defaultPrompt := currentSettings().DefaultPrompt
+	for i := range config.Prompts {
+		config.Prompts[i].Default = config.Prompts[i].Name == defaultPrompt
+	}
+
+	project, err := loadProjectPrompts()
+	if err != nil {
+		return nil, err
+	}
+	return mergeProjectPrompts(config.Prompts, project), nil
+}
+
+// loadProjectPrompts reads the prompts added by the project overlay
+func loadProjectPrompts() ([]Prompt, error) {
+	path := projectPromptsPath()
+	if path == "" {
+		return nil, nil
+	}
+	data, err := readVersionedFile(promptsSchema, path, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, &PromptError{"read project prompts file", err}
+	}
+	var config PromptsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, &PromptError{"parse project prompts file", err}
+	}
+	return config.Prompts, nil
+}
+
+// mergeProjectPrompts appends project prompts to the global ones. Project
+// prompts never become the default, and are renamed when they clash with a
+// global prompt.
+func mergeProjectPrompts(prompts, project []Prompt) []Prompt {
+	names := make(map[string]bool)
+	for _, p := range prompts {
+		names[p.Name] = true
+	}
+	for _, p := range project {
+		if names[p.Name] {
+			p.Name += " (project)"
+		}
+		p.Default = false
+		p.Project = true
+		prompts = append(prompts, p)
+	}
+	return prompts
 }
 
 // initializeDefaultPrompts creates default prompts if none exist
@@ -109,7 +167,20 @@ func initializeDefaultPrompts() ([]Prompt, error) {
 
 // Save prompts to JSON
 func savePrompts(prompts []Prompt) error {
-	data, err := json.MarshalIndent(prompts, "", "  ")
+	config := PromptsConfig{SchemaVersion: promptsSchema.Version(), Prompts: []Prompt{}}
+	for _, p := range prompts {
+		if p.Project {
+			continue
+		}
+		config.Prompts = append(config.Prompts, p)
+		if p.Default && p.Name != currentSettings().DefaultPrompt {
+			name := p.Name
+			if err := updateSettings(func(s *Settings) { s.DefaultPrompt = name }); err != nil {
+				return &PromptError{"save default prompt", err}
+			}
+		}
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return &PromptError{"marshal prompts", err}
 	}
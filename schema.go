@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// backupsDir holds the originals of files rewritten by schema migrations
+const backupsDir = "backups"
+
+// migrationFunc upgrades a decoded document by one schema version. The
+// document is either a map[string]any or, for legacy files, a []any.
+type migrationFunc func(doc any) (any, error)
+
+// fileSchema describes the versions of one kind of persisted file.
+// Migrations[i] upgrades version i to version i+1, so the current version is
+// the number of registered migrations. Files without a schema_version are
+// version 0.
+type fileSchema struct {
+	Kind       string
+	Migrations []migrationFunc
+}
+
+// Version returns the schema version written by this build
+func (s fileSchema) Version() int {
+	return len(s.Migrations)
+}
+
+// Schemas of the persisted files. Add a migration to the end of the list
+// whenever a file's layout changes.
+var (
+	chatSchema = fileSchema{Kind: "chat", Migrations: []migrationFunc{
+		wrapLegacyArray("messages"),
+	}}
+	// Version 2 of models, prompts and API keys moved the defaults and the
+	// context and tagging options into settings.json
+	modelsSchema = fileSchema{Kind: "models", Migrations: []migrationFunc{
+		stampVersion,
+		chainMigrations(dropKeys("context", "auto_tag"), dropItemKeys("models", "is_default")),
+	}}
+	promptsSchema = fileSchema{Kind: "prompts", Migrations: []migrationFunc{
+		wrapLegacyArray("prompts"),
+		dropItemKeys("prompts", "default"),
+	}}
+	apiKeysSchema = fileSchema{Kind: "API keys", Migrations: []migrationFunc{
+		stampVersion,
+		dropKeys("active_key"),
+	}}
+	settingsSchema = fileSchema{Kind: "settings", Migrations: []migrationFunc{
+		stampVersion,
+	}}
+	vaultSchema = fileSchema{Kind: "vault", Migrations: []migrationFunc{
+		stampVersion,
+	}}
+	profilesSchema = fileSchema{Kind: "profiles", Migrations: []migrationFunc{
+		stampVersion,
+	}}
+)
+
+// SchemaError reports a file that cannot be migrated
+type SchemaError struct {
+	Path      string
+	Kind      string
+	Version   int
+	Supported int
+	Err       error
+}
+
+func (e *SchemaError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s file %s: schema version %d: %v", e.Kind, e.Path, e.Version, e.Err)
+	}
+	return fmt.Sprintf("%s file %s has schema version %d, but this version of aichat only supports up to %d; please upgrade aichat", e.Kind, e.Path, e.Version, e.Supported)
+}
+
+// stampVersion is the migration for files whose layout did not change apart
+// from gaining a schema_version
+func stampVersion(doc any) (any, error) {
+	if _, ok := doc.(map[string]any); !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	return doc, nil
+}
+
+// wrapLegacyArray returns a migration that moves a bare JSON array into the
+// given field of an object. Objects are left unchanged.
+func wrapLegacyArray(field string) migrationFunc {
+	return func(doc any) (any, error) {
+		switch v := doc.(type) {
+		case []any:
+			return map[string]any{field: v}, nil
+		case map[string]any:
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a JSON object or array")
+	}
+}
+
+// dropKeys returns a migration that deletes top-level keys of an object
+func dropKeys(keys ...string) migrationFunc {
+	return func(doc any) (any, error) {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a JSON object")
+		}
+		for _, key := range keys {
+			delete(obj, key)
+		}
+		return obj, nil
+	}
+}
+
+// dropItemKeys returns a migration that deletes keys from every object in
+// the array stored under field
+func dropItemKeys(field string, keys ...string) migrationFunc {
+	return func(doc any) (any, error) {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a JSON object")
+		}
+		items, _ := obj[field].([]any)
+		for _, item := range items {
+			if itemObj, ok := item.(map[string]any); ok {
+				for _, key := range keys {
+					delete(itemObj, key)
+				}
+			}
+		}
+		return obj, nil
+	}
+}
+
+// chainMigrations combines several changes made in the same version step
+func chainMigrations(migrations ...migrationFunc) migrationFunc {
+	return func(doc any) (any, error) {
+		var err error
+		for _, migrate := range migrations {
+			if doc, err = migrate(doc); err != nil {
+				return nil, err
+			}
+		}
+		return doc, nil
+	}
+}
+
+// schemaVersionOf returns the schema_version recorded in raw JSON, or 0 for
+// files written before versioning
+func schemaVersionOf(data []byte) (int, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return 0, nil
+	}
+	var probe struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return 0, err
+	}
+	if probe.SchemaVersion == nil {
+		return 0, nil
+	}
+	return *probe.SchemaVersion, nil
+}
+
+// migrateData upgrades raw JSON to the schema's current version. It returns
+// the input unchanged when the file is already current, and the version the
+// file was found at.
+func migrateData(schema fileSchema, path string, data []byte) ([]byte, int, error) {
+	version, err := schemaVersionOf(data)
+	if err != nil {
+		return nil, 0, &SchemaError{Path: path, Kind: schema.Kind, Err: err}
+	}
+	if version > schema.Version() {
+		return nil, version, &SchemaError{Path: path, Kind: schema.Kind, Version: version, Supported: schema.Version()}
+	}
+	if version < 0 {
+		return nil, version, &SchemaError{Path: path, Kind: schema.Kind, Version: version, Err: fmt.Errorf("invalid version")}
+	}
+	if version == schema.Version() {
+		return data, version, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, version, &SchemaError{Path: path, Kind: schema.Kind, Version: version, Err: err}
+	}
+	for v := version; v < schema.Version(); v++ {
+		doc, err = schema.Migrations[v](doc)
+		if err != nil {
+			return nil, version, &SchemaError{Path: path, Kind: schema.Kind, Version: v, Err: fmt.Errorf("migration to version %d failed: %w", v+1, err)}
+		}
+		doc.(map[string]any)["schema_version"] = v + 1
+	}
+	upgraded, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, version, &SchemaError{Path: path, Kind: schema.Kind, Version: version, Err: err}
+	}
+	return upgraded, version, nil
+}
+
+// schemaBackupPath returns where the original of a migrated file is kept,
+// below the app directory the file lives in
+func schemaBackupPath(path string, version int) string {
+	root, rel := splitAppPath(path)
+	return filepath.Join(root, backupsDir, fmt.Sprintf("%s.v%d.bak", rel, version))
+}
+
+// upgradeFile migrates JSON read from path and, when it changed, backs up
+// the original and rewrites the file in the current version. Files sealed by
+// the vault are decrypted first and sealed again when rewritten.
+func upgradeFile(schema fileSchema, path string, raw []byte, perm os.FileMode) ([]byte, error) {
+	data, err := openData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	upgraded, version, err := migrateData(schema, path, data)
+	if err != nil {
+		return nil, err
+	}
+	if version == schema.Version() {
+		return data, nil
+	}
+
+	// vault.json is read with the vault lock held and is never sealed
+	written, err := writeBackup(schemaBackupPath(path, version), raw, perm, schema.Kind != vaultSchema.Kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if !written {
+		// Upgrade on disk once the vault is unlocked
+		return upgraded, nil
+	}
+	stored := upgraded
+	if isSealed(raw) {
+		if stored, err = sealData(upgraded, schema.Kind == chatSchema.Kind); err != nil {
+			return nil, fmt.Errorf("failed to seal %s: %w", path, err)
+		}
+	}
+	if err := writeFileAtomic(path, stored, perm); err != nil {
+		return nil, fmt.Errorf("failed to write upgraded %s: %w", path, err)
+	}
+	return upgraded, nil
+}
+
+// writeBackup keeps the original content of a file at backup, unless an
+// earlier, interrupted upgrade already did. When seal is set and a vault
+// exists the copy is sealed, so no plaintext is left behind; if the vault is
+// locked nothing is written and false is returned.
+func writeBackup(backup string, raw []byte, perm os.FileMode, seal bool) (bool, error) {
+	if _, err := os.Stat(backup); err == nil {
+		return true, nil
+	}
+	data := raw
+	if seal && !isSealed(raw) {
+		sealed, err := sealData(raw, false)
+		if errors.Is(err, errVaultLocked) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		data = sealed
+	}
+	if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		return false, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := writeFileAtomic(backup, data, perm); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readVersionedFile reads a file and upgrades it to the schema's current version
+func readVersionedFile(schema fileSchema, path string, perm os.FileMode) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return upgradeFile(schema, path, data, perm)
+}
+
+// upgradeChatFiles migrates every chat snapshot, including the trash, to the
+// current schema version. Chats are also migrated in memory whenever they are
+// parsed, so this only makes the upgrade permanent and keeps the backups.
+// Chats that fail to migrate are reported but do not stop the others.
+func upgradeChatFiles() error {
+	var errs []error
+	for _, dir := range allChatDirs() {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("failed to read chat directory: %w", err))
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			if _, err := readVersionedFile(chatSchema, filepath.Join(dir, f.Name()), chatFileMode()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateData(t *testing.T) {
+	tests := []struct {
+		name        string
+		schema      fileSchema
+		data        string
+		wantVersion int // Version the file was found at
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "v0 chat array",
+			schema:      chatSchema,
+			data:        `[{"role":"user","content":"hi"}]`,
+			wantVersion: 0,
+			want:        `{"messages":[{"content":"hi","role":"user"}],"schema_version":1}`,
+		},
+		{
+			name:        "v0 chat object",
+			schema:      chatSchema,
+			data:        `{"metadata":{"title":"t"},"messages":[]}`,
+			wantVersion: 0,
+			want:        `{"messages":[],"metadata":{"title":"t"},"schema_version":1}`,
+		},
+		{
+			name:        "current chat is unchanged",
+			schema:      chatSchema,
+			data:        `{"schema_version":1,"messages":[]}`,
+			wantVersion: 1,
+			want:        `{"schema_version":1,"messages":[]}`,
+		},
+		{
+			name:        "v0 models through two steps",
+			schema:      modelsSchema,
+			data:        `{"models":[{"name":"m","is_default":true}],"context":{},"auto_tag":true}`,
+			wantVersion: 0,
+			want:        `{"models":[{"name":"m"}],"schema_version":2}`,
+		},
+		{
+			name:        "v0 prompts array",
+			schema:      promptsSchema,
+			data:        `[{"name":"p","content":"c","default":true}]`,
+			wantVersion: 0,
+			want:        `{"prompts":[{"content":"c","name":"p"}],"schema_version":2}`,
+		},
+		{
+			name:        "large numbers survive",
+			schema:      modelsSchema,
+			data:        `{"models":[{"name":"m","context_length":9007199254740993}]}`,
+			wantVersion: 0,
+			want:        `{"models":[{"context_length":9007199254740993,"name":"m"}],"schema_version":2}`,
+		},
+		{
+			name:    "newer than supported",
+			schema:  chatSchema,
+			data:    `{"schema_version":9}`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			schema:  settingsSchema,
+			data:    `["x"]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, version, err := migrateData(tt.schema, "file.json", []byte(tt.data))
+			if tt.wantErr {
+				var schemaErr *SchemaError
+				if !errors.As(err, &schemaErr) {
+					t.Fatalf("migrateData error = %v, want a SchemaError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("migrateData: %v", err)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("found version %d, want %d", version, tt.wantVersion)
+			}
+			if compactJSON(t, got) != compactJSON(t, []byte(tt.want)) {
+				t.Errorf("migrated to %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// compactJSON re-encodes JSON with sorted keys for comparison
+func compactJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestUpgradeChatFiles(t *testing.T) {
+	useTempDirs(t)
+	legacy := []byte(`[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]`)
+	path := filepath.Join(chatsPath, "old.json")
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := upgradeChatFiles(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := schemaVersionOf(data); err != nil || version != chatSchema.Version() {
+		t.Errorf("upgraded file has version %d (%v), want %d", version, err, chatSchema.Version())
+	}
+	backup, err := os.ReadFile(schemaBackupPath(path, 0))
+	if err != nil {
+		t.Fatalf("no backup: %v", err)
+	}
+	if !bytes.Equal(backup, legacy) {
+		t.Errorf("backup %s, want the original", backup)
+	}
+	messages, err := loadChat("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[1].Content != "hello" {
+		t.Errorf("loaded %v after the upgrade", messages)
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// settingsCheckInterval is how often the settings file is checked for changes
+const settingsCheckInterval = time.Second
+
+// Settings holds every user preference. It is stored in settings.json; keys
+// missing from the file take their default value.
+type Settings struct {
+	SchemaVersion int             `json:"schema_version"`
+	DefaultModel  string          `json:"default_model"`   // Model preselected for new chats
+	DefaultPrompt string          `json:"default_prompt"`  // Name of the prompt used for new chats
+	ActiveAPIKey  string          `json:"active_api_key"`  // Title of the API key in use
+	APIKeyCommand string          `json:"api_key_command"` // Command printing the API key, e.g. "pass show openrouter"
+	SystemPrompt  string          `json:"system_prompt"`   // System prompt of command-line chats
+	AutoTag       bool            `json:"auto_tag"`        // Tag chats after the first exchange
+	Context       ContextSettings `json:"context"`
+	Retention     RetentionPolicy `json:"retention"`
+	UI            UISettings      `json:"ui"`
+	Log           LogSettings     `json:"log"`
+}
+
+// UISettings configures the look of the terminal interface
+type UISettings struct {
+	SpinnerMS     int         `json:"spinner_ms"`     // Spinner frame interval in milliseconds
+	MarkdownStyle string      `json:"markdown_style"` // Style of rendered assistant messages
+	Colors        ThemeColors `json:"colors"`
+}
+
+// ThemeColors are ANSI 256 color numbers or #rrggbb values
+type ThemeColors struct {
+	Title     string `json:"title"`
+	Border    string `json:"border"`
+	Text      string `json:"text"`
+	Muted     string `json:"muted"`
+	Accent    string `json:"accent"` // Selection, input and user messages
+	Assistant string `json:"assistant"`
+	Loading   string `json:"loading"`
+	Error     string `json:"error"`
+}
+
+// colorPattern matches the color values lipgloss understands
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{6}|[0-9]{1,3})$`)
+
+// settingsState caches the settings and notices when the file changes
+var settingsState struct {
+	mu       sync.Mutex
+	settings Settings
+	loaded   bool
+	modTime  time.Time
+	checked  time.Time
+	err      error
+}
+
+// settingsPath returns the path of the settings file
+func settingsPath() string {
+	return filepath.Join(configPath, "settings.json")
+}
+
+// defaultSettings returns the settings used when nothing is configured
+func defaultSettings() Settings {
+	return Settings{
+		SchemaVersion: settingsSchema.Version(),
+		DefaultModel:  DefaultModel(),
+		SystemPrompt:  "You are a helpful AI assistant.",
+		Context:       defaultContextSettings(),
+		Retention:     defaultRetentionPolicy(),
+		Log:           defaultLogSettings(),
+		UI: UISettings{
+			SpinnerMS:     100,
+			MarkdownStyle: defaultMarkdownStyle,
+			Colors: ThemeColors{
+				Title:     "63",
+				Border:    "62",
+				Text:      "252",
+				Muted:     "240",
+				Accent:    "203",
+				Assistant: "39",
+				Loading:   "214",
+				Error:     "196",
+			},
+		},
+	}
+}
+
+// SettingsError describes an invalid setting
+type SettingsError struct {
+	Key     string
+	Problem string
+}
+
+func (e *SettingsError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Problem)
+}
+
+// validateSettings checks every setting. Invalid values are replaced by their
+// defaults and reported together.
+func validateSettings(s *Settings) error {
+	defaults := defaultSettings()
+	var errs []error
+	invalid := func(key, problem string) {
+		errs = append(errs, &SettingsError{Key: key, Problem: problem})
+	}
+
+	if strings.TrimSpace(s.DefaultModel) == "" {
+		invalid("default_model", "must not be empty")
+		s.DefaultModel = defaults.DefaultModel
+	}
+	if strings.TrimSpace(s.SystemPrompt) == "" {
+		invalid("system_prompt", "must not be empty")
+		s.SystemPrompt = defaults.SystemPrompt
+	}
+	if !isContextStrategy(s.Context.Strategy) {
+		invalid("context.strategy", fmt.Sprintf("must be %s, %s or %s, got %q", contextSliding, contextPinned, contextSummarize, s.Context.Strategy))
+		s.Context.Strategy = defaults.Context.Strategy
+	}
+	if s.Context.ReserveTokens < 0 || s.Context.ReserveTokens > 1000000 {
+		invalid("context.reserve_tokens", fmt.Sprintf("must be between 0 and 1000000, got %d", s.Context.ReserveTokens))
+		s.Context.ReserveTokens = defaults.Context.ReserveTokens
+	}
+	if s.Context.KeepRecent < 0 {
+		invalid("context.keep_recent", fmt.Sprintf("must not be negative, got %d", s.Context.KeepRecent))
+		s.Context.KeepRecent = defaults.Context.KeepRecent
+	}
+	for key, value := range map[string]*int{
+		"retention.max_age_days": &s.Retention.MaxAgeDays,
+		"retention.max_total_mb": &s.Retention.MaxTotalMB,
+		"retention.trash_days":   &s.Retention.TrashDays,
+	} {
+		if *value < 0 {
+			invalid(key, fmt.Sprintf("must not be negative (0 disables the rule), got %d", *value))
+			*value = 0
+		}
+	}
+	if s.UI.SpinnerMS < 20 || s.UI.SpinnerMS > 2000 {
+		invalid("ui.spinner_ms", fmt.Sprintf("must be between 20 and 2000, got %d", s.UI.SpinnerMS))
+		s.UI.SpinnerMS = defaults.UI.SpinnerMS
+	}
+	if !isMarkdownStyle(s.UI.MarkdownStyle) {
+		invalid("ui.markdown_style", fmt.Sprintf("must be one of %s, got %q", strings.Join(markdownStyles(), ", "), s.UI.MarkdownStyle))
+		s.UI.MarkdownStyle = defaults.UI.MarkdownStyle
+	}
+	colors := map[string][2]*string{
+		"title":     {&s.UI.Colors.Title, &defaults.UI.Colors.Title},
+		"border":    {&s.UI.Colors.Border, &defaults.UI.Colors.Border},
+		"text":      {&s.UI.Colors.Text, &defaults.UI.Colors.Text},
+		"muted":     {&s.UI.Colors.Muted, &defaults.UI.Colors.Muted},
+		"accent":    {&s.UI.Colors.Accent, &defaults.UI.Colors.Accent},
+		"assistant": {&s.UI.Colors.Assistant, &defaults.UI.Colors.Assistant},
+		"loading":   {&s.UI.Colors.Loading, &defaults.UI.Colors.Loading},
+		"error":     {&s.UI.Colors.Error, &defaults.UI.Colors.Error},
+	}
+	for name, color := range colors {
+		value := *color[0]
+		n, err := strconv.Atoi(value)
+		if !colorPattern.MatchString(value) || (err == nil && n > 255) {
+			invalid("ui.colors."+name, fmt.Sprintf("must be a color number 0-255 or #rrggbb, got %q", value))
+			*color[0] = *color[1]
+		}
+	}
+	if _, ok := logLevels[s.Log.Level]; !ok {
+		invalid("log.level", fmt.Sprintf("must be debug, info, warn or error, got %q", s.Log.Level))
+		s.Log.Level = defaults.Log.Level
+	}
+	if s.Log.Format != "text" && s.Log.Format != "json" {
+		invalid("log.format", fmt.Sprintf("must be text or json, got %q", s.Log.Format))
+		s.Log.Format = defaults.Log.Format
+	}
+	if s.Log.MaxSizeMB < 1 || s.Log.MaxSizeMB > 1024 {
+		invalid("log.max_size_mb", fmt.Sprintf("must be between 1 and 1024, got %d", s.Log.MaxSizeMB))
+		s.Log.MaxSizeMB = defaults.Log.MaxSizeMB
+	}
+	if s.Log.MaxFiles < 0 || s.Log.MaxFiles > 50 {
+		invalid("log.max_files", fmt.Sprintf("must be between 0 and 50, got %d", s.Log.MaxFiles))
+		s.Log.MaxFiles = defaults.Log.MaxFiles
+	}
+
+	// Report in a stable order
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errors.Join(errs...)
+}
+
+// parseSettings decodes settings on top of the defaults and validates them.
+// The returned settings are always usable, even alongside an error.
+func parseSettings(data []byte) (Settings, error) {
+	settings := defaultSettings()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	// Type errors and unknown keys still decode the rest of the file
+	var decodeErr error
+	if err := decoder.Decode(&settings); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var syntaxErr *json.SyntaxError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return defaultSettings(), fmt.Errorf("invalid JSON at byte %d: %v", syntaxErr.Offset, syntaxErr)
+		case errors.As(err, &typeErr):
+			decodeErr = &SettingsError{Key: typeErr.Field, Problem: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			decodeErr = fmt.Errorf("unknown setting %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return defaultSettings(), err
+		}
+	}
+	settings.SchemaVersion = settingsSchema.Version()
+	return settings, errors.Join(decodeErr, validateSettings(&settings))
+}
+
+// loadSettings reads and validates the settings file
+func loadSettings() (Settings, error) {
+	data, err := readVersionedFile(settingsSchema, settingsPath(), 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return defaultSettings(), nil
+		}
+		return defaultSettings(), fmt.Errorf("failed to read settings: %w", err)
+	}
+	settings, err := parseSettings(data)
+	if err != nil {
+		return settings, fmt.Errorf("%s: %w", settingsPath(), err)
+	}
+	return settings, nil
+}
+
+// currentSettings returns the settings, reloading them when the file changed.
+// Invalid values fall back to their defaults; see settingsError.
+func currentSettings() Settings {
+	settingsState.mu.Lock()
+	defer settingsState.mu.Unlock()
+	if settingsState.loaded && time.Since(settingsState.checked) < settingsCheckInterval {
+		return settingsState.settings
+	}
+	settingsState.checked = time.Now()
+	info, err := os.Stat(settingsPath())
+	if err != nil {
+		// Not created yet: use the defaults without caching them
+		return defaultSettings()
+	}
+	if settingsState.loaded && info.ModTime().Equal(settingsState.modTime) {
+		return settingsState.settings
+	}
+	settingsState.settings, settingsState.err = loadSettings()
+	settingsState.modTime = info.ModTime()
+	settingsState.loaded = true
+	applyLogLevel(settingsState.settings.Log.Level)
+	if settingsState.err != nil {
+		logger.Warn("invalid settings", "err", settingsState.err)
+	}
+	return settingsState.settings
+}
+
+// settingsError returns the problem found when the settings were last loaded
+func settingsError() error {
+	currentSettings()
+	settingsState.mu.Lock()
+	defer settingsState.mu.Unlock()
+	return settingsState.err
+}
+
+// saveSettings validates and writes the settings
+func saveSettings(settings Settings) error {
+	if err := validateSettings(&settings); err != nil {
+		return err
+	}
+	settings.SchemaVersion = settingsSchema.Version()
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+
+	settingsState.mu.Lock()
+	defer settingsState.mu.Unlock()
+	if err := writeFileAtomic(settingsPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	settingsState.settings = settings
+	settingsState.err = nil
+	applyLogLevel(settings.Log.Level)
+	settingsState.loaded = true
+	settingsState.checked = time.Now()
+	if info, err := os.Stat(settingsPath()); err == nil {
+		settingsState.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// updateSettings applies fn to the current settings and saves them
+func updateSettings(fn func(*Settings)) error {
+	settings := currentSettings()
+	fn(&settings)
+	return saveSettings(settings)
+}
+
+// readLegacyJSON decodes a file written before the settings file existed,
+// without migrating it. Missing or unreadable files are ignored.
+func readLegacyJSON(path string, v any) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if data, err = openData(data); err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// initializeSettings creates the settings file on first run, carrying over
+// the defaults older versions kept in models.json, prompts.json,
+// api_keys.json and retention.json
+func initializeSettings() error {
+	if _, err := os.Stat(settingsPath()); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	settings := defaultSettings()
+
+	var models struct {
+		Models []struct {
+			Name      string `json:"name"`
+			IsDefault bool   `json:"is_default"`
+		} `json:"models"`
+		Context *ContextSettings `json:"context"`
+		AutoTag bool             `json:"auto_tag"`
+	}
+	if readLegacyJSON(modelsFilePath(), &models) {
+		for _, m := range models.Models {
+			if m.IsDefault {
+				settings.DefaultModel = m.Name
+			}
+		}
+		if models.Context != nil {
+			settings.Context = *models.Context
+		}
+		settings.AutoTag = models.AutoTag
+	}
+
+	type legacyPrompt struct {
+		Name    string `json:"name"`
+		Default bool   `json:"default"`
+	}
+	var prompts struct {
+		Prompts []legacyPrompt `json:"prompts"`
+	}
+	// The oldest prompts files are a bare array
+	if !readLegacyJSON(promptsConfigPath(), &prompts) {
+		readLegacyJSON(promptsConfigPath(), &prompts.Prompts)
+	}
+	for _, p := range prompts.Prompts {
+		if p.Default {
+			settings.DefaultPrompt = p.Name
+		}
+	}
+
+	var keys struct {
+		ActiveKey string `json:"active_key"`
+	}
+	if readLegacyJSON(getAPIKeysPath(), &keys) {
+		settings.ActiveAPIKey = keys.ActiveKey
+	}
+
+	if readLegacyJSON(retentionPolicyPath(), &settings.Retention) {
+		// The retention rules now live in the settings; keep the old file as
+		// a backup, sealed when there is a vault
+		raw, err := os.ReadFile(retentionPolicyPath())
+		if err != nil {
+			return fmt.Errorf("failed to read retention.json: %w", err)
+		}
+		written, err := writeBackup(schemaBackupPath(retentionPolicyPath(), 1), raw, 0600, true)
+		if err != nil {
+			return fmt.Errorf("failed to back up retention.json: %w", err)
+		}
+		if written {
+			if err := os.Remove(retentionPolicyPath()); err != nil {
+				return fmt.Errorf("failed to retire retention.json: %w", err)
+			}
+		}
+	}
+
+	// Keep whatever was valid in the old files
+	_ = validateSettings(&settings)
+	return saveSettings(settings)
+}
+
+// settingField is one option shown on the settings screen
+type settingField struct {
+	Key     string
+	Get     func(Settings) string
+	Set     func(*Settings, string) error
+	Choices func() []string // Offered instead of free text when set
+}
+
+// boolChoices are the values offered for on/off settings
+func boolChoices() []string {
+	return []string{"on", "off"}
+}
+
+// formatBool shows a boolean setting
+func formatBool(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// stringSetting edits a text setting
+func stringSetting(key string, field func(*Settings) *string, choices func() []string) settingField {
+	return settingField{
+		Key: key,
+		Get: func(s Settings) string { return *field(&s) },
+		Set: func(s *Settings, value string) error {
+			*field(s) = strings.TrimSpace(value)
+			return nil
+		},
+		Choices: choices,
+	}
+}
+
+// intSetting edits a whole number setting
+func intSetting(key string, field func(*Settings) *int) settingField {
+	return settingField{
+		Key: key,
+		Get: func(s Settings) string { return strconv.Itoa(*field(&s)) },
+		Set: func(s *Settings, value string) error {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return &SettingsError{Key: key, Problem: fmt.Sprintf("expected a whole number, got %q", value)}
+			}
+			*field(s) = n
+			return nil
+		},
+	}
+}
+
+// boolSetting edits an on/off setting
+func boolSetting(key string, field func(*Settings) *bool) settingField {
+	return settingField{
+		Key: key,
+		Get: func(s Settings) string { return formatBool(*field(&s)) },
+		Set: func(s *Settings, value string) error {
+			*field(s) = value == "on"
+			return nil
+		},
+		Choices: boolChoices,
+	}
+}
+
+// modelChoices lists the configured models
+func modelChoices() []string {
+	models, _, err := loadModelsWithMostRecent()
+	if err != nil {
+		return nil
+	}
+	return models
+}
+
+// promptChoices lists the global prompts
+func promptChoices() []string {
+	prompts, err := loadPrompts()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, p := range prompts {
+		if !p.Project {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// apiKeyChoices lists the titles of the stored API keys
+func apiKeyChoices() []string {
+	keys, _, err := listAPIKeys()
+	if err != nil {
+		return nil
+	}
+	var titles []string
+	for _, key := range keys {
+		titles = append(titles, key.Title)
+	}
+	return titles
+}
+
+// settingFields lists every option in the order shown on the settings screen
+func settingFields() []settingField {
+	return []settingField{
+		stringSetting("default_model", func(s *Settings) *string { return &s.DefaultModel }, modelChoices),
+		stringSetting("default_prompt", func(s *Settings) *string { return &s.DefaultPrompt }, promptChoices),
+		stringSetting("active_api_key", func(s *Settings) *string { return &s.ActiveAPIKey }, apiKeyChoices),
+		stringSetting("api_key_command", func(s *Settings) *string { return &s.APIKeyCommand }, nil),
+		stringSetting("system_prompt", func(s *Settings) *string { return &s.SystemPrompt }, nil),
+		boolSetting("auto_tag", func(s *Settings) *bool { return &s.AutoTag }),
+		stringSetting("context.strategy", func(s *Settings) *string { return &s.Context.Strategy }, func() []string {
+			return []string{contextSliding, contextPinned, contextSummarize}
+		}),
+		intSetting("context.reserve_tokens", func(s *Settings) *int { return &s.Context.ReserveTokens }),
+		intSetting("context.keep_recent", func(s *Settings) *int { return &s.Context.KeepRecent }),
+		boolSetting("retention.purge_empty", func(s *Settings) *bool { return &s.Retention.PurgeEmpty }),
+		intSetting("retention.max_age_days", func(s *Settings) *int { return &s.Retention.MaxAgeDays }),
+		intSetting("retention.max_total_mb", func(s *Settings) *int { return &s.Retention.MaxTotalMB }),
+		intSetting("retention.trash_days", func(s *Settings) *int { return &s.Retention.TrashDays }),
+		boolSetting("retention.dry_run", func(s *Settings) *bool { return &s.Retention.DryRun }),
+		intSetting("ui.spinner_ms", func(s *Settings) *int { return &s.UI.SpinnerMS }),
+		stringSetting("ui.markdown_style", func(s *Settings) *string { return &s.UI.MarkdownStyle }, markdownStyles),
+		stringSetting("ui.colors.title", func(s *Settings) *string { return &s.UI.Colors.Title }, nil),
+		stringSetting("ui.colors.border", func(s *Settings) *string { return &s.UI.Colors.Border }, nil),
+		stringSetting("ui.colors.text", func(s *Settings) *string { return &s.UI.Colors.Text }, nil),
+		stringSetting("ui.colors.muted", func(s *Settings) *string { return &s.UI.Colors.Muted }, nil),
+		stringSetting("ui.colors.accent", func(s *Settings) *string { return &s.UI.Colors.Accent }, nil),
+		stringSetting("ui.colors.assistant", func(s *Settings) *string { return &s.UI.Colors.Assistant }, nil),
+		stringSetting("ui.colors.loading", func(s *Settings) *string { return &s.UI.Colors.Loading }, nil),
+		stringSetting("ui.colors.error", func(s *Settings) *string { return &s.UI.Colors.Error }, nil),
+		stringSetting("log.level", func(s *Settings) *string { return &s.Log.Level }, func() []string {
+			return []string{"debug", "info", "warn", "error"}
+		}),
+		stringSetting("log.format", func(s *Settings) *string { return &s.Log.Format }, func() []string {
+			return []string{"text", "json"}
+		}),
+		intSetting("log.max_size_mb", func(s *Settings) *int { return &s.Log.MaxSizeMB }),
+		intSetting("log.max_files", func(s *Settings) *int { return &s.Log.MaxFiles }),
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxAutoTags is the most tags automatic tagging adds to a chat
+const maxAutoTags = 3
+
+// chatEntry is a chat with the metadata needed by list and browse views
+type chatEntry struct {
+	ID   string
+	Meta ChatMetadata
+}
+
+// Title returns the display title of the chat
+func (c chatEntry) Title() string {
+	if c.Meta.Title != "" {
+		return c.Meta.Title
+	}
+	return c.ID
+}
+
+// tagCount is a tag together with the number of chats carrying it
+type tagCount struct {
+	Tag   string
+	Count int
+}
+
+// normalizeTag lowercases a tag and joins its words with dashes
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	tag = strings.Trim(tag, "#,.;:\"'`")
+	return strings.Join(strings.Fields(tag), "-")
+}
+
+// normalizeTags normalizes, deduplicates and sorts tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// normalizeFolder cleans a slash-separated folder path; "" is the root
+func normalizeFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		part = strings.Join(strings.Fields(part), " ")
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// hasTag reports whether tags contains tag
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTagEdits applies edits such as "work", "+draft" or "-draft" to tags
+func applyTagEdits(tags []string, edits []string) []string {
+	result := append([]string{}, tags...)
+	for _, edit := range edits {
+		if strings.HasPrefix(edit, "-") {
+			remove := normalizeTag(edit[1:])
+			kept := result[:0]
+			for _, tag := range result {
+				if tag != remove {
+					kept = append(kept, tag)
+				}
+			}
+			result = kept
+		} else {
+			result = append(result, strings.TrimPrefix(edit, "+"))
+		}
+	}
+	return normalizeTags(result)
+}
+
+// loadChatEntries loads the metadata of the given chats, skipping unreadable ones
+func loadChatEntries(ids []string) []chatEntry {
+	var entries []chatEntry
+	for _, id := range ids {
+		chatFile, err := loadChatWithMetadata(id)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, chatEntry{ID: id, Meta: chatFile.Metadata})
+	}
+	return entries
+}
+
+// tagCounts returns every tag used by entries with its number of chats
+func tagCounts(entries []chatEntry) []tagCount {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		for _, tag := range entry.Meta.Tags {
+			counts[tag]++
+		}
+	}
+	var result []tagCount
+	for tag, count := range counts {
+		result = append(result, tagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Tag < result[j].Tag
+	})
+	return result
+}
+
+// chatsWithTag returns the entries carrying tag
+func chatsWithTag(entries []chatEntry, tag string) []chatEntry {
+	var result []chatEntry
+	for _, entry := range entries {
+		if hasTag(entry.Meta.Tags, tag) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// folderContents returns the direct subfolders of folder and the chats filed
+// directly in it
+func folderContents(entries []chatEntry, folder string) ([]string, []chatEntry) {
+	prefix := ""
+	if folder != "" {
+		prefix = folder + "/"
+	}
+	seen := make(map[string]bool)
+	var subfolders []string
+	var chats []chatEntry
+	for _, entry := range entries {
+		chatFolder := normalizeFolder(entry.Meta.Folder)
+		if chatFolder == folder {
+			chats = append(chats, entry)
+			continue
+		}
+		if !strings.HasPrefix(chatFolder, prefix) {
+			continue
+		}
+		sub := strings.SplitN(strings.TrimPrefix(chatFolder, prefix), "/", 2)[0]
+		if !seen[sub] {
+			seen[sub] = true
+			subfolders = append(subfolders, sub)
+		}
+	}
+	sort.Strings(subfolders)
+	return subfolders, chats
+}
+
+// parentFolder returns the folder containing folder
+func parentFolder(folder string) string {
+	if i := strings.LastIndex(folder, "/"); i >= 0 {
+		return folder[:i]
+	}
+	return ""
+}
+
+// retagChats applies tag edits to every given chat
+func retagChats(ids []string, edits []string) error {
+	for _, id := range ids {
+		err := updateChatMetadata(id, func(meta *ChatMetadata) {
+			meta.Tags = applyTagEdits(meta.Tags, edits)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to retag chat '%s': %w", id, err)
+		}
+	}
+	return nil
+}
+
+// moveChatsToFolder files every given chat under folder
+func moveChatsToFolder(ids []string, folder string) error {
+	folder = normalizeFolder(folder)
+	for _, id := range ids {
+		err := updateChatMetadata(id, func(meta *ChatMetadata) {
+			meta.Folder = folder
+		})
+		if err != nil {
+			return fmt.Errorf("failed to move chat '%s': %w", id, err)
+		}
+	}
+	return nil
+}
+
+// autoTagEnabled reports whether chats are tagged automatically
+func autoTagEnabled() bool {
+	return currentSettings().AutoTag
+}
+
+// generateChatTags asks the model for a few topic tags for a conversation
+func generateChatTags(messages []Message, existing []string, model, apiKey string) ([]string, error) {
+	excerpt := conversationExcerpt(messages, 6)
+	if excerpt == "" {
+		return nil, fmt.Errorf("no messages to tag")
+	}
+	known := ""
+	if len(existing) > 0 {
+		known = "\nThe chat is already tagged: " + strings.Join(existing, ", ") + "."
+	}
+	tagMessages := []Message{
+		{Role: "system", Content: "You classify chat conversations by topic."},
+		{Role: "user", Content: "Conversation:\n" + excerpt + known + fmt.Sprintf("\nGive 1 to %d short lowercase topic tags for this chat, separated by commas. Return only the tags, nothing else.", maxAutoTags)},
+	}
+	reply, err := completeChat(tagMessages, model, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	tags := normalizeTags(strings.FieldsFunc(reply, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}))
+	if len(tags) > maxAutoTags {
+		tags = tags[:maxAutoTags]
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("model returned no tags")
+	}
+	return tags, nil
+}
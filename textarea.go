@@ -0,0 +1,465 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/rivo/uniseg"
+)
+
+// tabWidth is how many columns a tab takes in the input
+const tabWidth = 4
+
+// TextArea is a multiline text input. The cursor moves by grapheme
+// cluster, so accented letters, CJK and emoji are edited as one
+// character, and lines wrap by display width.
+type TextArea struct {
+	lines     []string
+	row       int // Line of the cursor
+	col       int // Byte offset of the cursor in its line
+	goal      int // Column kept while moving up and down; -1 when unset
+	width     int
+	maxHeight int
+	offset    int // First visual row shown
+}
+
+// textRow is one wrapped row of the text: bytes start to end of a line
+type textRow struct {
+	line, start, end int
+}
+
+// NewTextArea creates an empty text area that grows up to maxHeight rows
+func NewTextArea(maxHeight int) TextArea {
+	return TextArea{lines: []string{""}, goal: -1, width: 40, maxHeight: max(1, maxHeight)}
+}
+
+// SetWidth sets the number of columns the text wraps at
+func (t *TextArea) SetWidth(width int) {
+	t.width = max(2, width)
+	t.scrollToCursor()
+}
+
+// Value returns the text
+func (t TextArea) Value() string {
+	return strings.Join(t.lines, "\n")
+}
+
+// SetValue replaces the text and puts the cursor at its end
+func (t *TextArea) SetValue(s string) {
+	t.lines = []string{""}
+	t.row, t.col, t.goal, t.offset = 0, 0, -1, 0
+	t.InsertString(s)
+}
+
+// Reset clears the text
+func (t *TextArea) Reset() {
+	t.SetValue("")
+}
+
+// Empty reports whether there is no text
+func (t TextArea) Empty() bool {
+	return len(t.lines) == 1 && t.lines[0] == ""
+}
+
+// InsertString inserts s at the cursor. Line endings are normalized and
+// control characters other than newlines and tabs are dropped.
+func (t *TextArea) InsertString(s string) {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	s = strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return
+	}
+	line := t.lines[t.row]
+	before, after := line[:t.col], line[t.col:]
+	parts := strings.Split(s, "\n")
+	if len(parts) == 1 {
+		t.lines[t.row] = before + s + after
+		t.col += len(s)
+	} else {
+		inserted := make([]string, len(parts))
+		inserted[0] = before + parts[0]
+		copy(inserted[1:], parts[1:])
+		last := len(parts) - 1
+		inserted[last] = parts[last] + after
+		t.lines = append(t.lines[:t.row], append(inserted, t.lines[t.row+1:]...)...)
+		t.row += last
+		t.col = len(parts[last])
+	}
+	t.goal = -1
+	t.scrollToCursor()
+}
+
+// Update applies an editing key and reports whether it was one
+func (t *TextArea) Update(msg tea.KeyMsg) bool {
+	keepGoal := false
+	switch msg.String() {
+	case "alt+enter", "ctrl+j":
+		t.InsertString("\n")
+	case "backspace", "ctrl+h":
+		t.deleteBack(t.prevGrapheme())
+	case "alt+backspace", "ctrl+w":
+		t.deleteBack(t.prevWord())
+	case "delete", "ctrl+d":
+		t.deleteForward(t.nextGrapheme())
+	case "alt+d", "alt+delete":
+		t.deleteForward(t.nextWord())
+	case "ctrl+u":
+		t.deleteBack(0)
+	case "ctrl+k":
+		t.deleteForward(len(t.lines[t.row]))
+	case "left", "ctrl+b":
+		t.moveLeft()
+	case "right", "ctrl+f":
+		t.moveRight()
+	case "alt+left", "alt+b":
+		if t.col == 0 {
+			t.moveLeft()
+		} else {
+			t.col = t.prevWord()
+		}
+	case "alt+right", "alt+f":
+		if t.col == len(t.lines[t.row]) {
+			t.moveRight()
+		} else {
+			t.col = t.nextWord()
+		}
+	case "home", "ctrl+a":
+		t.col = 0
+	case "end", "ctrl+e":
+		t.col = len(t.lines[t.row])
+	case "up", "ctrl+p":
+		t.moveVertical(-1)
+		keepGoal = true
+	case "down", "ctrl+n":
+		t.moveVertical(1)
+		keepGoal = true
+	default:
+		switch msg.Type {
+		case tea.KeyRunes, tea.KeySpace, tea.KeyTab:
+			if msg.Alt && !msg.Paste {
+				return false
+			}
+			text := string(msg.Runes)
+			if msg.Type == tea.KeyTab {
+				text = "\t"
+			}
+			t.InsertString(text)
+		default:
+			return false
+		}
+	}
+	if !keepGoal {
+		t.goal = -1
+	}
+	t.scrollToCursor()
+	return true
+}
+
+// prevGrapheme returns the offset of the character before the cursor
+func (t TextArea) prevGrapheme() int {
+	line := t.lines[t.row][:t.col]
+	prev := 0
+	g := uniseg.NewGraphemes(line)
+	for g.Next() {
+		start, _ := g.Positions()
+		prev = start
+	}
+	return prev
+}
+
+// nextGrapheme returns the offset after the character at the cursor
+func (t TextArea) nextGrapheme() int {
+	cluster, _, _, _ := uniseg.FirstGraphemeClusterInString(t.lines[t.row][t.col:], -1)
+	return t.col + len(cluster)
+}
+
+// isWordRune reports whether r belongs to a word for word motions
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// prevWord returns the offset of the start of the word before the cursor
+func (t TextArea) prevWord() int {
+	line := t.lines[t.row]
+	i := t.col
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:i])
+		if isWordRune(r) {
+			break
+		}
+		i -= size
+	}
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:i])
+		if !isWordRune(r) {
+			break
+		}
+		i -= size
+	}
+	return i
+}
+
+// nextWord returns the offset of the end of the word after the cursor
+func (t TextArea) nextWord() int {
+	line := t.lines[t.row]
+	i := t.col
+	for i < len(line) {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if isWordRune(r) {
+			break
+		}
+		i += size
+	}
+	for i < len(line) {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if !isWordRune(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// deleteBack removes the text from offset to the cursor, joining the line
+// with the previous one when the cursor is at its start
+func (t *TextArea) deleteBack(offset int) {
+	if t.col == 0 {
+		if t.row == 0 {
+			return
+		}
+		prev := t.lines[t.row-1]
+		t.lines[t.row-1] = prev + t.lines[t.row]
+		t.lines = append(t.lines[:t.row], t.lines[t.row+1:]...)
+		t.row--
+		t.col = len(prev)
+		return
+	}
+	line := t.lines[t.row]
+	t.lines[t.row] = line[:offset] + line[t.col:]
+	t.col = offset
+}
+
+// deleteForward removes the text from the cursor to offset, joining the
+// next line when the cursor is at the end of its line
+func (t *TextArea) deleteForward(offset int) {
+	line := t.lines[t.row]
+	if t.col == len(line) {
+		if t.row == len(t.lines)-1 {
+			return
+		}
+		t.lines[t.row] = line + t.lines[t.row+1]
+		t.lines = append(t.lines[:t.row+1], t.lines[t.row+2:]...)
+		return
+	}
+	t.lines[t.row] = line[:t.col] + line[offset:]
+}
+
+func (t *TextArea) moveLeft() {
+	if t.col > 0 {
+		t.col = t.prevGrapheme()
+	} else if t.row > 0 {
+		t.row--
+		t.col = len(t.lines[t.row])
+	}
+}
+
+func (t *TextArea) moveRight() {
+	if t.col < len(t.lines[t.row]) {
+		t.col = t.nextGrapheme()
+	} else if t.row < len(t.lines)-1 {
+		t.row++
+		t.col = 0
+	}
+}
+
+// moveVertical moves the cursor delta wrapped rows, keeping its column
+func (t *TextArea) moveVertical(delta int) {
+	rows := t.layout()
+	current, column := t.cursorPosition(rows)
+	if t.goal < 0 {
+		t.goal = column
+	}
+	target := current + delta
+	if target < 0 || target >= len(rows) {
+		return
+	}
+	row := rows[target]
+	line := t.lines[row.line]
+	t.row, t.col = row.line, row.start
+	width := 0
+	g := uniseg.NewGraphemes(line[row.start:row.end])
+	for g.Next() {
+		w := graphemeWidth(g.Str())
+		if width+w > t.goal {
+			break
+		}
+		width += w
+		_, end := g.Positions()
+		t.col = row.start + end
+	}
+	// A wrapped row ends where the next one starts; stay on this row
+	if t.col == row.end && row.end < len(line) && t.col > row.start {
+		t.col = t.col - len(lastGrapheme(line[row.start:row.end]))
+	}
+}
+
+// editLine applies a key to a simple input that is only edited at its end:
+// typed and pasted text is appended and backspace removes the last
+// character. Newlines are kept only when multiline is set. It reports
+// whether the key was an edit.
+func editLine(s string, msg tea.KeyMsg, multiline bool) (string, bool) {
+	switch msg.String() {
+	case "backspace", "ctrl+h":
+		return strings.TrimSuffix(s, lastGrapheme(s)), true
+	case "ctrl+u":
+		return "", true
+	}
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		if msg.Alt && !msg.Paste {
+			return s, false
+		}
+		text := strings.ReplaceAll(string(msg.Runes), "\r\n", "\n")
+		if !multiline {
+			// A pasted secret often ends with a newline
+			text = strings.TrimRight(text, "\r\n")
+		}
+		return s + strings.Map(func(r rune) rune {
+			if r == '\r' || (r == '\n' && !multiline) {
+				return ' '
+			}
+			if r != '\n' && r != '\t' && unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, text), true
+	}
+	return s, false
+}
+
+// maskText hides typed text, showing one dot per character
+func maskText(s string) string {
+	return strings.Repeat("•", uniseg.GraphemeClusterCount(s))
+}
+
+// lastGrapheme returns the last character of s
+func lastGrapheme(s string) string {
+	last := ""
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		last = g.Str()
+	}
+	return last
+}
+
+// graphemeWidth returns the columns a character takes in the input
+func graphemeWidth(s string) int {
+	if s == "\t" {
+		return tabWidth
+	}
+	return uniseg.StringWidth(s)
+}
+
+// layout wraps the lines into rows that fit the width. One column is kept
+// free for the cursor at the end of a row.
+func (t TextArea) layout() []textRow {
+	var rows []textRow
+	limit := max(1, t.width-1)
+	for i, line := range t.lines {
+		start, width := 0, 0
+		g := uniseg.NewGraphemes(line)
+		for g.Next() {
+			w := graphemeWidth(g.Str())
+			from, _ := g.Positions()
+			if width+w > limit && from > start {
+				rows = append(rows, textRow{line: i, start: start, end: from})
+				start, width = from, 0
+			}
+			width += w
+		}
+		rows = append(rows, textRow{line: i, start: start, end: len(line)})
+	}
+	return rows
+}
+
+// cursorPosition returns the wrapped row and column of the cursor
+func (t TextArea) cursorPosition(rows []textRow) (int, int) {
+	for i, row := range rows {
+		if row.line != t.row || t.col < row.start {
+			continue
+		}
+		last := i+1 == len(rows) || rows[i+1].line != t.row
+		if t.col < row.end || last {
+			return i, graphemesWidth(t.lines[t.row][row.start:t.col])
+		}
+	}
+	return 0, 0
+}
+
+// graphemesWidth returns the columns s takes in the input
+func graphemesWidth(s string) int {
+	width := 0
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		width += graphemeWidth(g.Str())
+	}
+	return width
+}
+
+// Height returns the number of rows the text area shows
+func (t TextArea) Height() int {
+	return min(t.maxHeight, len(t.layout()))
+}
+
+// scrollToCursor keeps the cursor's row within the shown rows
+func (t *TextArea) scrollToCursor() {
+	rows := t.layout()
+	current, _ := t.cursorPosition(rows)
+	height := min(t.maxHeight, len(rows))
+	t.offset = min(t.offset, current)
+	if current >= t.offset+height {
+		t.offset = current - height + 1
+	}
+	t.offset = max(0, min(t.offset, len(rows)-height))
+}
+
+// View renders the shown rows, with the cursor when focused
+func (t TextArea) View(focused bool) string {
+	rows := t.layout()
+	current, _ := t.cursorPosition(rows)
+	cursorStyle := lipgloss.NewStyle().Reverse(true)
+	var out []string
+	for i := t.offset; i < min(len(rows), t.offset+t.Height()); i++ {
+		row := rows[i]
+		text := t.lines[row.line][row.start:row.end]
+		var b strings.Builder
+		cursorShown := false
+		g := uniseg.NewGraphemes(text)
+		for g.Next() {
+			s := g.Str()
+			if s == "\t" {
+				s = strings.Repeat(" ", tabWidth)
+			}
+			from, _ := g.Positions()
+			if focused && i == current && row.start+from == t.col {
+				s = cursorStyle.Render(s)
+				cursorShown = true
+			}
+			b.WriteString(s)
+		}
+		if focused && i == current && !cursorShown {
+			b.WriteString(cursorStyle.Render(" "))
+		}
+		out = append(out, b.String())
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyChatGracePeriod keeps freshly created empty chats away from retention,
+// since another session may still be about to use them
+const emptyChatGracePeriod = time.Hour
+
+// RetentionPolicy configures which chats are cleaned up automatically on startup.
+// Zero values disable a rule.
+type RetentionPolicy struct {
+	PurgeEmpty bool `json:"purge_empty"`  // Trash chats that only contain the system prompt
+	MaxAgeDays int  `json:"max_age_days"` // Trash non-favorite chats untouched for this many days
+	MaxTotalMB int  `json:"max_total_mb"` // Trash the oldest non-favorite chats above this total size
+	TrashDays  int  `json:"trash_days"`   // Permanently delete trashed chats after this many days
+	DryRun     bool `json:"dry_run"`      // Only report what the rules would do
+}
+
+// TrashedChat describes a chat in the trash
+type TrashedChat struct {
+	ID        string
+	Title     string
+	DeletedAt time.Time
+}
+
+// retentionAction is a single change planned by the retention rules
+type retentionAction struct {
+	ChatID string
+	Title  string
+	Reason string
+	Size   int64
+	Purge  bool // Delete from the trash instead of moving to it
+}
+
+// trashChatPath returns the path of a chat's snapshot inside the trash
+func trashChatPath(id string) string {
+	return filepath.Join(chatDir(id), trashDir, id+".json")
+}
+
+// retentionPolicyPath returns the path of the retention policy file used
+// before the rules moved into the settings
+func retentionPolicyPath() string {
+	return filepath.Join(configPath, "retention.json")
+}
+
+// defaultRetentionPolicy returns the policy used when none is configured.
+// It only reports what it would do until the user turns dry_run off.
+func defaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{PurgeEmpty: true, TrashDays: 30, DryRun: true}
+}
+
+// loadRetentionPolicy returns the retention rules from the settings
+func loadRetentionPolicy() (RetentionPolicy, error) {
+	return currentSettings().Retention, nil
+}
+
+// trashChat moves a chat into the trash. The modification time of the
+// trashed file records when the chat was deleted.
+func trashChat(id string) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+
+	// Fold in the journal so the trash holds a single self-contained file
+	chatFile, _, err := readChat(id)
+	if err != nil {
+		return err
+	}
+	chatFile.SchemaVersion = chatSchema.Version()
+	data, err := json.MarshalIndent(chatFile, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat: %w", err)
+	}
+	if data, err = sealData(data, true); err != nil {
+		return fmt.Errorf("failed to seal chat '%s': %w", id, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(trashChatPath(id)), 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	if err := writeFileAtomic(trashChatPath(id), data, chatFileMode()); err != nil {
+		return fmt.Errorf("failed to move chat '%s' to trash: %w", id, err)
+	}
+	if err := os.Remove(chatSnapshotPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove chat '%s': %w", id, err)
+	}
+	if err := os.Remove(chatJournalPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal for chat '%s': %w", id, err)
+	}
+	return nil
+}
+
+// restoreChat moves a chat out of the trash
+func restoreChat(id string) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+
+	data, err := os.ReadFile(trashChatPath(id))
+	if err != nil {
+		return fmt.Errorf("failed to read trashed chat '%s': %w", id, err)
+	}
+	chatFile, err := parseChatSnapshot(id, data)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(chatSnapshotPath(id)); err == nil {
+		return fmt.Errorf("chat '%s' already exists", id)
+	}
+	if err := writeChatSnapshot(id, chatFile); err != nil {
+		return err
+	}
+	if err := os.Remove(trashChatPath(id)); err != nil {
+		return fmt.Errorf("failed to remove chat '%s' from trash: %w", id, err)
+	}
+	return nil
+}
+
+// purgeTrashedChat permanently deletes a chat from the trash
+func purgeTrashedChat(id string) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+
+	if err := os.Remove(trashChatPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete trashed chat '%s': %w", id, err)
+	}
+	return nil
+}
+
+// listTrashedChats lists the chats in the trash, most recently deleted first
+func listTrashedChats() ([]TrashedChat, error) {
+	var files []fs.DirEntry
+	for _, dir := range chatDirs() {
+		entries, err := os.ReadDir(filepath.Join(dir, trashDir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read trash directory: %w", err)
+		}
+		files = append(files, entries...)
+	}
+	var trashed []TrashedChat
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(f.Name(), ".json")
+		chat := TrashedChat{ID: id, Title: id}
+		if info, err := f.Info(); err == nil {
+			chat.DeletedAt = info.ModTime()
+		}
+		if data, err := os.ReadFile(trashChatPath(id)); err == nil {
+			if chatFile, err := parseChatSnapshot(id, data); err == nil {
+				chat.Title = chatDisplayTitle(chatFile, id)
+			}
+		}
+		trashed = append(trashed, chat)
+	}
+	sort.Slice(trashed, func(i, j int) bool {
+		return trashed[i].DeletedAt.After(trashed[j].DeletedAt)
+	})
+	return trashed, nil
+}
+
+// emptyTrash permanently deletes every chat in the trash
+func emptyTrash() (int, error) {
+	trashed, err := listTrashedChats()
+	if err != nil {
+		return 0, err
+	}
+	for i, chat := range trashed {
+		if err := purgeTrashedChat(chat.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(trashed), nil
+}
+
+// planRetention works out which chats the policy would trash or purge
+func planRetention(policy RetentionPolicy) ([]retentionAction, error) {
+	files, err := readChatDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	type chatInfo struct {
+		id       string
+		title    string
+		size     int64
+		modified time.Time
+		favorite bool
+		empty    bool
+	}
+	var chats []chatInfo
+	var totalSize int64
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(f.Name(), ".json")
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		chat := chatInfo{id: id, title: id, size: info.Size(), modified: info.ModTime()}
+		if journal, err := os.Stat(chatJournalPath(id)); err == nil {
+			chat.size += journal.Size()
+			if journal.ModTime().After(chat.modified) {
+				chat.modified = journal.ModTime()
+			}
+		}
+		chatFile, err := loadChatWithMetadata(id)
+		if err != nil {
+			// Leave unreadable chats alone rather than guess
+			continue
+		}
+		chat.title = chatDisplayTitle(chatFile, id)
+		chat.favorite = chatFile.Metadata.Favorite
+		chat.empty = true
+		for _, msg := range chatFile.Messages {
+			if msg.Role != "system" {
+				chat.empty = false
+				break
+			}
+		}
+		totalSize += chat.size
+		chats = append(chats, chat)
+	}
+
+	// Oldest first, so the size cap removes the least recently used chats
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].modified.Before(chats[j].modified)
+	})
+
+	now := time.Now()
+	var actions []retentionAction
+	for _, chat := range chats {
+		reason := ""
+		switch {
+		case policy.PurgeEmpty && chat.empty && !chat.favorite && now.Sub(chat.modified) > emptyChatGracePeriod:
+			reason = "only contains the system prompt"
+		case policy.MaxAgeDays > 0 && !chat.favorite && now.Sub(chat.modified) > time.Duration(policy.MaxAgeDays)*24*time.Hour:
+			reason = fmt.Sprintf("not used for more than %d days", policy.MaxAgeDays)
+		case policy.MaxTotalMB > 0 && !chat.favorite && totalSize > int64(policy.MaxTotalMB)<<20:
+			reason = fmt.Sprintf("chats exceed %d MB", policy.MaxTotalMB)
+		default:
+			continue
+		}
+		totalSize -= chat.size
+		actions = append(actions, retentionAction{ChatID: chat.id, Title: chat.title, Reason: reason, Size: chat.size})
+	}
+
+	if policy.TrashDays > 0 {
+		trashed, err := listTrashedChats()
+		if err != nil {
+			return actions, err
+		}
+		for _, chat := range trashed {
+			if now.Sub(chat.DeletedAt) > time.Duration(policy.TrashDays)*24*time.Hour {
+				actions = append(actions, retentionAction{ChatID: chat.ID, Title: chat.Title, Reason: fmt.Sprintf("in trash for more than %d days", policy.TrashDays), Purge: true})
+			}
+		}
+	}
+	return actions, nil
+}
+
+// applyRetention carries out planned retention actions
+func applyRetention(actions []retentionAction) error {
+	for _, action := range actions {
+		var err error
+		if action.Purge {
+			err = purgeTrashedChat(action.ChatID)
+		} else {
+			err = trashChat(action.ChatID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retentionReport describes planned retention actions for display
+func retentionReport(actions []retentionAction, dryRun bool) string {
+	if len(actions) == 0 {
+		return "No chats matched the retention rules."
+	}
+	trashVerb, purgeVerb := "Moved to trash", "Deleted"
+	if dryRun {
+		trashVerb, purgeVerb = "Would move to trash", "Would delete"
+	}
+	var b strings.Builder
+	for _, action := range actions {
+		verb := trashVerb
+		if action.Purge {
+			verb = purgeVerb
+		}
+		fmt.Fprintf(&b, "%s: %s (%s)\n", verb, action.Title, action.Reason)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// runRetention applies the retention policy on startup and returns a report
+// of what was done, or of what would be done when the policy is a dry run
+func runRetention() (string, error) {
+	policy, err := loadRetentionPolicy()
+	if err != nil {
+		return "", err
+	}
+	actions, err := planRetention(policy)
+	if err != nil {
+		return "", err
+	}
+	if len(actions) == 0 {
+		return "", nil
+	}
+	if !policy.DryRun {
+		if err := applyRetention(actions); err != nil {
+			return "", err
+		}
+	}
+	return retentionReport(actions, policy.DryRun), nil
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// The interface runs as one Bubble Tea program. appModel keeps a stack of
+// screens and sends them the window size and all other messages; key and
+// mouse input goes to the top one. Menu flows are plain functions running
+// outside the program: runScreen pushes a screen and waits for the result
+// it reports with screenDone.
+
+// errTUIClosed is returned to flows whose screen was open when the program ended
+var errTUIClosed = errors.New("the interface was closed")
+
+// screenDoneMsg closes the screen that sent it and hands result to the flow
+// that opened it
+type screenDoneMsg struct {
+	id     int
+	Result any
+}
+
+// screenDone returns a command that closes the current screen with result
+func screenDone(result any) tea.Cmd {
+	return func() tea.Msg {
+		return screenDoneMsg{Result: result}
+	}
+}
+
+// pushScreenMsg opens a screen, or a modal dialog over the current one
+type pushScreenMsg struct {
+	screen tea.Model
+	modal  bool
+	reply  chan any // Receives the result; nil when nobody waits for it
+	onDone func(result any) tea.Msg
+}
+
+// openModal returns a command that shows a dialog over the current screen.
+// Screens use it instead of runScreen, which must not be called from Update.
+func openModal(screen tea.Model) tea.Cmd {
+	return func() tea.Msg {
+		return pushScreenMsg{screen: screen, modal: true}
+	}
+}
+
+// openDialog is like openModal, but the message onDone makes of the
+// dialog's result is sent to the screens when it closes
+func openDialog(screen tea.Model, onDone func(result any) tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return pushScreenMsg{screen: screen, modal: true, onDone: onDone}
+	}
+}
+
+// openScreen is like openDialog for a full screen, which covers the
+// current one until it closes
+func openScreen(screen tea.Model, onDone func(result any) tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return pushScreenMsg{screen: screen, onDone: onDone}
+	}
+}
+
+// terminalSeqMsg asks the root model to send an escape sequence to the
+// terminal with the next frame, so it never interleaves with the output
+type terminalSeqMsg struct {
+	seq string
+}
+
+// clearTerminalSeqMsg drops a sent sequence from the frames
+type clearTerminalSeqMsg struct {
+	seq string
+}
+
+// terminalSeqTime is how long a sequence stays in the frames; long enough
+// for the renderer to draw one
+const terminalSeqTime = 200 * time.Millisecond
+
+// sendTerminalSeq returns a command that sends seq to the terminal
+func sendTerminalSeq(seq string) tea.Cmd {
+	return func() tea.Msg {
+		return terminalSeqMsg{seq: seq}
+	}
+}
+
+// mouseScreen is implemented by screens that handle mouse events
+type mouseScreen interface {
+	wantsMouse() bool
+}
+
+// MenuResult is returned by menu screens
+type MenuResult struct {
+	Selected  int
+	Chosen    []int // Options marked in multi-select mode
+	Cancelled bool
+}
+
+// InputResult is returned by input screens
+type InputResult struct {
+	Value     string
+	Cancelled bool
+}
+
+// screenEntry is an open screen and where its result goes
+type screenEntry struct {
+	id     int
+	model  tea.Model
+	modal  bool
+	reply  chan any
+	onDone func(result any) tea.Msg
+}
+
+// appModel is the root model that routes messages to the open screens
+type appModel struct {
+	stack     []screenEntry
+	nextID    int
+	width     int
+	height    int
+	lastView  string // Shown while a flow prepares its next screen
+	quitEmpty bool   // Quit once the last screen closes (standalone screens)
+	mouse     bool   // Whether mouse reporting is on
+	seq       string // Escape sequence sent ahead of the frame
+}
+
+func (m appModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case pushScreenMsg:
+		return m.push(msg)
+	case screenDoneMsg:
+		return m.pop(msg)
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, m.broadcast(msg)
+	case terminalSeqMsg:
+		m.seq = msg.seq
+		return m, tea.Tick(terminalSeqTime, func(time.Time) tea.Msg {
+			return clearTerminalSeqMsg(msg)
+		})
+	case clearTerminalSeqMsg:
+		if m.seq == msg.seq {
+			m.seq = ""
+		}
+		return m, nil
+	case tea.KeyMsg, tea.MouseMsg:
+		if len(m.stack) == 0 {
+			if key, ok := msg.(tea.KeyMsg); ok && key.String() == "ctrl+c" && m.quitEmpty {
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		return m, m.updateEntry(len(m.stack)-1, msg)
+	}
+	return m, m.broadcast(msg)
+}
+
+// push opens a screen and sends it the current window size
+func (m appModel) push(msg pushScreenMsg) (tea.Model, tea.Cmd) {
+	m.nextID++
+	entry := screenEntry{id: m.nextID, model: msg.screen, modal: msg.modal, reply: msg.reply, onDone: msg.onDone}
+	m.stack = append(m.stack, entry)
+	if !msg.modal {
+		m.lastView = ""
+	}
+	cmds := []tea.Cmd{tagScreenCmd(entry.model.Init(), entry.id)}
+	if m.width > 0 {
+		cmds = append(cmds, m.updateEntry(len(m.stack)-1, tea.WindowSizeMsg{Width: m.width, Height: m.height}))
+	}
+	cmds = append(cmds, m.syncMouse())
+	return m, tea.Batch(cmds...)
+}
+
+// pop closes the screen that finished and delivers its result
+func (m appModel) pop(msg screenDoneMsg) (tea.Model, tea.Cmd) {
+	i := len(m.stack) - 1
+	for i >= 0 && m.stack[i].id != msg.id {
+		i--
+	}
+	if i < 0 {
+		return m, nil
+	}
+	entry := m.stack[i]
+	m.stack = append(m.stack[:i:i], m.stack[i+1:]...)
+	if entry.reply != nil {
+		entry.reply <- msg.Result
+	}
+	if !entry.modal && m.background() < 0 {
+		// Keep the last frame until the flow opens its next screen
+		m.lastView = entry.model.View()
+	}
+	if len(m.stack) == 0 && m.quitEmpty {
+		return m, tea.Quit
+	}
+	cmd := m.syncMouse()
+	if entry.onDone != nil {
+		cmd = tea.Batch(cmd, func() tea.Msg {
+			return entry.onDone(msg.Result)
+		})
+	}
+	return m, cmd
+}
+
+// updateEntry sends msg to the i-th screen
+func (m *appModel) updateEntry(i int, msg tea.Msg) tea.Cmd {
+	model, cmd := m.stack[i].model.Update(msg)
+	m.stack[i].model = model
+	return tagScreenCmd(cmd, m.stack[i].id)
+}
+
+// broadcast sends msg to every open screen, so background screens keep
+// receiving replies, spinner ticks and job updates
+func (m *appModel) broadcast(msg tea.Msg) tea.Cmd {
+	var cmds []tea.Cmd
+	for i := range m.stack {
+		cmds = append(cmds, m.updateEntry(i, msg))
+	}
+	return tea.Batch(cmds...)
+}
+
+// syncMouse turns mouse reporting on while the top screen wants it
+func (m *appModel) syncMouse() tea.Cmd {
+	want := false
+	if len(m.stack) > 0 {
+		if s, ok := m.stack[len(m.stack)-1].model.(mouseScreen); ok {
+			want = s.wantsMouse()
+		}
+	}
+	if want == m.mouse {
+		return nil
+	}
+	m.mouse = want
+	if want {
+		return tea.EnableMouseCellMotion
+	}
+	return tea.DisableMouse
+}
+
+// background returns the index of the topmost screen that is not a modal
+func (m appModel) background() int {
+	for i := len(m.stack) - 1; i >= 0; i-- {
+		if !m.stack[i].modal {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m appModel) View() string {
+	view := m.lastView
+	bg := m.background()
+	if bg >= 0 {
+		view = m.stack[bg].model.View()
+	}
+	for _, entry := range m.stack[bg+1:] {
+		view = overlay(view, dialogStyle().Render(entry.model.View()), m.width, m.height)
+	}
+	// The renderer writes the sequence with the frame's first line
+	return m.seq + view
+}
+
+// tagScreenCmd marks the screenDoneMsg a command produces with the screen
+// it came from, so a late reply never closes a different screen
+func tagScreenCmd(cmd tea.Cmd, id int) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		switch msg := cmd().(type) {
+		case screenDoneMsg:
+			msg.id = id
+			return msg
+		case tea.BatchMsg:
+			for i := range msg {
+				msg[i] = tagScreenCmd(msg[i], id)
+			}
+			return msg
+		default:
+			return msg
+		}
+	}
+}
+
+// dialogStyle frames modal dialogs
+func dialogStyle() lipgloss.Style {
+	theme := currentSettings().UI.Colors
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(theme.Border)).
+		Padding(1, 2)
+}
+
+// overlay draws fg centered over bg, which fills a width x height window
+func overlay(bg, fg string, width, height int) string {
+	bgLines := strings.Split(bg, "\n")
+	for len(bgLines) < height {
+		bgLines = append(bgLines, "")
+	}
+	fgLines := strings.Split(fg, "\n")
+	fgWidth := lipgloss.Width(fg)
+	top := max(0, (len(bgLines)-len(fgLines))/2)
+	left := max(0, (width-fgWidth)/2)
+	for i, line := range fgLines {
+		row := top + i
+		if row >= len(bgLines) {
+			bgLines = append(bgLines, "")
+		}
+		before := ansi.Truncate(bgLines[row], left, "")
+		before += strings.Repeat(" ", left-ansi.StringWidth(before))
+		line += strings.Repeat(" ", fgWidth-ansi.StringWidth(line))
+		after := ansi.TruncateLeft(bgLines[row], left+fgWidth, "")
+		bgLines[row] = before + "\x1b[0m" + line + "\x1b[0m" + after
+	}
+	return strings.Join(bgLines, "\n")
+}
+
+// The running program, set while runTUI is active
+var (
+	tuiMu      sync.Mutex
+	tuiProgram *tea.Program
+	tuiDone    chan struct{}
+)
+
+// runTUI takes over the terminal and runs flow, which opens screens with
+// runScreen, until flow returns
+func runTUI(flow func() error) error {
+	p := tea.NewProgram(appModel{}, tea.WithAltScreen())
+	done := make(chan struct{})
+	tuiMu.Lock()
+	tuiProgram, tuiDone = p, done
+	tuiMu.Unlock()
+	defer func() {
+		tuiMu.Lock()
+		tuiProgram, tuiDone = nil, nil
+		tuiMu.Unlock()
+	}()
+	jobRunner.Attach(p)
+	defer jobRunner.Detach()
+	// Errors go to the log only while the interface owns the terminal
+	tuiActive.Store(true)
+	defer tuiActive.Store(false)
+
+	flowErr := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				flowErr <- fmt.Errorf("interface panicked: %v\n%s", r, debug.Stack())
+			}
+			p.Quit()
+		}()
+		flowErr <- flow()
+	}()
+
+	_, err := p.Run()
+	close(done)
+	if err != nil {
+		return fmt.Errorf("failed to run interface: %w", err)
+	}
+	select {
+	case err := <-flowErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// runScreen opens screen and waits for the result it reports with
+// screenDone. A modal is drawn over the current screen. Without a running
+// interface, such as at startup, the screen runs on its own. It must not be
+// called from a screen's Update; use openModal there.
+func runScreen[R any](screen tea.Model, modal bool) (R, error) {
+	var zero R
+	tuiMu.Lock()
+	p, done := tuiProgram, tuiDone
+	tuiMu.Unlock()
+
+	reply := make(chan any, 1)
+	if p == nil {
+		p = tea.NewProgram(appModel{quitEmpty: true}, tea.WithAltScreen())
+		jobRunner.Attach(p)
+		go p.Send(pushScreenMsg{screen: screen, modal: modal, reply: reply})
+		_, err := p.Run()
+		jobRunner.Detach()
+		if err != nil {
+			return zero, fmt.Errorf("failed to run screen: %w", err)
+		}
+		select {
+		case result := <-reply:
+			return screenResult[R](result)
+		default:
+			return zero, errTUIClosed
+		}
+	}
+
+	p.Send(pushScreenMsg{screen: screen, modal: modal, reply: reply})
+	select {
+	case result := <-reply:
+		return screenResult[R](result)
+	case <-done:
+		return zero, errTUIClosed
+	}
+}
+
+// screenResult converts a screen's result to the type its flow expects
+func screenResult[R any](result any) (R, error) {
+	r, ok := result.(R)
+	if !ok {
+		return r, fmt.Errorf("screen returned %T, expected %T", result, r)
+	}
+	return r, nil
+}
+
+// runMenu shows a menu and returns what was picked
+func runMenu(menu MenuModel) (MenuResult, error) {
+	return runScreen[MenuResult](menu, false)
+}
+
+// runInput asks for text and returns what was entered
+func runInput(input InputModel) (InputResult, error) {
+	return runScreen[InputResult](input, false)
+}
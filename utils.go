@@ -5,22 +5,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // Directory constants
 const (
-	utilDir  = ".util"
-	chatsDir = "chats"
+	appName       = "aichat"
+	legacyUtilDir = ".util"
+	projectDir    = ".aichat"
+	chatsDir      = "chats"
+	trashDir      = ".trash"
 )
 
+// Directories, set by setAppDirs on startup
 var (
-	utilPath  = filepath.Join(".", utilDir)
-	chatsPath = filepath.Join(utilPath, chatsDir)
+	configPath  = filepath.Join(".", legacyUtilDir)
+	dataPath    = configPath
+	cachePath   = configPath
+	projectPath string
+	chatsPath   = filepath.Join(dataPath, chatsDir)
+	trashPath   = filepath.Join(chatsPath, trashDir)
 )
 
 // AppError represents application-level errors
@@ -37,62 +43,24 @@ func (e *AppError) Error() string {
 	return fmt.Sprintf("%s: %v", e.Op, e.Err)
 }
 
-// ErrorLog represents a file-based error log
-type ErrorLog struct {
-	LogFile string
-}
-
-// NewErrorLog creates a new error logger
-func NewErrorLog() *ErrorLog {
-	return &ErrorLog{
-		LogFile: filepath.Join(utilPath, "error.log"),
-	}
-}
-
-// LogError logs an error with context to file and optionally prints to console
-func (el *ErrorLog) LogError(err error, context string, printToConsole bool) {
-	if err == nil {
-		return
-	}
-
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	logEntry := fmt.Sprintf("[%s] %s: %v\n", timestamp, context, err)
-
-	f, ferr := os.OpenFile(el.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if ferr == nil {
-		defer f.Close()
-		f.WriteString(logEntry)
-	}
-
-	if printToConsole {
-		switch e := err.(type) {
-		case *AppError:
-			fmt.Printf("\033[31mError: %s\033[0m\n", e.Error())
-		case *ModelError:
-			fmt.Printf("\033[31mModel error: %s\033[0m\n", e.Error())
-		case *PromptError:
-			fmt.Printf("\033[31mPrompt error: %s\033[0m\n", e.Error())
-		default:
-			fmt.Printf("\033[31mError during %s: %v\033[0m\n", context, err)
+func ensureEnvironment() error {
+	// Create config, data and cache directories
+	for _, dir := range []string{configPath, dataPath, cachePath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return &AppError{
+				Op:      "create app directory",
+				Err:     err,
+				Message: "failed to create " + dir,
+			}
 		}
 	}
-}
-
-var errorLog = NewErrorLog()
 
-func handleError(err error, context string) {
-	if err != nil {
-		errorLog.LogError(err, context, true)
-	}
-}
-
-func ensureEnvironment() error {
-	// Create .util directory
-	if err := os.MkdirAll(utilPath, 0755); err != nil {
+	// Create the settings, carrying over options kept elsewhere by older versions
+	if err := initializeSettings(); err != nil {
 		return &AppError{
-			Op:      "create util directory",
+			Op:      "create settings file",
 			Err:     err,
-			Message: "failed to create utility directory",
+			Message: "failed to create settings file",
 		}
 	}
 
@@ -150,20 +118,21 @@ type APIKey struct {
 
 // APIKeysConfig represents the configuration for multiple API keys
 type APIKeysConfig struct {
-	Keys      []APIKey `json:"keys"`
-	ActiveKey string   `json:"active_key,omitempty"` // Title of the active key
+	SchemaVersion int      `json:"schema_version"`
+	Keys          []APIKey `json:"keys"`
+	ActiveKey     string   `json:"-"` // Mirrors active_api_key in the settings
 }
 
 func getAPIKeysPath() string {
-	return filepath.Join(utilPath, "api_keys.json")
+	return filepath.Join(configPath, "api_keys.json")
 }
 
 func loadAPIKeys() (*APIKeysConfig, error) {
-	data, err := os.ReadFile(getAPIKeysPath())
+	data, err := readVersionedFile(apiKeysSchema, getAPIKeysPath(), 0600)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Return empty config if file doesn't exist
-			return &APIKeysConfig{Keys: []APIKey{}}, nil
+			return &APIKeysConfig{SchemaVersion: apiKeysSchema.Version(), Keys: []APIKey{}}, nil
 		}
 		return nil, &AppError{
 			Op:      "read API keys file",
@@ -180,19 +149,32 @@ func loadAPIKeys() (*APIKeysConfig, error) {
 			Message: "failed to parse API keys file",
 		}
 	}
+	config.ActiveKey = currentSettings().ActiveAPIKey
 
 	return &config, nil
 }
 
 func saveAPIKeys(config *APIKeysConfig) error {
-	if err := os.MkdirAll(utilPath, 0755); err != nil {
+	if err := os.MkdirAll(configPath, 0755); err != nil {
 		return &AppError{
-			Op:      "create util directory",
+			Op:      "create config directory",
 			Err:     err,
 			Message: "failed to create directory for API keys",
 		}
 	}
 
+	if config.ActiveKey != currentSettings().ActiveAPIKey {
+		active := config.ActiveKey
+		if err := updateSettings(func(s *Settings) { s.ActiveAPIKey = active }); err != nil {
+			return &AppError{
+				Op:      "save active API key",
+				Err:     err,
+				Message: "failed to save the active API key",
+			}
+		}
+	}
+
+	config.SchemaVersion = apiKeysSchema.Version()
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return &AppError{
@@ -202,7 +184,15 @@ func saveAPIKeys(config *APIKeysConfig) error {
 		}
 	}
 
-	if err := os.WriteFile(getAPIKeysPath(), data, 0600); err != nil {
+	if data, err = sealData(data, false); err != nil {
+		return &AppError{
+			Op:      "seal API keys",
+			Err:     err,
+			Message: "failed to encrypt API keys",
+		}
+	}
+
+	if err := writeFileAtomic(getAPIKeysPath(), data, 0600); err != nil {
 		return &AppError{
 			Op:      "write API keys file",
 			Err:     err,
@@ -358,7 +348,7 @@ func listAPIKeys() ([]APIKey, string, error) {
 
 // Legacy support functions for backward compatibility
 func getAPIKeyPath() string {
-	return filepath.Join(utilPath, ".api_key")
+	return filepath.Join(configPath, ".api_key")
 }
 
 func readAPIKey() (string, error) {
@@ -436,9 +426,7 @@ func promptAndSaveAPIKey(reader *bufio.Reader) error {
 
 // addAPIKeyFromClipboard reads the clipboard and prompts for a key name, then adds the key
 func addAPIKeyFromClipboard(reader *bufio.Reader) error {
-	// Windows clipboard command
-	clipCmd := "powershell Get-Clipboard"
-	clipOut, err := execCommand(clipCmd)
+	clipOut, err := readClipboard()
 	if err != nil {
 		return &AppError{
 			Op:      "read clipboard",
@@ -474,15 +462,6 @@ func addAPIKeyFromClipboard(reader *bufio.Reader) error {
 	return nil
 }
 
-// execCommand runs a shell command and returns its output as a string
-func execCommand(cmd string) (string, error) {
-	out, err := exec.Command("cmd", "/C", cmd).Output()
-	if err != nil {
-		return "", err
-	}
-	return string(out), nil
-}
-
 type Menu struct {
 	Title    string
 	Items    []MenuItem
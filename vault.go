@@ -0,0 +1,813 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Vault parameters. Files sealed by the vault start with vaultPrefix followed
+// by the base64 of nonce and AES-256-GCM ciphertext; chat journals are sealed
+// line by line so appends stay cheap.
+const (
+	vaultPrefix          = "aichat-vault:v1:"
+	vaultKeySize         = 32
+	defaultUnlockMinutes = 15
+	vaultScryptN         = 1 << 15
+	vaultScryptR         = 8
+	vaultScryptP         = 1
+	vaultPassphraseEnv   = "AICHAT_VAULT_PASSPHRASE"
+)
+
+// Vault errors
+var (
+	errVaultLocked    = errors.New("vault is locked")
+	errVaultCancelled = errors.New("cancelled")
+)
+
+// VaultKDF records how the passphrase key is derived
+type VaultKDF struct {
+	Name string `json:"name"`
+	Salt string `json:"salt"` // base64
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// VaultFile is the vault configuration stored in vault.json. The data key
+// that seals files is random and stored wrapped by the passphrase key, so
+// changing the passphrase does not re-encrypt any data.
+type VaultFile struct {
+	SchemaVersion int      `json:"schema_version"`
+	KDF           VaultKDF `json:"kdf"`
+	WrappedKey    string   `json:"wrapped_key"`
+	EncryptChats  bool     `json:"encrypt_chats"`  // Seal chat files as well as API keys
+	UnlockMinutes int      `json:"unlock_minutes"` // Lock again after this many idle minutes
+}
+
+// vaultState caches the vault configuration and the unlocked data key
+var vaultState struct {
+	mu      sync.Mutex
+	loaded  bool
+	config  *VaultFile
+	key     []byte
+	expires time.Time
+}
+
+// vaultPath returns the path of the vault configuration
+func vaultPath() string {
+	return filepath.Join(configPath, "vault.json")
+}
+
+// loadVaultConfig reads vault.json, returning nil when there is no vault
+func loadVaultConfig() (*VaultFile, error) {
+	data, err := readVersionedFile(vaultSchema, vaultPath(), 0600)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+	var config VaultFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse vault: %w", err)
+	}
+	if config.UnlockMinutes <= 0 {
+		config.UnlockMinutes = defaultUnlockMinutes
+	}
+	return &config, nil
+}
+
+// saveVaultConfig writes vault.json
+func saveVaultConfig(config *VaultFile) error {
+	config.SchemaVersion = vaultSchema.Version()
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault: %w", err)
+	}
+	if err := writeFileAtomic(vaultPath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	return nil
+}
+
+// currentVault returns the vault configuration, loading it on first use.
+// Callers must hold vaultState.mu.
+func currentVault() (*VaultFile, error) {
+	if !vaultState.loaded {
+		config, err := loadVaultConfig()
+		if err != nil {
+			return nil, err
+		}
+		vaultState.config = config
+		vaultState.loaded = true
+	}
+	return vaultState.config, nil
+}
+
+// vaultEnabled reports whether a vault has been set up
+func vaultEnabled() bool {
+	vaultState.mu.Lock()
+	defer vaultState.mu.Unlock()
+	config, err := currentVault()
+	// An unreadable vault counts as enabled so nothing is written in plaintext
+	return err != nil || config != nil
+}
+
+// vaultLocked reports whether the vault exists and needs the passphrase
+func vaultLocked() bool {
+	vaultState.mu.Lock()
+	defer vaultState.mu.Unlock()
+	config, err := currentVault()
+	if err != nil {
+		return true
+	}
+	return config != nil && (vaultState.key == nil || time.Now().After(vaultState.expires))
+}
+
+// vaultKey returns the unlocked data key and extends the unlock period.
+// Callers must hold vaultState.mu.
+func vaultKey() ([]byte, error) {
+	if vaultState.key == nil || time.Now().After(vaultState.expires) {
+		clear(vaultState.key)
+		vaultState.key = nil
+		return nil, errVaultLocked
+	}
+	vaultState.expires = time.Now().Add(time.Duration(vaultState.config.UnlockMinutes) * time.Minute)
+	return vaultState.key, nil
+}
+
+// deriveVaultKey derives the key that wraps the data key from a passphrase
+func deriveVaultKey(passphrase string, kdf VaultKDF) ([]byte, error) {
+	if kdf.Name != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation '%s'", kdf.Name)
+	}
+	salt, err := base64.StdEncoding.DecodeString(kdf.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault salt: %w", err)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, kdf.N, kdf.R, kdf.P, vaultKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive vault key: %w", err)
+	}
+	return key, nil
+}
+
+// newVaultKDF returns key derivation parameters with a fresh salt
+func newVaultKDF() (VaultKDF, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return VaultKDF{}, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return VaultKDF{Name: "scrypt", Salt: base64.StdEncoding.EncodeToString(salt), N: vaultScryptN, R: vaultScryptR, P: vaultScryptP}, nil
+}
+
+// sealWithKey encrypts plaintext into the vault's text format
+func sealWithKey(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(vaultPrefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// openWithKey decrypts data produced by sealWithKey
+func openWithKey(key, data []byte) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(string(data), vaultPrefix)))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt sealed data: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return nil, fmt.Errorf("corrupt sealed data")
+	}
+	plaintext, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt sealed data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// isSealed reports whether data was written by the vault
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(vaultPrefix))
+}
+
+// openData decrypts sealed data and passes plaintext through unchanged
+func openData(data []byte) ([]byte, error) {
+	if !isSealed(data) {
+		return data, nil
+	}
+	vaultState.mu.Lock()
+	defer vaultState.mu.Unlock()
+	if _, err := currentVault(); err != nil {
+		return nil, err
+	}
+	key, err := vaultKey()
+	if err != nil {
+		return nil, err
+	}
+	return openWithKey(key, data)
+}
+
+// sealData encrypts data when the vault covers it. API keys are always
+// sealed once a vault exists; chats only when encrypt_chats is set.
+func sealData(data []byte, chat bool) ([]byte, error) {
+	vaultState.mu.Lock()
+	defer vaultState.mu.Unlock()
+	config, err := currentVault()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || (chat && !config.EncryptChats) {
+		return data, nil
+	}
+	key, err := vaultKey()
+	if err != nil {
+		return nil, err
+	}
+	return sealWithKey(key, data)
+}
+
+// chatFileMode returns the permissions for chat files
+func chatFileMode() os.FileMode {
+	if vaultEnabled() {
+		return 0600
+	}
+	return 0644
+}
+
+// unlockVault unwraps the data key with a passphrase and caches it
+func unlockVault(passphrase string) error {
+	vaultState.mu.Lock()
+	defer vaultState.mu.Unlock()
+	config, err := currentVault()
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("no vault has been set up")
+	}
+	wrapKey, err := deriveVaultKey(passphrase, config.KDF)
+	if err != nil {
+		return err
+	}
+	key, err := openWithKey(wrapKey, []byte(config.WrappedKey))
+	if err != nil {
+		return fmt.Errorf("wrong passphrase")
+	}
+	vaultState.key = key
+	vaultState.expires = time.Now().Add(time.Duration(config.UnlockMinutes) * time.Minute)
+	return nil
+}
+
+// lockVault forgets the unlocked data key
+func lockVault() {
+	vaultState.mu.Lock()
+	defer vaultState.mu.Unlock()
+	clear(vaultState.key)
+	vaultState.key = nil
+}
+
+// wrapVaultKey seals the data key under a passphrase
+func wrapVaultKey(config *VaultFile, passphrase string, key []byte) error {
+	kdf, err := newVaultKDF()
+	if err != nil {
+		return err
+	}
+	wrapKey, err := deriveVaultKey(passphrase, kdf)
+	if err != nil {
+		return err
+	}
+	wrapped, err := sealWithKey(wrapKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to wrap vault key: %w", err)
+	}
+	config.KDF = kdf
+	config.WrappedKey = string(wrapped)
+	return nil
+}
+
+// initVault creates a vault and encrypts the existing files in place
+func initVault(passphrase string, encryptChats bool) error {
+	if vaultEnabled() {
+		return fmt.Errorf("a vault already exists")
+	}
+	if passphrase == "" {
+		return fmt.Errorf("passphrase cannot be empty")
+	}
+	if err := foldLegacyAPIKeys(); err != nil {
+		return err
+	}
+	key := make([]byte, vaultKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate vault key: %w", err)
+	}
+	config := &VaultFile{EncryptChats: encryptChats, UnlockMinutes: defaultUnlockMinutes}
+	if err := wrapVaultKey(config, passphrase, key); err != nil {
+		return err
+	}
+	if err := saveVaultConfig(config); err != nil {
+		return err
+	}
+
+	vaultState.mu.Lock()
+	vaultState.config = config
+	vaultState.loaded = true
+	vaultState.key = key
+	vaultState.expires = time.Now().Add(time.Duration(config.UnlockMinutes) * time.Minute)
+	vaultState.mu.Unlock()
+	return resealStoredFiles()
+}
+
+// foldLegacyAPIKeys moves keys from the plaintext .api_key files of older
+// versions into api_keys.json, which the vault seals, and removes the files
+func foldLegacyAPIKeys() error {
+	for _, path := range []string{getAPIKeyPath(), ".api_key"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if key := strings.TrimSpace(string(data)); key != "" {
+			config, err := loadAPIKeys()
+			if err != nil {
+				return err
+			}
+			known, titles := false, map[string]bool{}
+			for _, existing := range config.Keys {
+				known = known || existing.Key == key
+				titles[existing.Title] = true
+			}
+			if !known {
+				title := "Legacy key"
+				for n := 2; titles[title]; n++ {
+					title = fmt.Sprintf("Legacy key %d", n)
+				}
+				config.Keys = append(config.Keys, APIKey{Title: title, Key: key})
+				// The file was only used when no stored key was active
+				if config.ActiveKey == "" {
+					config.ActiveKey = title
+				}
+				if err := saveAPIKeys(config); err != nil {
+					return err
+				}
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// rekeyVault changes the vault passphrase
+func rekeyVault(oldPassphrase, newPassphrase string) error {
+	if newPassphrase == "" {
+		return fmt.Errorf("passphrase cannot be empty")
+	}
+	if err := unlockVault(oldPassphrase); err != nil {
+		return err
+	}
+	vaultState.mu.Lock()
+	defer vaultState.mu.Unlock()
+	config := *vaultState.config
+	if err := wrapVaultKey(&config, newPassphrase, vaultState.key); err != nil {
+		return err
+	}
+	if err := saveVaultConfig(&config); err != nil {
+		return err
+	}
+	*vaultState.config = config
+	return nil
+}
+
+// setChatEncryption turns chat encryption on or off and rewrites the chats
+func setChatEncryption(enabled bool) error {
+	vaultState.mu.Lock()
+	config, err := currentVault()
+	if err == nil && config == nil {
+		err = fmt.Errorf("no vault has been set up")
+	}
+	if err == nil {
+		_, err = vaultKey()
+	}
+	if err != nil {
+		vaultState.mu.Unlock()
+		return err
+	}
+	updated := *config
+	updated.EncryptChats = enabled
+	if err := saveVaultConfig(&updated); err != nil {
+		vaultState.mu.Unlock()
+		return err
+	}
+	*config = updated
+	vaultState.mu.Unlock()
+	return resealStoredFiles()
+}
+
+// disableVault decrypts every file in place and removes the vault
+func disableVault() error {
+	vaultState.mu.Lock()
+	config, err := currentVault()
+	if err == nil && config == nil {
+		err = fmt.Errorf("no vault has been set up")
+	}
+	if err == nil {
+		_, err = vaultKey()
+	}
+	vaultState.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Decrypt and write back everything while the vault still exists, so a
+	// failed write leaves the remaining files readable with the passphrase
+	plaintext, err := readStoredFiles()
+	if err != nil {
+		return err
+	}
+	if err := writePlainFiles(plaintext); err != nil {
+		return err
+	}
+	if err := os.Remove(vaultPath()); err != nil {
+		return fmt.Errorf("failed to remove vault: %w", err)
+	}
+	vaultState.mu.Lock()
+	vaultState.config = nil
+	clear(vaultState.key)
+	vaultState.key = nil
+	vaultState.mu.Unlock()
+	return nil
+}
+
+// writePlainFiles writes decrypted files back unsealed
+func writePlainFiles(files []storedFile) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+	for _, file := range files {
+		mode := file.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := writeFileAtomic(file.Path, file.Data, mode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// storedFile is the decrypted content of a file covered by the vault
+type storedFile struct {
+	Path    string
+	Chat    bool
+	Journal bool
+	Mode    os.FileMode
+	Data    []byte
+}
+
+// vaultCoveredFiles lists the files the vault can seal
+func vaultCoveredFiles() ([]storedFile, error) {
+	files := []storedFile{{Path: getAPIKeysPath(), Mode: 0600}}
+	for _, dir := range allChatDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read chat directory: %w", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				continue
+			}
+			switch {
+			case strings.HasSuffix(name, ".journal.jsonl"):
+				files = append(files, storedFile{Path: filepath.Join(dir, name), Chat: true, Journal: true})
+			case strings.HasSuffix(name, ".json"):
+				files = append(files, storedFile{Path: filepath.Join(dir, name), Chat: true})
+			}
+		}
+	}
+
+	// Migration backups hold old copies of keys and chats, so they are
+	// sealed whenever there is a vault
+	seen := map[string]bool{}
+	for _, root := range []string{configPath, dataPath, projectPath} {
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+		err := filepath.WalkDir(filepath.Join(root, backupsDir), func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !entry.IsDir() {
+				files = append(files, storedFile{Path: path, Mode: 0600})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup directory: %w", err)
+		}
+	}
+	return files, nil
+}
+
+// readStoredFiles reads and decrypts every file covered by the vault
+func readStoredFiles() ([]storedFile, error) {
+	files, err := vaultCoveredFiles()
+	if err != nil {
+		return nil, err
+	}
+	var result []storedFile
+	for _, file := range files {
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		if file.Journal {
+			data, err = openJournalData(data)
+		} else {
+			data, err = openData(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", file.Path, err)
+		}
+		file.Data = data
+		result = append(result, file)
+	}
+	return result, nil
+}
+
+// writeStoredFiles writes decrypted files back, sealing them as the vault
+// currently requires
+func writeStoredFiles(files []storedFile) error {
+	chatStoreMu.Lock()
+	defer chatStoreMu.Unlock()
+	for _, file := range files {
+		data, err := file.Data, error(nil)
+		if file.Journal {
+			data, err = sealJournalData(data)
+		} else {
+			data, err = sealData(data, file.Chat)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", file.Path, err)
+		}
+		mode := file.Mode
+		if mode == 0 {
+			mode = chatFileMode()
+		}
+		if err := writeFileAtomic(file.Path, data, mode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// resealStoredFiles rewrites every covered file to match the vault settings
+func resealStoredFiles() error {
+	files, err := readStoredFiles()
+	if err != nil {
+		return err
+	}
+	return writeStoredFiles(files)
+}
+
+// openJournalData decrypts the sealed lines of a journal
+func openJournalData(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		plain, err := openData(line)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(plain)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// sealJournalData seals each line of a journal when chats are encrypted
+func sealJournalData(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		sealed, err := sealData(line, true)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(sealed)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// exportVault writes decrypted copies of the API keys and chats to dir
+func exportVault(dir string) (int, error) {
+	files, err := readStoredFiles()
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		_, rel := splitAppPath(file.Path)
+		target := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return 0, fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if err := os.WriteFile(target, file.Data, 0600); err != nil {
+			return 0, fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return len(files), nil
+}
+
+// unlockVaultInteractive asks for the passphrase when the vault is locked. The
+// AICHAT_VAULT_PASSPHRASE environment variable skips the prompt for scripts.
+func unlockVaultInteractive() error {
+	if !vaultLocked() {
+		return nil
+	}
+	if passphrase := os.Getenv(vaultPassphraseEnv); passphrase != "" {
+		return unlockVault(passphrase)
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		passphrase, ok, err := promptPassphrase("Unlock Vault", "Enter the vault passphrase:")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errVaultLocked
+		}
+		if err := unlockVault(passphrase); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("wrong passphrase")
+}
+
+// promptNewPassphrase asks for a new passphrase twice
+func promptNewPassphrase() (string, error) {
+	passphrase, ok, err := promptPassphrase("Vault Passphrase", "Enter a new passphrase:")
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errVaultCancelled
+	}
+	confirm, ok, err := promptPassphrase("Vault Passphrase", "Repeat the passphrase:")
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errVaultCancelled
+	}
+	if passphrase != confirm {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// runVaultCommand implements `aichat vault` and returns the exit code
+func runVaultCommand(args []string) int {
+	usage := "usage: aichat vault init [-chats] | rekey | chats on|off | export -o DIR | disable | status"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "status":
+		config, lerr := loadVaultConfig()
+		switch {
+		case lerr != nil:
+			err = lerr
+		case config == nil:
+			fmt.Println("No vault. API keys and chats are stored in plaintext.")
+		default:
+			covered := "API keys only"
+			if config.EncryptChats {
+				covered = "API keys and chats"
+			}
+			fmt.Printf("Vault enabled (%s), locks after %d idle minutes.\n", covered, config.UnlockMinutes)
+		}
+	case "init":
+		fs := flag.NewFlagSet("vault init", flag.ContinueOnError)
+		chats := fs.Bool("chats", false, "also encrypt chats")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		passphrase, perr := promptNewPassphrase()
+		if perr != nil {
+			err = perr
+			break
+		}
+		if err = initVault(passphrase, *chats); err == nil {
+			fmt.Println("Vault created and existing files encrypted.")
+		}
+	case "rekey":
+		old, ok, perr := promptPassphrase("Change Passphrase", "Enter the current passphrase:")
+		if perr != nil || !ok {
+			err = perr
+			if err == nil {
+				err = errVaultCancelled
+			}
+			break
+		}
+		passphrase, perr := promptNewPassphrase()
+		if perr != nil {
+			err = perr
+			break
+		}
+		if err = rekeyVault(old, passphrase); err == nil {
+			fmt.Println("Vault passphrase changed.")
+		}
+	case "chats":
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		if err = unlockVaultInteractive(); err == nil {
+			if err = setChatEncryption(args[1] == "on"); err == nil {
+				fmt.Printf("Chat encryption turned %s.\n", args[1])
+			}
+		}
+	case "export":
+		fs := flag.NewFlagSet("vault export", flag.ContinueOnError)
+		dir := fs.String("o", "", "directory to write decrypted copies to")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if *dir == "" {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		if err = unlockVaultInteractive(); err == nil {
+			var count int
+			if count, err = exportVault(*dir); err == nil {
+				fmt.Printf("Exported %d decrypted files to %s.\n", count, *dir)
+			}
+		}
+	case "disable":
+		if err = unlockVaultInteractive(); err == nil {
+			if err = disableVault(); err == nil {
+				fmt.Println("Vault removed; files are stored in plaintext again.")
+			}
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vault: %v\n", err)
+		return 1
+	}
+	return 0
+}
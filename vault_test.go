@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+// useEmptyVault forgets any vault state, before and after the test
+func useEmptyVault(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		vaultState.mu.Lock()
+		defer vaultState.mu.Unlock()
+		vaultState.loaded = false
+		vaultState.config = nil
+		vaultState.key = nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestSealWithKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, vaultKeySize)
+	other := bytes.Repeat([]byte{2}, vaultKeySize)
+	sealed, err := sealWithKey(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(sealed) || bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("sealed data %q is not sealed", sealed)
+	}
+	tampered := slices.Clone(sealed)
+	tampered[len(tampered)-2] ^= 1
+
+	tests := []struct {
+		name    string
+		key     []byte
+		data    []byte
+		wantErr bool
+	}{
+		{"round trip", key, sealed, false},
+		{"wrong key", other, sealed, true},
+		{"tampered", key, tampered, true},
+		{"truncated", key, []byte(vaultPrefix + "AAAA"), true},
+		{"not base64", key, []byte(vaultPrefix + "!!!"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openWithKey(tt.key, tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("openWithKey = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || string(got) != "secret" {
+				t.Errorf("openWithKey = %q, %v; want %q", got, err, "secret")
+			}
+		})
+	}
+}
+
+// fileSealed reports whether the file at path was written by the vault
+func fileSealed(t *testing.T, path string) bool {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return isSealed(data)
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	useTempDirs(t)
+	useEmptyVault(t)
+	messages := msgs("hi", "hello")
+	if err := saveChat("chat", messages); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveAPIKeys(&APIKeysConfig{Keys: []APIKey{{Title: "work", Key: "sk-work"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(getAPIKeyPath(), []byte("sk-legacy\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := initVault("first", true); err != nil {
+		t.Fatalf("initVault: %v", err)
+	}
+	if !fileSealed(t, getAPIKeysPath()) || !fileSealed(t, chatSnapshotPath("chat")) {
+		t.Fatal("files were not sealed by initVault")
+	}
+	if _, err := os.Stat(getAPIKeyPath()); !os.IsNotExist(err) {
+		t.Errorf("legacy key file was left behind: %v", err)
+	}
+	keys, err := loadAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.Keys) != 2 || keys.Keys[1] != (APIKey{Title: "Legacy key", Key: "sk-legacy"}) {
+		t.Errorf("keys %+v, want the legacy key folded in", keys.Keys)
+	}
+
+	// New journal events are sealed as well
+	messages = append(messages, Message{Role: "user", Content: "more"})
+	if err := saveChat("chat", messages); err != nil {
+		t.Fatal(err)
+	}
+	if !fileSealed(t, chatJournalPath("chat")) {
+		t.Error("journal was not sealed")
+	}
+
+	lockVault()
+	if _, err := loadChat("chat"); !errors.Is(err, errVaultLocked) {
+		t.Errorf("loadChat on a locked vault = %v, want errVaultLocked", err)
+	}
+	if err := unlockVault("wrong"); err == nil {
+		t.Error("unlockVault accepted a wrong passphrase")
+	}
+	if err := rekeyVault("first", "second"); err != nil {
+		t.Fatalf("rekeyVault: %v", err)
+	}
+	lockVault()
+	if err := unlockVault("first"); err == nil {
+		t.Error("unlockVault accepted the old passphrase")
+	}
+	if err := unlockVault("second"); err != nil {
+		t.Fatalf("unlockVault: %v", err)
+	}
+	if got, err := loadChat("chat"); err != nil || !slices.Equal(got, messages) {
+		t.Errorf("loadChat = %v, %v; want %v", got, err, messages)
+	}
+
+	if err := disableVault(); err != nil {
+		t.Fatalf("disableVault: %v", err)
+	}
+	if fileSealed(t, getAPIKeysPath()) || fileSealed(t, chatSnapshotPath("chat")) {
+		t.Error("files are still sealed after disableVault")
+	}
+	if _, err := os.Stat(vaultPath()); !os.IsNotExist(err) {
+		t.Errorf("vault.json was left behind: %v", err)
+	}
+	if got, err := loadChat("chat"); err != nil || !slices.Equal(got, messages) {
+		t.Errorf("loadChat = %v, %v; want %v", got, err, messages)
+	}
+}